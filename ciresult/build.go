@@ -0,0 +1,309 @@
+/*
+ * Copyright (c) 2021, salesforce.com, inc.
+ * All rights reserved.
+ * SPDX-License-Identifier: BSD-3-Clause
+ * For full license text, see the LICENSE file in the repo root or https://opensource.org/licenses/BSD-3-Clause
+ */
+package ciresult
+
+import (
+	"fmt"
+	"github.com/kelseyhightower/envconfig"
+	"os"
+	"reflect"
+	"regexp"
+	"strconv"
+	"time"
+)
+
+var (
+	successKey      = "SUCCESS"
+	fixedKey        = "FIXED"
+	unstableKey     = "UNSTABLE"
+	unknownKey      = "UNKNOWN"
+	failureKey      = "FAILURE"
+	stillFailingKey = "STILL FAILING"
+
+	successStatus      = Status{text: "Success", color: "good"}
+	fixedStatus        = Status{text: "Fixed", color: "good"}
+	unstableStatus     = Status{text: "Unstable", color: "warning"}
+	unknownStatus      = Status{text: "Unknown", color: "warning"}
+	failedStatus       = Status{text: "Failed", color: "danger"}
+	stillFailingStatus = Status{text: "Still Failing", color: "danger"}
+
+	defaultStatus = unknownStatus
+
+	statusMap = map[string]Status{
+		successKey:      successStatus,
+		fixedKey:        fixedStatus,
+		unstableKey:     unstableStatus,
+		unknownKey:      unknownStatus,
+		failureKey:      failedStatus,
+		stillFailingKey: stillFailingStatus,
+	}
+
+	branchFieldTitle      = "Branch"
+	commitFieldTitle      = "Commit"
+	buildTimeFieldTitle   = "Time"
+	triggeredByFieldTitle = "Triggered By"
+
+	PickRunModeErrorMessage = "please specify either HOOK_URL or both OAUTH_TOKEN and DEST_CHANNEL_ID, and / or TEAMS_HOOK_URL, DISCORD_HOOK_URL, MATTERMOST_HOOK_URL, WEBHOOK_URL or EMAIL_TO"
+)
+
+/*
+Status represents generic build status with text and an associated color
+*/
+type Status struct {
+	text, color string
+}
+
+/*
+Text returns the status as shown in messages, e.g. "Still Failing"
+*/
+func (status Status) Text() string {
+	return status.text
+}
+
+/*
+Color returns the Slack attachment color of the status: good, warning or danger
+*/
+func (status Status) Color() string {
+	return status.color
+}
+
+/*
+BuildInfo represents the build information passed in from the caller
+*/
+type BuildInfo struct {
+	JobName         string `required:"true" split_words:"true" desc:"Name of the build's job"`
+	BuildURL        string `required:"true" split_words:"true" desc:"Direct URL to the build"`
+	BuildStatus     string `required:"true" split_words:"true" desc:"Status of build (e.g. currentBuild.currentResult in Jenkins)"`
+	HookURL         string `split_words:"true" desc:"Slack Webhook URL set via Incoming Webhooks"`
+	DestChannelId   string `split_words:"true" desc:"Destination Channel ID (not the name of the channel)"`
+	OauthToken      string `split_words:"true" desc:"OAuth Token used to send message via app"`
+	LastBuildStatus string `split_words:"true" default:"UNKNOWN" desc:"Status of last build used to provide contextual build Status"`
+	BranchName      string `split_words:"true" desc:"Name of git branch"`
+	GitCommit       string `split_words:"true" desc:"Git commit hash"`
+	BuildTime       string `split_words:"true" desc:"Build time (e.g. durationString in Jenkins)"`
+	TriggeredBy     string `split_words:"true" desc:"The action which triggered the build"`
+	SkipIfSuccess   bool   `split_words:"true" desc:"Skip posting if contextual Status is success"`
+	NotifyRules     string `split_words:"true" desc:"Semicolon separated rules choosing the builds posted, e.g. 'notify on: Failed, Still Failing, Fixed; branches: main, release/*; skip triggered-by: Timer'"`
+
+	SlackApiUrl string `split_words:"true" desc:"Base URL of the Slack Web API used with OAUTH_TOKEN (e.g. an Enterprise Grid or test server), defaults to https://slack.com/api/"`
+	SlackTeamId string `split_words:"true" desc:"Workspace ID to post in when OAUTH_TOKEN belongs to an org-wide Enterprise Grid app"`
+
+	TeamsHookUrl      string `split_words:"true" desc:"Microsoft Teams incoming webhook URL to post an Adaptive Card to, alongside or instead of Slack"`
+	DiscordHookUrl    string `split_words:"true" desc:"Discord webhook URL to post an embed to, alongside or instead of Slack"`
+	MattermostHookUrl string `split_words:"true" desc:"Mattermost incoming webhook URL to post an attachment to, alongside or instead of Slack"`
+
+	WebhookUrl          string `split_words:"true" desc:"URL of a generic webhook to POST the build result to as JSON"`
+	WebhookHeaders      string `split_words:"true" desc:"Newline separated 'Name: value' headers sent to WEBHOOK_URL"`
+	WebhookTemplate     string `split_words:"true" desc:"Go template rendering the WEBHOOK_URL body, defaults to the build result as JSON"`
+	WebhookTemplateFile string `split_words:"true" desc:"Path to a file containing the WEBHOOK_TEMPLATE"`
+
+	EmailTo      string `split_words:"true" desc:"Comma separated addresses to email the build result to"`
+	EmailFrom    string `split_words:"true" desc:"Sender address of the email"`
+	SmtpHost     string `split_words:"true" desc:"SMTP server used to send email (STARTTLS is used when offered)"`
+	SmtpPort     int    `split_words:"true" default:"587" desc:"SMTP server port"`
+	SmtpUsername string `split_words:"true" desc:"SMTP username, if the server requires authentication"`
+	SmtpPassword string `split_words:"true" desc:"SMTP password"`
+
+	PrNumber       string `split_words:"true" desc:"Pull / merge request number (detected for Jenkins, GitHub, GitLab, Bitbucket and CircleCI)"`
+	PrTitle        string `split_words:"true" desc:"Pull / merge request title"`
+	PrUrl          string `split_words:"true" desc:"Pull / merge request URL"`
+	PrAuthor       string `split_words:"true" desc:"Pull / merge request author"`
+	PrTargetBranch string `split_words:"true" desc:"Branch the pull / merge request targets"`
+
+	RepoUrl  string `split_words:"true" desc:"Web URL of the repository used to link commits and branches (detected when unset)"`
+	RepoHost string `split_words:"true" desc:"Source host of REPO_URL: github, gitlab, bitbucket or gitea (detected when unset)"`
+
+	CommitMessages string `split_words:"true" desc:"Newline separated commits in the build, as subjects or tab separated SHA, author and subject"`
+	GitRepoDir     string `split_words:"true" default:"." desc:"Git checkout used to list the commits since the last success when COMMIT_MESSAGES is unset"`
+	MaxCommits     int    `split_words:"true" default:"10" desc:"Maximum number of commits to list in failure messages, 0 to disable"`
+
+	BuildStartTime  string  `split_words:"true" desc:"Build start as RFC 3339 or Unix epoch (seconds or milliseconds), used instead of BUILD_TIME"`
+	BuildEndTime    string  `split_words:"true" desc:"Build end as RFC 3339 or Unix epoch (seconds or milliseconds), defaults to now"`
+	SlowBuildFactor float64 `split_words:"true" default:"1.5" desc:"Flag builds taking longer than this multiple of the job's median duration"`
+
+	StagesJson string `split_words:"true" desc:"JSON list of stages, e.g. [{\"name\":\"Build\",\"status\":\"SUCCESS\",\"duration\":\"1m3s\"}]"`
+	StagesFile string `split_words:"true" desc:"Path to a file containing the STAGES_JSON list"`
+
+	MatrixCell  string `split_words:"true" desc:"Name of this matrix cell (e.g. linux/go1.25); records the result for 'collect' instead of posting"`
+	MatrixRunId string `split_words:"true" desc:"ID shared by all cells of a matrix run (e.g. GITHUB_RUN_ID)"`
+	MatrixStore string `split_words:"true" desc:"Directory shared by all cells of a matrix run and the 'collect' invocation"`
+
+	JunitReports       string `split_words:"true" desc:"Comma separated globs of JUnit XML reports to summarize"`
+	MaxFailedTests     int    `split_words:"true" default:"5" desc:"Maximum number of failing tests to list"`
+	GoTestJson         string `split_words:"true" desc:"Path to 'go test -json' output to summarize (- for stdin)"`
+	SlowestTests       int    `split_words:"true" default:"3" desc:"Number of slowest tests to list from go test output"`
+	FailureOutputLines int    `split_words:"true" default:"5" desc:"Lines of output to show for each failing go test"`
+
+	CoverageReport        string        `split_words:"true" desc:"Path to a Go coverprofile, Cobertura XML or LCOV report"`
+	CoverageDropThreshold float64       `split_words:"true" default:"1" desc:"Percentage points coverage may drop before the message is flagged"`
+	HistoryFile           string        `split_words:"true" desc:"Path to a JSON file used to record build history"`
+	HistoryRetention      time.Duration `split_words:"true" default:"720h" desc:"How long builds are kept in the history file"`
+	DigestWindow          time.Duration `split_words:"true" default:"24h" desc:"Period summarized by the 'digest' command, e.g. 168h for a weekly digest"`
+
+	QuietHours         string `split_words:"true" desc:"Semicolon separated '[days ]HH:MM-HH:MM[=action]' windows, e.g. 'Mon-Fri 22:00-07:00; Sat,Sun 00:00-24:00=queue'"`
+	QuietHoursAction   string `split_words:"true" default:"suppress" desc:"What happens to builds during QUIET_HOURS: suppress, downgrade (no mentions) or queue (for the next digest)"`
+	QuietHoursTimezone string `split_words:"true" default:"UTC" desc:"IANA time zone of QUIET_HOURS, e.g. Europe/Berlin"`
+
+	DedupWindow time.Duration `split_words:"true" desc:"Deduplicate notifications repeating the job, branch, commit and status of one posted this long before (requires HISTORY_FILE), 0 to disable"`
+	DedupAction string        `split_words:"true" default:"skip" desc:"What happens to repeated notifications within DEDUP_WINDOW: skip, or reply (a re-run reply in the original thread, requires OAUTH_TOKEN)"`
+
+	LogFile         string `split_words:"true" desc:"Path to a build log to upload in the message thread when the build isn't successful (requires OAUTH_TOKEN)"`
+	LogMatch        string `split_words:"true" desc:"Regex selecting the log lines to upload (e.g. ERROR)"`
+	LogMatchContext int    `split_words:"true" default:"5" desc:"Lines of context to keep around each LOG_MATCH line"`
+	LogTailLines    int    `split_words:"true" default:"200" desc:"Maximum number of (trailing) log lines to upload, 0 for all"`
+	LogMaxBytes     int    `split_words:"true" default:"262144" desc:"Maximum size of the uploaded log in bytes"`
+
+	RedactPatterns string `split_words:"true" desc:"Whitespace separated regexes whose matches are masked in everything sent"`
+
+	Timeout time.Duration `split_words:"true" default:"2m" desc:"Maximum time spent delivering the result to every destination, 0 to disable"`
+
+	ProxyUrl       string `split_words:"true" desc:"Proxy used for every destination instead of HTTP_PROXY / HTTPS_PROXY, 'direct' for none"`
+	ProxyOverrides string `split_words:"true" desc:"Comma separated destination=proxy pairs (slack, teams, discord, mattermost, webhook) overriding PROXY_URL"`
+	CaBundle       string `split_words:"true" desc:"Path to PEM certificates trusted in addition to the system roots"`
+	ClientCert     string `split_words:"true" desc:"Path to a PEM client certificate presented for mutual TLS"`
+	ClientKey      string `split_words:"true" desc:"Path to the PEM private key of CLIENT_CERT"`
+
+	TestSummary   *TestSummary       `ignored:"true"`
+	GoTestSummary *GoTestSummary     `ignored:"true"`
+	Coverage      *float64           `ignored:"true"`
+	History       *History           `ignored:"true"`
+	Commits       []Commit           `ignored:"true"`
+	Duration      time.Duration      `ignored:"true"`
+	Stages        []Stage            `ignored:"true"`
+	MatrixCells   []MatrixCellResult `ignored:"true"`
+
+	// redactors are added by the Redact middleware
+	redactors []*regexp.Regexp
+	// silenced builds are posted without mentions during quiet hours
+	silenced bool
+	// queued builds are held during quiet hours for the next digest
+	queued bool
+	// posted builds were notified, recording slackMessage when it was posted via the app
+	posted       bool
+	slackMessage *postedMessage
+}
+
+/*
+GetContextualStatus returns the build's Status, taking the last build's into account to tell Fixed and Still Failing
+builds apart
+*/
+func (buildInfo *BuildInfo) GetContextualStatus() Status {
+	status, present := statusMap[buildInfo.BuildStatus]
+	if !present {
+		return defaultStatus
+	}
+	lastBuildStatus := statusMap[buildInfo.LastBuildStatus]
+	if lastBuildStatus == failedStatus && status == successStatus {
+		return fixedStatus
+	} else if lastBuildStatus == failedStatus && status == failedStatus {
+		return stillFailingStatus
+	}
+	return status
+}
+
+/*
+ShouldSkipPosting reports whether SkipIfSuccess or NotifyRules hold back this build
+*/
+func (buildInfo *BuildInfo) ShouldSkipPosting() bool {
+	// Invalid rules are rejected by Validate before anything is delivered
+	rules, _ := buildInfo.FilterRules()
+	for _, rule := range rules {
+		if rule.Matches(buildInfo) == rule.Skip {
+			return true
+		}
+	}
+	return false
+}
+
+/*
+NewBuildInfo returns a BuildInfo for the build with every other setting at the default used for its environment
+variable
+*/
+func NewBuildInfo(jobName string, buildURL string, buildStatus string) BuildInfo {
+	buildInfo := BuildInfo{JobName: jobName, BuildURL: buildURL, BuildStatus: buildStatus}
+	value := reflect.ValueOf(&buildInfo).Elem()
+	for i := 0; i < value.NumField(); i++ {
+		defaultValue, present := value.Type().Field(i).Tag.Lookup("default")
+		if present {
+			// The defaults are fixed and covered by tests, so they can't fail to parse
+			_ = setFieldFromString(value.Field(i), defaultValue)
+		}
+	}
+	return buildInfo
+}
+
+func setFieldFromString(field reflect.Value, text string) error {
+	switch {
+	case field.Type() == reflect.TypeOf(time.Duration(0)):
+		duration, err := time.ParseDuration(text)
+		field.SetInt(int64(duration))
+		return err
+	case field.Kind() == reflect.String:
+		field.SetString(text)
+	case field.Kind() == reflect.Int:
+		number, err := strconv.Atoi(text)
+		field.SetInt(int64(number))
+		return err
+	case field.Kind() == reflect.Float64:
+		number, err := strconv.ParseFloat(text, 64)
+		field.SetFloat(number)
+		return err
+	case field.Kind() == reflect.Bool:
+		flag, err := strconv.ParseBool(text)
+		field.SetBool(flag)
+		return err
+	default:
+		return fmt.Errorf("unsupported default for %s", field.Type())
+	}
+	return nil
+}
+
+/*
+GetBuildInfoFromEnv returns the BuildInfo configured by environment variables, printing their usage if that fails
+*/
+func GetBuildInfoFromEnv() (BuildInfo, error) {
+	envConfigPrefix := ""
+	var buildInfo BuildInfo
+	err := envconfig.Process(envConfigPrefix, &buildInfo)
+	if err != nil {
+		// Primarily exists for testing use cases
+		suppressUsage, _ := strconv.ParseBool(os.Getenv("SUPPRESS_USAGE"))
+		if !suppressUsage {
+			_ = envconfig.Usage(envConfigPrefix, &buildInfo)
+		}
+		return buildInfo, fmt.Errorf("environment variable error: %s", err)
+	}
+	buildInfo.DetectPullRequest()
+	buildInfo.DetectRepo()
+	err = buildInfo.ParseBuildDuration(time.Now())
+	if err != nil {
+		return buildInfo, err
+	}
+	return buildInfo, buildInfo.Validate()
+}
+
+/*
+Validate returns the first error found in the settings which are parsed when they're used: REDACT_PATTERNS,
+LOG_MATCH, FAILURE_OUTPUT_LINES, NOTIFY_RULES, QUIET_HOURS, deduplication and the transport
+*/
+func (buildInfo *BuildInfo) Validate() error {
+	for _, validate := range []func() error{
+		buildInfo.ValidateRedactPatterns,
+		buildInfo.ValidateLogMatch,
+		buildInfo.ValidateFailureOutputLines,
+		buildInfo.ValidateNotifyRules,
+		buildInfo.ValidateQuietHours,
+		buildInfo.ValidateDedup,
+		buildInfo.ValidateTransport,
+	} {
+		err := validate()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
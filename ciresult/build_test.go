@@ -4,9 +4,10 @@
  * SPDX-License-Identifier: BSD-3-Clause
  * For full license text, see the LICENSE file in the repo root or https://opensource.org/licenses/BSD-3-Clause
  */
-package internal
+package ciresult
 
 import (
+	"github.com/kelseyhightower/envconfig"
 	"reflect"
 	"testing"
 )
@@ -148,3 +149,38 @@ func Test_GetBuildInfoFromEnv_UsageOutput(t *testing.T) {
 		t.Error("Expected error when required environment variables missing")
 	}
 }
+
+func Test_NewBuildInfo(t *testing.T) {
+	t.Setenv("JOB_NAME", "job")
+	t.Setenv("BUILD_URL", "https://ci/1")
+	t.Setenv("BUILD_STATUS", successKey)
+	var fromEnv BuildInfo
+	err := envconfig.Process("", &fromEnv)
+	if err != nil {
+		t.Fatalf("envconfig.Process() unexpected error: %v", err)
+	}
+
+	got := NewBuildInfo("job", "https://ci/1", successKey)
+	if got.JobName != "job" || got.BuildURL != "https://ci/1" || got.BuildStatus != successKey {
+		t.Errorf("NewBuildInfo() = %+v", got)
+	}
+	gotValue, wantValue := reflect.ValueOf(got), reflect.ValueOf(fromEnv)
+	for i := 0; i < gotValue.NumField(); i++ {
+		field := gotValue.Type().Field(i)
+		if _, present := field.Tag.Lookup("default"); !present {
+			continue
+		}
+		if !reflect.DeepEqual(gotValue.Field(i).Interface(), wantValue.Field(i).Interface()) {
+			t.Errorf("NewBuildInfo() %s = %v, want the environment default %v", field.Name, gotValue.Field(i), wantValue.Field(i))
+		}
+	}
+}
+
+func Test_StatusAccessors(t *testing.T) {
+	buildInfo := NewBuildInfo("job", "https://ci/1", failureKey)
+	buildInfo.LastBuildStatus = failureKey
+	status := buildInfo.GetContextualStatus()
+	if status.Text() != "Still Failing" || status.Color() != "danger" {
+		t.Errorf("GetContextualStatus() = %v %v, want Still Failing danger", status.Text(), status.Color())
+	}
+}
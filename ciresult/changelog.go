@@ -0,0 +1,132 @@
+/*
+ * Copyright (c) 2021, salesforce.com, inc.
+ * All rights reserved.
+ * SPDX-License-Identifier: BSD-3-Clause
+ * For full license text, see the LICENSE file in the repo root or https://opensource.org/licenses/BSD-3-Clause
+ */
+package ciresult
+
+import (
+	"fmt"
+	"github.com/slack-go/slack"
+	"os/exec"
+	"regexp"
+	"strings"
+)
+
+const (
+	maxChangelogLength = 1500
+	gitLogFormat       = "--format=%H%x09%an%x09%s"
+)
+
+var (
+	changesFieldTitle = "Changes"
+
+	commitSHA = regexp.MustCompile(`^[0-9a-fA-F]{4,64}$`)
+
+	// runGit is swapped out in tests
+	runGit = func(dir string, args ...string) ([]byte, error) {
+		return exec.Command("git", append([]string{"-C", dir}, args...)...).Output()
+	}
+)
+
+/*
+Commit represents a commit which went into the build
+*/
+type Commit struct {
+	SHA, Author, Subject string
+}
+
+/*
+ShowsChangelog reports whether the message lists the commits which went into the build (failures only)
+*/
+func (buildInfo *BuildInfo) ShowsChangelog() bool {
+	return buildInfo.MaxCommits > 0 && buildInfo.GetContextualStatus().color == failedStatus.color
+}
+
+/*
+LoadCommits reads the commits which went into the build from CommitMessages or, failing that, from
+`git log` between the last successful commit and GitCommit
+*/
+func (buildInfo *BuildInfo) LoadCommits() error {
+	if !buildInfo.ShowsChangelog() {
+		return nil
+	}
+	if strings.TrimSpace(buildInfo.CommitMessages) != "" {
+		buildInfo.Commits = parseCommits(buildInfo.CommitMessages)
+		return nil
+	}
+	commit := strings.TrimSpace(buildInfo.GitCommit)
+	if !commitSHA.MatchString(commit) {
+		return nil
+	}
+	lastSuccessfulCommit := buildInfo.LastSuccessfulCommit()
+	if lastSuccessfulCommit == commit {
+		return nil
+	}
+	// Without a previous success to compare against only the built commit itself is listed
+	args := []string{"log", gitLogFormat, "--max-count=1", commit}
+	if commitSHA.MatchString(lastSuccessfulCommit) {
+		args = []string{"log", gitLogFormat, lastSuccessfulCommit + ".." + commit}
+	}
+	output, err := runGit(buildInfo.GitRepoDir, args...)
+	if err != nil {
+		return fmt.Errorf("git log failed: %s", err)
+	}
+	buildInfo.Commits = parseCommits(string(output))
+	return nil
+}
+
+// parseCommits parses one commit per line, either as a bare subject or as tab separated SHA, author and subject
+func parseCommits(text string) []Commit {
+	var commits []Commit
+	for _, line := range strings.Split(text, "\n") {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		parts := strings.SplitN(line, "\t", 3)
+		if len(parts) == 3 {
+			commits = append(commits, Commit{SHA: parts[0], Author: parts[1], Subject: strings.TrimSpace(parts[2])})
+		} else {
+			commits = append(commits, Commit{Subject: strings.TrimSpace(line)})
+		}
+	}
+	return commits
+}
+
+func (buildInfo *BuildInfo) changelogText() string {
+	var lines []string
+	length := 0
+	for i, commit := range buildInfo.Commits {
+		line := "• " + buildInfo.commitLineText(commit)
+		if i >= buildInfo.MaxCommits || length+len(line) > maxChangelogLength {
+			lines = append(lines, fmt.Sprintf("...and %d more", len(buildInfo.Commits)-i))
+			break
+		}
+		lines = append(lines, line)
+		length += len(line) + 1
+	}
+	return strings.Join(lines, "\n")
+}
+
+func (buildInfo *BuildInfo) commitLineText(commit Commit) string {
+	text := mrkdwnEscaper.Replace(commit.Subject)
+	if commit.SHA != "" {
+		sha := mrkdwnEscaper.Replace(shortCommit(commit.SHA))
+		if commitURL := buildInfo.CommitURL(commit.SHA); commitURL != "" {
+			sha = slackLink(commitURL, shortCommit(commit.SHA))
+		}
+		text = sha + " " + text
+	}
+	if commit.Author != "" {
+		text += " (" + mrkdwnEscaper.Replace(commit.Author) + ")"
+	}
+	return text
+}
+
+func appendChangelogField(attachmentFields *[]slack.AttachmentField, buildInfo BuildInfo) {
+	if !buildInfo.ShowsChangelog() || len(buildInfo.Commits) == 0 {
+		return
+	}
+	*attachmentFields = append(*attachmentFields, getLongAttachmentField(changesFieldTitle, buildInfo.changelogText()))
+}
@@ -0,0 +1,165 @@
+/*
+ * Copyright (c) 2021, salesforce.com, inc.
+ * All rights reserved.
+ * SPDX-License-Identifier: BSD-3-Clause
+ * For full license text, see the LICENSE file in the repo root or https://opensource.org/licenses/BSD-3-Clause
+ */
+package ciresult
+
+import (
+	"errors"
+	"github.com/slack-go/slack"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func stubGit(t *testing.T, output string, err error) *[]string {
+	var capturedArgs []string
+	original := runGit
+	runGit = func(dir string, args ...string) ([]byte, error) {
+		capturedArgs = append([]string{dir}, args...)
+		return []byte(output), err
+	}
+	t.Cleanup(func() { runGit = original })
+	return &capturedArgs
+}
+
+func Test_LoadCommits(t *testing.T) {
+	gitOutput := "aaaaaaaaaa\tJane Doe\tFix the build\nbbbbbbbbbb\tJohn Doe\tBreak the build\n"
+	parsed := []Commit{
+		{SHA: "aaaaaaaaaa", Author: "Jane Doe", Subject: "Fix the build"},
+		{SHA: "bbbbbbbbbb", Author: "John Doe", Subject: "Break the build"},
+	}
+	history := &History{Records: []BuildRecord{{JobName: jobName, BranchName: "main", BuildStatus: successKey, GitCommit: "cccccccccc"}}}
+	tests := []struct {
+		name        string
+		buildInfo   BuildInfo
+		gitErr      error
+		wantArgs    []string
+		wantCommits []Commit
+		wantErr     bool
+	}{
+		{
+			"successful builds don't list commits",
+			BuildInfo{BuildStatus: successKey, GitCommit: "aaaaaaaaaa", MaxCommits: 10},
+			nil,
+			nil,
+			nil,
+			false,
+		},
+		{
+			"disabled",
+			BuildInfo{BuildStatus: failureKey, GitCommit: "aaaaaaaaaa", MaxCommits: 0},
+			nil,
+			nil,
+			nil,
+			false,
+		},
+		{
+			"commit messages from the environment",
+			BuildInfo{BuildStatus: failureKey, MaxCommits: 10, CommitMessages: "First change\n\naaaaaaaaaa\tJane Doe\tSecond change"},
+			nil,
+			nil,
+			[]Commit{{Subject: "First change"}, {SHA: "aaaaaaaaaa", Author: "Jane Doe", Subject: "Second change"}},
+			false,
+		},
+		{
+			"range since the last success",
+			BuildInfo{JobName: jobName, BranchName: "main", BuildStatus: failureKey, GitCommit: "aaaaaaaaaa", MaxCommits: 10, GitRepoDir: "/src", History: history},
+			nil,
+			[]string{"/src", "log", gitLogFormat, "cccccccccc..aaaaaaaaaa"},
+			parsed,
+			false,
+		},
+		{
+			"only the built commit without history",
+			BuildInfo{BuildStatus: failureKey, GitCommit: "aaaaaaaaaa", MaxCommits: 10, GitRepoDir: "/src"},
+			nil,
+			[]string{"/src", "log", gitLogFormat, "--max-count=1", "aaaaaaaaaa"},
+			parsed,
+			false,
+		},
+		{
+			"not a commit sha",
+			BuildInfo{BuildStatus: failureKey, GitCommit: "--output=/etc/passwd", MaxCommits: 10},
+			nil,
+			nil,
+			nil,
+			false,
+		},
+		{
+			"git failure",
+			BuildInfo{BuildStatus: failureKey, GitCommit: "aaaaaaaaaa", MaxCommits: 10},
+			errors.New("not a git repository"),
+			[]string{"", "log", gitLogFormat, "--max-count=1", "aaaaaaaaaa"},
+			nil,
+			true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			capturedArgs := stubGit(t, gitOutput, tt.gitErr)
+			err := tt.buildInfo.LoadCommits()
+			if (err != nil) != tt.wantErr {
+				t.Errorf("LoadCommits() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(*capturedArgs, tt.wantArgs) {
+				t.Errorf("LoadCommits() git args = %v, want %v", *capturedArgs, tt.wantArgs)
+			}
+			if !reflect.DeepEqual(tt.buildInfo.Commits, tt.wantCommits) {
+				t.Errorf("LoadCommits() Commits = %v, want %v", tt.buildInfo.Commits, tt.wantCommits)
+			}
+		})
+	}
+}
+
+func Test_appendChangelogField(t *testing.T) {
+	commits := []Commit{
+		{SHA: "aaaaaaaaaa", Author: "Jane Doe", Subject: "Fix <things>"},
+		{Subject: "Plain subject"},
+		{SHA: "bbbbbbbbbb", Subject: "No author"},
+	}
+	tests := []struct {
+		name      string
+		buildInfo BuildInfo
+		want      []slack.AttachmentField
+	}{
+		{
+			"not a failure",
+			BuildInfo{BuildStatus: successKey, MaxCommits: 10, Commits: commits},
+			emptyAttachmentFields,
+		},
+		{
+			"all commits",
+			BuildInfo{BuildStatus: failureKey, MaxCommits: 10, Commits: commits},
+			[]slack.AttachmentField{getLongAttachmentField(changesFieldTitle,
+				"• aaaaaaa Fix &lt;things&gt; (Jane Doe)\n• Plain subject\n• bbbbbbb No author")},
+		},
+		{
+			"linked and capped",
+			BuildInfo{BuildStatus: failureKey, LastBuildStatus: failureKey, MaxCommits: 1, Commits: commits,
+				RepoUrl: "https://github.com/example/svc", RepoHost: githubHost},
+			[]slack.AttachmentField{getLongAttachmentField(changesFieldTitle,
+				"• <https://github.com/example/svc/commit/aaaaaaaaaa|aaaaaaa> Fix &lt;things&gt; (Jane Doe)\n...and 2 more")},
+		},
+		{
+			"length capped",
+			BuildInfo{BuildStatus: failureKey, MaxCommits: 10, Commits: []Commit{
+				{Subject: strings.Repeat("a", maxChangelogLength-10)},
+				{Subject: "too long now"},
+			}},
+			[]slack.AttachmentField{getLongAttachmentField(changesFieldTitle,
+				"• "+strings.Repeat("a", maxChangelogLength-10)+"\n...and 1 more")},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []slack.AttachmentField
+			appendChangelogField(&got, tt.buildInfo)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("appendChangelogField() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
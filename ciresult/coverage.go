@@ -0,0 +1,182 @@
+/*
+ * Copyright (c) 2021, salesforce.com, inc.
+ * All rights reserved.
+ * SPDX-License-Identifier: BSD-3-Clause
+ * For full license text, see the LICENSE file in the repo root or https://opensource.org/licenses/BSD-3-Clause
+ */
+package ciresult
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"github.com/slack-go/slack"
+	"os"
+	"strconv"
+	"strings"
+)
+
+var (
+	coverageFieldTitle = "Coverage"
+
+	errNoCoverageData = errors.New("no coverage data found")
+)
+
+/*
+LoadCoverage parses the Go coverprofile, Cobertura XML or LCOV report at CoverageReport into Coverage
+*/
+func (buildInfo *BuildInfo) LoadCoverage() error {
+	if strings.TrimSpace(buildInfo.CoverageReport) == "" {
+		return nil
+	}
+	data, err := os.ReadFile(buildInfo.CoverageReport)
+	if err != nil {
+		return err
+	}
+	coverage, err := parseCoverage(data)
+	if err != nil {
+		return fmt.Errorf("unable to parse coverage report %s: %s", buildInfo.CoverageReport, err)
+	}
+	buildInfo.Coverage = &coverage
+	return nil
+}
+
+func parseCoverage(data []byte) (float64, error) {
+	trimmed := bytes.TrimSpace(data)
+	switch {
+	case bytes.HasPrefix(trimmed, []byte("mode:")):
+		return parseGoCoverProfile(trimmed)
+	case bytes.HasPrefix(trimmed, []byte("<")):
+		return parseCobertura(trimmed)
+	default:
+		return parseLCOV(trimmed)
+	}
+}
+
+func parseGoCoverProfile(data []byte) (float64, error) {
+	// Merged profiles can list the same block more than once, so a block counts as covered if any entry covers it
+	statements := map[string]int{}
+	covered := map[string]bool{}
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "mode:") {
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) != 3 {
+			return 0, fmt.Errorf("invalid coverprofile line %q", line)
+		}
+		numStatements, err := strconv.Atoi(fields[1])
+		if err != nil {
+			return 0, fmt.Errorf("invalid coverprofile line %q", line)
+		}
+		count, err := strconv.Atoi(fields[2])
+		if err != nil {
+			return 0, fmt.Errorf("invalid coverprofile line %q", line)
+		}
+		statements[fields[0]] = numStatements
+		covered[fields[0]] = covered[fields[0]] || count > 0
+	}
+	var total, hit int
+	for block, numStatements := range statements {
+		total += numStatements
+		if covered[block] {
+			hit += numStatements
+		}
+	}
+	return percentage(hit, total)
+}
+
+func parseCobertura(data []byte) (float64, error) {
+	var report struct {
+		XMLName  xml.Name `xml:"coverage"`
+		LineRate *float64 `xml:"line-rate,attr"`
+	}
+	err := xml.Unmarshal(data, &report)
+	if err != nil {
+		return 0, err
+	}
+	if report.LineRate == nil {
+		return 0, errNoCoverageData
+	}
+	return *report.LineRate * 100, nil
+}
+
+func parseLCOV(data []byte) (float64, error) {
+	var found, hit int
+	var sawTotals bool
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		key, value, _ := strings.Cut(strings.TrimSpace(scanner.Text()), ":")
+		if key != "LF" && key != "LH" {
+			continue
+		}
+		count, err := strconv.Atoi(value)
+		if err != nil {
+			return 0, fmt.Errorf("invalid LCOV line %s:%s", key, value)
+		}
+		sawTotals = true
+		if key == "LF" {
+			found += count
+		} else {
+			hit += count
+		}
+	}
+	if !sawTotals {
+		return 0, errNoCoverageData
+	}
+	return percentage(hit, found)
+}
+
+func percentage(hit int, total int) (float64, error) {
+	if total == 0 {
+		return 0, errNoCoverageData
+	}
+	return float64(hit) * 100 / float64(total), nil
+}
+
+/*
+CoverageDelta returns the change in coverage since the last recorded build of the same job and branch
+*/
+func (buildInfo *BuildInfo) CoverageDelta() (float64, bool) {
+	if buildInfo.Coverage == nil {
+		return 0, false
+	}
+	previous := buildInfo.History.Last(buildInfo.JobName, buildInfo.BranchName, func(record BuildRecord) bool {
+		return record.Coverage != nil
+	})
+	if previous == nil {
+		return 0, false
+	}
+	return *buildInfo.Coverage - *previous.Coverage, true
+}
+
+/*
+CoverageDropped reports whether coverage dropped by more than CoverageDropThreshold percentage points
+*/
+func (buildInfo *BuildInfo) CoverageDropped() bool {
+	delta, ok := buildInfo.CoverageDelta()
+	return ok && -delta > buildInfo.CoverageDropThreshold
+}
+
+func (buildInfo *BuildInfo) coverageText() string {
+	if buildInfo.Coverage == nil {
+		return ""
+	}
+	text := fmt.Sprintf("%.1f%%", *buildInfo.Coverage)
+	delta, ok := buildInfo.CoverageDelta()
+	if ok {
+		text += fmt.Sprintf(" (%+.1f pp)", delta)
+	}
+	if buildInfo.CoverageDropped() {
+		text += " :warning:"
+	}
+	return text
+}
+
+func appendCoverageField(attachmentFields *[]slack.AttachmentField, buildInfo BuildInfo) {
+	appendAttachmentField(attachmentFields, coverageFieldTitle, buildInfo.coverageText())
+}
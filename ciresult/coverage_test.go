@@ -0,0 +1,123 @@
+/*
+ * Copyright (c) 2021, salesforce.com, inc.
+ * All rights reserved.
+ * SPDX-License-Identifier: BSD-3-Clause
+ * For full license text, see the LICENSE file in the repo root or https://opensource.org/licenses/BSD-3-Clause
+ */
+package ciresult
+
+import (
+	"github.com/slack-go/slack"
+	"math"
+	"reflect"
+	"testing"
+)
+
+func floatPtr(value float64) *float64 {
+	return &value
+}
+
+func Test_LoadCoverage(t *testing.T) {
+	tests := []struct {
+		name    string
+		report  string
+		want    *float64
+		wantErr bool
+	}{
+		{"no report configured", "", nil, false},
+		{"go coverprofile", "testdata/coverage/coverage.out", floatPtr(80), false},
+		{"cobertura", "testdata/coverage/cobertura.xml", floatPtr(75.5), false},
+		{"lcov", "testdata/coverage/lcov.info", floatPtr(45), false},
+		{"invalid coverprofile", "testdata/coverage/invalid.out", nil, true},
+		{"lcov without totals", "testdata/coverage/empty.info", nil, true},
+		{"not a coverage report", "testdata/junit/report-a.xml", nil, true},
+		{"missing report", "testdata/coverage/missing.out", nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			buildInfo := BuildInfo{CoverageReport: tt.report}
+			err := buildInfo.LoadCoverage()
+			if (err != nil) != tt.wantErr {
+				t.Errorf("LoadCoverage() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if (buildInfo.Coverage == nil) != (tt.want == nil) {
+				t.Fatalf("LoadCoverage() Coverage = %v, want %v", buildInfo.Coverage, tt.want)
+			}
+			if tt.want != nil && math.Abs(*buildInfo.Coverage-*tt.want) > 0.0001 {
+				t.Errorf("LoadCoverage() Coverage = %v, want %v", *buildInfo.Coverage, *tt.want)
+			}
+		})
+	}
+}
+
+func Test_coverageFieldAndColor(t *testing.T) {
+	history := &History{Records: []BuildRecord{
+		{JobName: jobName, BranchName: "main", BuildStatus: successKey, Coverage: floatPtr(80)},
+		{JobName: jobName, BranchName: "main", BuildStatus: successKey},
+		{JobName: jobName, BranchName: "other", BuildStatus: successKey, Coverage: floatPtr(50)},
+		{JobName: "other job", BranchName: "main", BuildStatus: successKey, Coverage: floatPtr(50)},
+	}}
+	tests := []struct {
+		name      string
+		buildInfo BuildInfo
+		status    Status
+		wantField []slack.AttachmentField
+		wantColor string
+	}{
+		{
+			"no coverage",
+			BuildInfo{JobName: jobName, BranchName: "main", History: history},
+			successStatus,
+			emptyAttachmentFields,
+			successStatus.color,
+		},
+		{
+			"coverage without history",
+			BuildInfo{JobName: jobName, BranchName: "main", Coverage: floatPtr(75.25)},
+			successStatus,
+			[]slack.AttachmentField{getAttachmentField(coverageFieldTitle, "75.2%")},
+			successStatus.color,
+		},
+		{
+			"coverage increased",
+			BuildInfo{JobName: jobName, BranchName: "main", Coverage: floatPtr(81.5), History: history},
+			successStatus,
+			[]slack.AttachmentField{getAttachmentField(coverageFieldTitle, "81.5% (+1.5 pp)")},
+			successStatus.color,
+		},
+		{
+			"coverage dropped within threshold",
+			BuildInfo{JobName: jobName, BranchName: "main", Coverage: floatPtr(79.5), CoverageDropThreshold: 1, History: history},
+			successStatus,
+			[]slack.AttachmentField{getAttachmentField(coverageFieldTitle, "79.5% (-0.5 pp)")},
+			successStatus.color,
+		},
+		{
+			"coverage dropped beyond threshold flags successful build",
+			BuildInfo{JobName: jobName, BranchName: "main", Coverage: floatPtr(77), CoverageDropThreshold: 1, History: history},
+			fixedStatus,
+			[]slack.AttachmentField{getAttachmentField(coverageFieldTitle, "77.0% (-3.0 pp) :warning:")},
+			unstableStatus.color,
+		},
+		{
+			"coverage dropped beyond threshold keeps failure color",
+			BuildInfo{JobName: jobName, BranchName: "main", Coverage: floatPtr(77), CoverageDropThreshold: 1, History: history},
+			failedStatus,
+			[]slack.AttachmentField{getAttachmentField(coverageFieldTitle, "77.0% (-3.0 pp) :warning:")},
+			failedStatus.color,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []slack.AttachmentField
+			appendCoverageField(&got, tt.buildInfo)
+			if !reflect.DeepEqual(got, tt.wantField) {
+				t.Errorf("appendCoverageField() = %v, want %v", got, tt.wantField)
+			}
+			if color := getAttachmentColor(tt.buildInfo, tt.status); color != tt.wantColor {
+				t.Errorf("getAttachmentColor() = %v, want %v", color, tt.wantColor)
+			}
+		})
+	}
+}
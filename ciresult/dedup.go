@@ -0,0 +1,107 @@
+/*
+ * Copyright (c) 2021, salesforce.com, inc.
+ * All rights reserved.
+ * SPDX-License-Identifier: BSD-3-Clause
+ * For full license text, see the LICENSE file in the repo root or https://opensource.org/licenses/BSD-3-Clause
+ */
+package ciresult
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+/*
+DedupAction is what happens to a notification repeating one posted within DedupWindow
+*/
+type DedupAction string
+
+const (
+	// DedupSkip skips posting the repeated notification
+	DedupSkip DedupAction = "skip"
+	// DedupReply posts a short re-run reply in the thread of the original message instead
+	DedupReply DedupAction = "reply"
+)
+
+var (
+	DedupConfigErrorMessage = "please specify HISTORY_FILE to deduplicate notifications"
+
+	rerunReplyTemplate = "Re-run ended with the same status: %s"
+)
+
+// postedMessage receives the timestamp of the message posted via the app so it can be recorded in the history
+type postedMessage struct {
+	timestamp string
+}
+
+/*
+ValidateDedup returns an error if DedupAction is invalid, or notifications would be deduplicated without a history
+file
+*/
+func (buildInfo *BuildInfo) ValidateDedup() error {
+	if buildInfo.DedupWindow <= 0 {
+		return nil
+	}
+	action := buildInfo.dedupAction()
+	if action != DedupSkip && action != DedupReply {
+		return fmt.Errorf("invalid DEDUP_ACTION %q, expected %s or %s", buildInfo.DedupAction, DedupSkip, DedupReply)
+	}
+	if buildInfo.HistoryFile == "" {
+		return errors.New(DedupConfigErrorMessage)
+	}
+	return nil
+}
+
+func (buildInfo *BuildInfo) dedupAction() DedupAction {
+	return DedupAction(strings.ToLower(strings.TrimSpace(buildInfo.DedupAction)))
+}
+
+/*
+DuplicateOf returns the record of the notification posted for the build's job, branch, commit and status within
+DedupWindow before now, or nil if there isn't one. Builds without a commit are never duplicates.
+*/
+func (buildInfo *BuildInfo) DuplicateOf(now time.Time) *BuildRecord {
+	if buildInfo.DedupWindow <= 0 || buildInfo.GitCommit == "" {
+		return nil
+	}
+	return buildInfo.History.Last(buildInfo.JobName, buildInfo.BranchName, func(record BuildRecord) bool {
+		return record.Posted && record.GitCommit == buildInfo.GitCommit && record.BuildStatus == buildInfo.BuildStatus &&
+			now.Sub(record.Timestamp) < buildInfo.DedupWindow
+	})
+}
+
+/*
+deliverDuplicate replies in the thread of the duplicate's message when DedupAction asks for it and the message was
+posted via the app, and skips posting otherwise. The reply goes through the Pipeline's Middleware, so it's filtered,
+redacted and retried like any other delivery. It reports whether the reply was posted.
+*/
+func (client *SlackClient) deliverDuplicate(ctx context.Context, buildInfo *BuildInfo, duplicate *BuildRecord) (bool, error) {
+	if buildInfo.dedupAction() != DedupReply || buildInfo.OauthToken == "" || duplicate.Channel == "" || duplicate.MessageTs == "" {
+		recordHistory(buildInfo)
+		return false, nil
+	}
+	reply := NewNotifier("Slack", func(ctx context.Context, buildInfo BuildInfo) error {
+		return client.postThreadReply(ctx, buildInfo, duplicate.Channel, duplicate.MessageTs, buildInfo.rerunReplyText())
+	})
+	err := client.Pipeline.notify(ctx, reply, *buildInfo)
+	if errors.Is(err, ErrFiltered) {
+		recordHistory(buildInfo)
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	recordHistory(buildInfo)
+	return true, nil
+}
+
+func (buildInfo *BuildInfo) rerunReplyText() string {
+	status := buildInfo.GetContextualStatus().text
+	if buildInfo.BuildURL != "" {
+		status = slackLink(buildInfo.BuildURL, status)
+	}
+	return buildInfo.Redact(fmt.Sprintf(rerunReplyTemplate, status))
+}
@@ -0,0 +1,221 @@
+/*
+ * Copyright (c) 2021, salesforce.com, inc.
+ * All rights reserved.
+ * SPDX-License-Identifier: BSD-3-Clause
+ * For full license text, see the LICENSE file in the repo root or https://opensource.org/licenses/BSD-3-Clause
+ */
+package ciresult
+
+import (
+	"context"
+	"github.com/salesforce/ci-result-to-slack/ciresult/slacktest"
+	"net/http"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+)
+
+func Test_ValidateDedup(t *testing.T) {
+	tests := []struct {
+		name    string
+		window  time.Duration
+		action  string
+		history string
+		wantErr string
+	}{
+		{"disabled", 0, "nonsense", "", ""},
+		{"skip", time.Hour, "skip", "history.json", ""},
+		{"reply", time.Hour, " Reply ", "history.json", ""},
+		{"invalid action", time.Hour, "ignore", "history.json", `invalid DEDUP_ACTION "ignore"`},
+		{"without history", time.Hour, "skip", "", DedupConfigErrorMessage},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			buildInfo := BuildInfo{DedupWindow: tt.window, DedupAction: tt.action, HistoryFile: tt.history}
+			err := buildInfo.ValidateDedup()
+			if tt.wantErr == "" && err != nil || tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)) {
+				t.Errorf("ValidateDedup() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func Test_DuplicateOf(t *testing.T) {
+	now := time.Date(2024, 3, 4, 12, 0, 0, 0, time.UTC)
+	posted := BuildRecord{JobName: jobName, BranchName: "main", BuildStatus: failureKey, GitCommit: commit, Timestamp: now.Add(-time.Hour), Posted: true, MessageTs: "1.0"}
+	tests := []struct {
+		name   string
+		record BuildRecord
+		update func(buildInfo *BuildInfo)
+		want   bool
+	}{
+		{"same build within the window", posted, func(*BuildInfo) {}, true},
+		{"outside the window", posted, func(buildInfo *BuildInfo) { buildInfo.DedupWindow = time.Hour }, false},
+		{"disabled", posted, func(buildInfo *BuildInfo) { buildInfo.DedupWindow = 0 }, false},
+		{"other status", posted, func(buildInfo *BuildInfo) { buildInfo.BuildStatus = successKey }, false},
+		{"other commit", posted, func(buildInfo *BuildInfo) { buildInfo.GitCommit = "abc" }, false},
+		{"other branch", posted, func(buildInfo *BuildInfo) { buildInfo.BranchName = "dev" }, false},
+		{"no commit", posted, func(buildInfo *BuildInfo) { buildInfo.GitCommit = "" }, false},
+		{"not posted", BuildRecord{JobName: jobName, BranchName: "main", BuildStatus: failureKey, GitCommit: commit, Timestamp: now.Add(-time.Hour)}, func(*BuildInfo) {}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			buildInfo := BuildInfo{
+				JobName:     jobName,
+				BranchName:  "main",
+				BuildStatus: failureKey,
+				GitCommit:   commit,
+				DedupWindow: 2 * time.Hour,
+				History:     &History{Records: []BuildRecord{tt.record}},
+			}
+			tt.update(&buildInfo)
+			got := buildInfo.DuplicateOf(now)
+			if tt.want && (got == nil || !reflect.DeepEqual(*got, tt.record)) || !tt.want && got != nil {
+				t.Errorf("DuplicateOf() = %+v, want duplicate %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_DeliverDuplicates(t *testing.T) {
+	tests := []struct {
+		name        string
+		action      string
+		webhook     bool
+		wantPosted  bool
+		wantReplies int
+	}{
+		{"skip", "skip", false, false, 0},
+		{"reply", "reply", false, true, 1},
+		{"reply without a thread to reply to", "reply", true, false, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := slacktest.NewServer()
+			defer server.Close()
+			buildInfo := NewBuildInfo("job", "https://ci/1", failureKey)
+			buildInfo.HistoryFile = filepath.Join(t.TempDir(), "history.json")
+			buildInfo.GitCommit = commit
+			buildInfo.DedupWindow = time.Hour
+			buildInfo.DedupAction = tt.action
+			if tt.webhook {
+				buildInfo.HookURL = server.WebhookURL()
+			} else {
+				buildInfo.OauthToken = "xoxb-token"
+				buildInfo.DestChannelId = "C12345"
+				buildInfo.SlackApiUrl = server.APIURL()
+			}
+			client := NewSlackClient()
+
+			for i, wantPosted := range []bool{true, tt.wantPosted} {
+				posted, err := client.deliverAt(context.Background(), buildInfo, time.Now())
+				if err != nil {
+					t.Fatalf("deliverAt() unexpected error: %v", err)
+				}
+				if posted != wantPosted {
+					t.Errorf("deliverAt() of build %d posted = %v, want %v", i+1, posted, wantPosted)
+				}
+			}
+
+			history, err := LoadHistory(buildInfo.HistoryFile)
+			if err != nil {
+				t.Fatalf("LoadHistory() unexpected error: %v", err)
+			}
+			if len(history.Records) != 2 || !history.Records[0].Posted || history.Records[1].Posted {
+				t.Fatalf("deliverAt() recorded %+v, want the first build posted and the second not", history.Records)
+			}
+			if !tt.webhook && history.Records[0].MessageTs != "1700000001.000000" {
+				t.Errorf("deliverAt() recorded message ts %q, want the posted message's", history.Records[0].MessageTs)
+			}
+			if got := len(server.Requests(slacktest.PostMessage)) + len(server.Requests(slacktest.Webhook)); got != 1+tt.wantReplies {
+				t.Fatalf("deliverAt() sent %d messages, want %d", got, 1+tt.wantReplies)
+			}
+			if tt.wantReplies > 0 {
+				reply := server.Requests(slacktest.PostMessage)[1]
+				if reply.Form.Get("channel") != "C12345" || reply.Form.Get("thread_ts") != "1700000001.000000" {
+					t.Errorf("re-run reply posted to %v, want the original message's thread", reply.Form)
+				}
+				if got, want := reply.Form.Get("text"), "Re-run ended with the same status: <https://ci/1|Failed>"; got != want {
+					t.Errorf("re-run reply text = %q, want %q", got, want)
+				}
+			}
+		})
+	}
+}
+
+func Test_DeliverDuplicateReplyUsesMiddleware(t *testing.T) {
+	tests := []struct {
+		name        string
+		middleware  Middleware
+		failures    int
+		wantPosted  bool
+		wantReplies int
+		wantText    string
+	}{
+		{"filtered", Filter(func(buildInfo BuildInfo) bool { return false }), 0, false, 0, ""},
+		{"redacted", Redact(regexp.MustCompile(`ci/1`)), 0, true, 1, "Re-run ended with the same status: <https://" + redactedText + "|Failed>"},
+		{"retried", Retry(2, 0), 1, true, 2, "Re-run ended with the same status: <https://ci/1|Failed>"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := slacktest.NewServer()
+			defer server.Close()
+			buildInfo := NewBuildInfo("job", "https://ci/1", failureKey)
+			buildInfo.HistoryFile = filepath.Join(t.TempDir(), "history.json")
+			buildInfo.GitCommit = commit
+			buildInfo.DedupWindow = time.Hour
+			buildInfo.DedupAction = "reply"
+			buildInfo.OauthToken = "xoxb-token"
+			buildInfo.DestChannelId = "C12345"
+			buildInfo.SlackApiUrl = server.APIURL()
+			client := NewSlackClient()
+			if _, err := client.deliverAt(context.Background(), buildInfo, time.Now()); err != nil {
+				t.Fatalf("deliverAt() unexpected error: %v", err)
+			}
+
+			client.Pipeline.Use(tt.middleware)
+			if tt.failures > 0 {
+				server.Fail(slacktest.PostMessage, http.StatusServiceUnavailable, tt.failures)
+			}
+			posted, err := client.deliverAt(context.Background(), buildInfo, time.Now())
+			if err != nil {
+				t.Fatalf("deliverAt() unexpected error: %v", err)
+			}
+			if posted != tt.wantPosted {
+				t.Errorf("deliverAt() posted = %v, want %v", posted, tt.wantPosted)
+			}
+			replies := server.Requests(slacktest.PostMessage)[1:]
+			if len(replies) != tt.wantReplies {
+				t.Fatalf("deliverAt() sent %d reply requests, want %d", len(replies), tt.wantReplies)
+			}
+			if tt.wantReplies > 0 {
+				if got := replies[len(replies)-1].Form.Get("text"); got != tt.wantText {
+					t.Errorf("re-run reply text = %q, want %q", got, tt.wantText)
+				}
+			}
+			history, err := LoadHistory(buildInfo.HistoryFile)
+			if err != nil {
+				t.Fatalf("LoadHistory() unexpected error: %v", err)
+			}
+			if len(history.Records) != 2 || history.Records[1].Posted {
+				t.Errorf("deliverAt() recorded %+v, want the re-run recorded as not posted", history.Records)
+			}
+		})
+	}
+}
+
+func Test_DeliverDuplicateReplyFails(t *testing.T) {
+	client := newSlackClient(&testSlackClientWorker{postThreadReplyShouldError: true})
+	buildInfo := NewBuildInfo("job", "https://ci/1", failureKey)
+	buildInfo.OauthToken = "xoxb-token"
+	buildInfo.DestChannelId = "C12345"
+	buildInfo.DedupAction = "reply"
+	duplicate := &BuildRecord{Channel: "C12345", MessageTs: "1.0", Posted: true}
+	_, err := client.deliverDuplicate(context.Background(), &buildInfo, duplicate)
+	if err == nil || err.Error() != threadReplyTestErr {
+		t.Errorf("deliverDuplicate() error = %v, want %q", err, threadReplyTestErr)
+	}
+}
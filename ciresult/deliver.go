@@ -0,0 +1,85 @@
+/*
+ * Copyright (c) 2021, salesforce.com, inc.
+ * All rights reserved.
+ * SPDX-License-Identifier: BSD-3-Clause
+ * For full license text, see the LICENSE file in the repo root or https://opensource.org/licenses/BSD-3-Clause
+ */
+package ciresult
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+)
+
+/*
+Deliver loads everything the build's settings point at (test reports, stages, coverage, history and commits), posts
+it unless ShouldSkipPosting or QuietHours hold it back or it repeats a recent notification, and records it in the
+history. It reports whether the build (or a re-run reply to its duplicate) was posted to any backend, in which case
+it's recorded even when other backends failed and their errors are returned too. Failing to load or record optional
+data is logged rather than stopping the notification, but settings which fail Validate are returned as an error
+before anything is loaded or posted.
+*/
+func (client *SlackClient) Deliver(ctx context.Context, buildInfo BuildInfo) (bool, error) {
+	return client.deliverAt(ctx, buildInfo, time.Now())
+}
+
+func (client *SlackClient) deliverAt(ctx context.Context, buildInfo BuildInfo, now time.Time) (bool, error) {
+	err := buildInfo.Validate()
+	if err != nil {
+		return false, err
+	}
+	for _, loader := range []struct {
+		description string
+		load        func() error
+	}{
+		{"summarize test reports", buildInfo.LoadTestReports},
+		{"load stages", buildInfo.LoadStages},
+		{"summarize coverage", buildInfo.LoadCoverage},
+		{"load build history", buildInfo.LoadHistory},
+		{"list commits", buildInfo.LoadCommits},
+	} {
+		err = loader.load()
+		if err != nil {
+			log.Printf("unable to %s: %s", loader.description, err)
+		}
+	}
+	if buildInfo.ShouldSkipPosting() {
+		recordHistory(&buildInfo)
+		return false, nil
+	}
+	switch buildInfo.QuietAction(now) {
+	case QuietSuppress:
+		recordHistory(&buildInfo)
+		return false, nil
+	case QuietQueue:
+		buildInfo.queued = true
+		recordHistory(&buildInfo)
+		return false, nil
+	case QuietDowngrade:
+		buildInfo.silenced = true
+	}
+	if duplicate := buildInfo.DuplicateOf(now); duplicate != nil {
+		return client.deliverDuplicate(ctx, &buildInfo, duplicate)
+	}
+	buildInfo.slackMessage = &postedMessage{}
+	delivered, err := client.Pipeline.deliver(ctx, buildInfo)
+	if errors.Is(err, ErrFiltered) {
+		recordHistory(&buildInfo)
+		return false, nil
+	}
+	if delivered == 0 {
+		return false, err
+	}
+	buildInfo.posted = true
+	recordHistory(&buildInfo)
+	return true, err
+}
+
+func recordHistory(buildInfo *BuildInfo) {
+	err := buildInfo.RecordHistory()
+	if err != nil {
+		log.Printf("unable to record build history: %s", err)
+	}
+}
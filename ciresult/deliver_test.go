@@ -0,0 +1,216 @@
+/*
+ * Copyright (c) 2021, salesforce.com, inc.
+ * All rights reserved.
+ * SPDX-License-Identifier: BSD-3-Clause
+ * For full license text, see the LICENSE file in the repo root or https://opensource.org/licenses/BSD-3-Clause
+ */
+package ciresult
+
+import (
+	"context"
+	"errors"
+	"github.com/salesforce/ci-result-to-slack/ciresult/slacktest"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func Test_Deliver(t *testing.T) {
+	tests := []struct {
+		name          string
+		skipIfSuccess bool
+		client        SlackClient
+		wantPosted    bool
+		wantErr       bool
+		wantRecords   int
+	}{
+		{"posted", false, newTestClient(false, false), true, false, 1},
+		{"skipped", true, newTestClient(false, false), false, false, 1},
+		{"failed", false, newTestClient(false, true), false, true, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			historyFile := filepath.Join(t.TempDir(), "history.json")
+			buildInfo := NewBuildInfo("job", "https://ci/1", successKey)
+			buildInfo.HookURL = "https://hooks.slack.com/test"
+			buildInfo.HistoryFile = historyFile
+			buildInfo.SkipIfSuccess = tt.skipIfSuccess
+			buildInfo.JunitReports = "testdata/junit/missing-*.xml"
+
+			posted, err := tt.client.Deliver(context.Background(), buildInfo)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Deliver() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if posted != tt.wantPosted {
+				t.Errorf("Deliver() posted = %v, want %v", posted, tt.wantPosted)
+			}
+			history, err := LoadHistory(historyFile)
+			if err != nil {
+				t.Fatalf("LoadHistory() unexpected error: %v", err)
+			}
+			if len(history.Records) != tt.wantRecords {
+				t.Errorf("Deliver() recorded %v, want %d records", history.Records, tt.wantRecords)
+			}
+		})
+	}
+}
+
+func Test_DeliverRejectsInvalidSettings(t *testing.T) {
+	tests := []struct {
+		name    string
+		update  func(buildInfo *BuildInfo)
+		wantErr string
+	}{
+		{"notify rules", func(buildInfo *BuildInfo) { buildInfo.NotifyRules = "notify on: Broken" }, "invalid NOTIFY_RULES rule"},
+		{"quiet hours", func(buildInfo *BuildInfo) { buildInfo.QuietHours = "22:00" }, "invalid QUIET_HOURS window"},
+		{"redact patterns", func(buildInfo *BuildInfo) { buildInfo.RedactPatterns = "token=(" }, "invalid REDACT_PATTERNS entry"},
+		{"log match", func(buildInfo *BuildInfo) { buildInfo.LogMatch = "(" }, "LOG_MATCH"},
+		{"log match context", func(buildInfo *BuildInfo) { buildInfo.LogMatchContext = -1 }, "invalid LOG_MATCH_CONTEXT"},
+		{"failure output lines", func(buildInfo *BuildInfo) { buildInfo.FailureOutputLines = -1 }, "invalid FAILURE_OUTPUT_LINES"},
+		{"dedup action", func(buildInfo *BuildInfo) { buildInfo.DedupWindow = time.Hour; buildInfo.DedupAction = "ignore" }, "invalid DEDUP_ACTION"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := slacktest.NewServer()
+			defer server.Close()
+			historyFile := filepath.Join(t.TempDir(), "history.json")
+			buildInfo := NewBuildInfo("job", "https://ci/1", failureKey)
+			buildInfo.HookURL = server.WebhookURL()
+			buildInfo.HistoryFile = historyFile
+			tt.update(&buildInfo)
+
+			client := NewSlackClient()
+			posted, err := client.Deliver(context.Background(), buildInfo)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Deliver() error = %v, want %q", err, tt.wantErr)
+			}
+			if posted || len(server.Requests(slacktest.Webhook)) != 0 {
+				t.Errorf("Deliver() posted a build with invalid settings")
+			}
+			history, err := LoadHistory(historyFile)
+			if err != nil {
+				t.Fatalf("LoadHistory() unexpected error: %v", err)
+			}
+			if len(history.Records) != 0 {
+				t.Errorf("Deliver() recorded %v, want no records", history.Records)
+			}
+		})
+	}
+}
+
+func Test_DeliverRecordsPartialDeliveries(t *testing.T) {
+	tests := []struct {
+		name        string
+		middleware  Middleware
+		failing     bool
+		wantPosted  bool
+		wantErr     bool
+		wantRecords []bool
+	}{
+		{"another backend failed", nil, true, true, true, []bool{true}},
+		{"every backend filtered", Filter(func(buildInfo BuildInfo) bool { return false }), false, false, false, []bool{false}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			historyFile := filepath.Join(t.TempDir(), "history.json")
+			buildInfo := NewBuildInfo("job", "https://ci/1", failureKey)
+			buildInfo.HookURL = "https://hooks.slack.com/test"
+			buildInfo.HistoryFile = historyFile
+			client := newTestClient(false, false)
+			client.Registry.Register("custom", func(buildInfo BuildInfo) Notifier {
+				return NewNotifier("custom", func(ctx context.Context, buildInfo BuildInfo) error {
+					if tt.failing {
+						return errors.New("custom failed")
+					}
+					return nil
+				})
+			})
+			if tt.middleware != nil {
+				client.Use(tt.middleware)
+			}
+
+			posted, err := client.Deliver(context.Background(), buildInfo)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Deliver() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if posted != tt.wantPosted {
+				t.Errorf("Deliver() posted = %v, want %v", posted, tt.wantPosted)
+			}
+			history, err := LoadHistory(historyFile)
+			if err != nil {
+				t.Fatalf("LoadHistory() unexpected error: %v", err)
+			}
+			var got []bool
+			for _, record := range history.Records {
+				got = append(got, record.Posted)
+			}
+			if !reflect.DeepEqual(got, tt.wantRecords) {
+				t.Errorf("Deliver() recorded posted = %v, want %v", got, tt.wantRecords)
+			}
+		})
+	}
+}
+
+func Test_DeliverDuringQuietHours(t *testing.T) {
+	// 23:00 on a Monday in Berlin
+	night := time.Date(2024, 3, 4, 22, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name         string
+		action       string
+		now          time.Time
+		wantPosted   bool
+		wantTriggers string
+		wantQueued   bool
+	}{
+		{"outside quiet hours", "suppress", night.Add(-12 * time.Hour), true, "<!here> by <@U0123|alice>", false},
+		{"suppressed", "suppress", night, false, "", false},
+		{"downgraded", "downgrade", night, true, "@here by @alice", false},
+		{"queued", "queue", night, false, "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := slacktest.NewServer()
+			defer server.Close()
+			historyFile := filepath.Join(t.TempDir(), "history.json")
+			buildInfo := NewBuildInfo("job", "https://ci/1", failureKey)
+			buildInfo.HookURL = server.WebhookURL()
+			buildInfo.HistoryFile = historyFile
+			buildInfo.TriggeredBy = "<!here> by <@U0123|alice>"
+			buildInfo.QuietHours = "22:00-07:00"
+			buildInfo.QuietHoursAction = tt.action
+			buildInfo.QuietHoursTimezone = "Europe/Berlin"
+			client := NewSlackClient()
+
+			posted, err := client.deliverAt(context.Background(), buildInfo, tt.now)
+			if err != nil {
+				t.Fatalf("deliverAt() unexpected error: %v", err)
+			}
+			if posted != tt.wantPosted {
+				t.Errorf("deliverAt() posted = %v, want %v", posted, tt.wantPosted)
+			}
+			webhooks := server.Requests(slacktest.Webhook)
+			if !tt.wantPosted && len(webhooks) > 0 || tt.wantPosted && len(webhooks) != 1 {
+				t.Fatalf("deliverAt() sent %d webhooks", len(webhooks))
+			}
+			if tt.wantPosted {
+				attachments, _ := webhooks[0].Attachments()
+				if got := attachments[0].Fields[0].Value; got != tt.wantTriggers {
+					t.Errorf("deliverAt() triggered by = %q, want %q", got, tt.wantTriggers)
+				}
+			}
+			history, err := LoadHistory(historyFile)
+			if err != nil {
+				t.Fatalf("LoadHistory() unexpected error: %v", err)
+			}
+			if len(history.Records) != 1 {
+				t.Fatalf("deliverAt() recorded %v, want a single record", history.Records)
+			}
+			record := history.Records[0]
+			if record.Queued != tt.wantQueued || tt.wantQueued && record.BuildURL != "https://ci/1" {
+				t.Errorf("deliverAt() recorded %+v, want queued %v", record, tt.wantQueued)
+			}
+		})
+	}
+}
@@ -0,0 +1,260 @@
+/*
+ * Copyright (c) 2021, salesforce.com, inc.
+ * All rights reserved.
+ * SPDX-License-Identifier: BSD-3-Clause
+ * For full license text, see the LICENSE file in the repo root or https://opensource.org/licenses/BSD-3-Clause
+ */
+package ciresult
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/slack-go/slack"
+	"sort"
+	"strings"
+	"time"
+)
+
+var (
+	passRatesFieldTitle      = "Pass Rates"
+	failureStreaksFieldTitle = "Failure Streaks"
+	slowestBuildsFieldTitle  = "Slowest Builds"
+	newlyFixedFieldTitle     = "Newly Fixed"
+	queuedFieldTitle         = "Held During Quiet Hours"
+
+	DigestConfigErrorMessage = "please specify HISTORY_FILE to post a digest"
+
+	// maxDigestSlowestBuilds is the number of slowest builds listed in a digest
+	maxDigestSlowestBuilds = 3
+
+	digestTimeLayout = "Jan 2 15:04 MST"
+)
+
+/*
+Digest summarizes the builds recorded for a channel within a time window
+*/
+type Digest struct {
+	// Channel is the channel the builds were posted to, empty for builds posted via HOOK_URL
+	Channel string
+	Since   time.Time
+	Until   time.Time
+	Jobs    []JobDigest
+	// SlowestBuilds are the longest builds of every job, longest first
+	SlowestBuilds []BuildRecord
+	// Queued are the builds which weren't posted because of quiet hours, oldest first
+	Queued []BuildRecord
+}
+
+/*
+JobDigest summarizes a job's builds within a Digest
+*/
+type JobDigest struct {
+	JobName string
+	Builds  int
+	Passed  int
+	// LongestFailureStreak is the most consecutive builds which failed
+	LongestFailureStreak int
+	// NewlyFixed is set when the job's last build succeeded after it had been failing
+	NewlyFixed bool
+	// Failing is set when the job's last build failed
+	Failing bool
+}
+
+/*
+PassRate returns the percentage of the job's builds which succeeded
+*/
+func (job JobDigest) PassRate() float64 {
+	if job.Builds == 0 {
+		return 0
+	}
+	return 100 * float64(job.Passed) / float64(job.Builds)
+}
+
+/*
+Digests summarizes the records within [since, until) per channel, ordered by channel
+*/
+func (history *History) Digests(since time.Time, until time.Time) []Digest {
+	if history == nil {
+		return nil
+	}
+	digests := map[string]*Digest{}
+	jobs := map[string]map[string]*JobDigest{}
+	streaks := map[string]map[string]int{}
+	// lastFailed tracks whether each job's previous build failed, including the builds before the window
+	lastFailed := map[string]map[string]bool{}
+	for _, record := range history.Records {
+		if lastFailed[record.Channel] == nil {
+			lastFailed[record.Channel] = map[string]bool{}
+		}
+		failed := record.failed()
+		if record.Timestamp.Before(since) || !record.Timestamp.Before(until) {
+			if record.Timestamp.Before(since) {
+				lastFailed[record.Channel][record.JobName] = failed
+			}
+			continue
+		}
+		digest, present := digests[record.Channel]
+		if !present {
+			digest = &Digest{Channel: record.Channel, Since: since, Until: until}
+			digests[record.Channel] = digest
+			jobs[record.Channel] = map[string]*JobDigest{}
+			streaks[record.Channel] = map[string]int{}
+		}
+		job, present := jobs[record.Channel][record.JobName]
+		if !present {
+			job = &JobDigest{JobName: record.JobName}
+			jobs[record.Channel][record.JobName] = job
+		}
+		job.Builds++
+		if record.succeeded() {
+			job.Passed++
+		}
+		if failed {
+			streaks[record.Channel][record.JobName]++
+			job.LongestFailureStreak = max(job.LongestFailureStreak, streaks[record.Channel][record.JobName])
+		} else {
+			streaks[record.Channel][record.JobName] = 0
+		}
+		if record.succeeded() && lastFailed[record.Channel][record.JobName] {
+			job.NewlyFixed = true
+		} else if failed {
+			job.NewlyFixed = false
+		}
+		job.Failing = failed
+		lastFailed[record.Channel][record.JobName] = failed
+		if record.Duration > 0 {
+			digest.SlowestBuilds = append(digest.SlowestBuilds, record)
+		}
+		if record.Queued {
+			digest.Queued = append(digest.Queued, record)
+		}
+	}
+
+	var channels []string
+	for channel := range digests {
+		channels = append(channels, channel)
+	}
+	sort.Strings(channels)
+	var sorted []Digest
+	for _, channel := range channels {
+		digest := digests[channel]
+		for _, job := range jobs[channel] {
+			digest.Jobs = append(digest.Jobs, *job)
+		}
+		sort.Slice(digest.Jobs, func(i, j int) bool { return digest.Jobs[i].JobName < digest.Jobs[j].JobName })
+		sort.SliceStable(digest.SlowestBuilds, func(i, j int) bool {
+			return digest.SlowestBuilds[i].Duration > digest.SlowestBuilds[j].Duration
+		})
+		if len(digest.SlowestBuilds) > maxDigestSlowestBuilds {
+			digest.SlowestBuilds = digest.SlowestBuilds[:maxDigestSlowestBuilds]
+		}
+		sorted = append(sorted, *digest)
+	}
+	return sorted
+}
+
+func (record BuildRecord) failed() bool {
+	return statusMap[record.BuildStatus].color == failedStatus.color
+}
+
+/*
+RenderDigest renders the digest as the attachment posted to Slack
+*/
+func RenderDigest(digest Digest) slack.Attachment {
+	var attachmentFields []slack.AttachmentField
+	var passRates, streaks, fixed []string
+	color := successStatus.color
+	for _, job := range digest.Jobs {
+		passRates = append(passRates, fmt.Sprintf("• %s: %d/%d (%.0f%%)", mrkdwnEscaper.Replace(job.JobName), job.Passed, job.Builds, job.PassRate()))
+		if job.LongestFailureStreak > 0 {
+			streaks = append(streaks, fmt.Sprintf("• %s: %d", mrkdwnEscaper.Replace(job.JobName), job.LongestFailureStreak))
+		}
+		if job.NewlyFixed {
+			fixed = append(fixed, "• "+mrkdwnEscaper.Replace(job.JobName))
+		}
+		if job.Failing {
+			color = failedStatus.color
+		} else if job.Passed < job.Builds && color != failedStatus.color {
+			color = unstableStatus.color
+		}
+	}
+	var slowest, queued []string
+	for _, record := range digest.SlowestBuilds {
+		slowest = append(slowest, fmt.Sprintf("• %s: %s", mrkdwnEscaper.Replace(record.JobName), formatDuration(record.Duration)))
+	}
+	for _, record := range digest.Queued {
+		queued = append(queued, "• "+record.queuedText())
+	}
+	appendDigestField(&attachmentFields, passRatesFieldTitle, passRates)
+	appendDigestField(&attachmentFields, failureStreaksFieldTitle, streaks)
+	appendDigestField(&attachmentFields, slowestBuildsFieldTitle, slowest)
+	appendDigestField(&attachmentFields, newlyFixedFieldTitle, fixed)
+	appendDigestField(&attachmentFields, queuedFieldTitle, queued)
+	return slack.Attachment{
+		Title:  fmt.Sprintf("Build Digest: %s – %s", digest.Since.UTC().Format(digestTimeLayout), digest.Until.UTC().Format(digestTimeLayout)),
+		Color:  color,
+		Fields: attachmentFields,
+	}
+}
+
+func (record BuildRecord) queuedText() string {
+	status, present := statusMap[record.BuildStatus]
+	text := record.BuildStatus
+	if present {
+		text = status.text
+	}
+	text = fmt.Sprintf("%s: %s", text, record.JobName)
+	if record.BuildURL != "" {
+		text = slackLink(record.BuildURL, text)
+	} else {
+		text = mrkdwnEscaper.Replace(text)
+	}
+	return fmt.Sprintf("%s (%s)", text, record.Timestamp.UTC().Format(digestTimeLayout))
+}
+
+func appendDigestField(attachmentFields *[]slack.AttachmentField, title string, lines []string) {
+	if len(lines) > 0 {
+		*attachmentFields = append(*attachmentFields, getLongAttachmentField(title, strings.Join(lines, "\n")))
+	}
+}
+
+/*
+PostDigests posts a digest of the builds recorded in HistoryFile during the DigestWindow before now to every channel
+they were posted to, or only to DestChannelId when it's set. Builds posted via incoming webhooks are summarized to
+HookURL. It returns the digests posted, or an error before posting anything if the settings fail Validate.
+*/
+func (client *SlackClient) PostDigests(ctx context.Context, buildInfo BuildInfo, now time.Time) ([]Digest, error) {
+	if buildInfo.HistoryFile == "" {
+		return nil, errors.New(DigestConfigErrorMessage)
+	}
+	err := buildInfo.Validate()
+	if err != nil {
+		return nil, err
+	}
+	history, err := LoadHistory(buildInfo.HistoryFile)
+	if err != nil {
+		return nil, err
+	}
+	var posted []Digest
+	var errs []error
+	for _, digest := range history.Digests(now.Add(-buildInfo.DigestWindow), now) {
+		if buildInfo.DestChannelId != "" && digest.Channel != buildInfo.DestChannelId {
+			continue
+		}
+		err = client.postAttachment(ctx, buildInfo, digest.Channel, buildInfo.redactAttachment(RenderDigest(digest)))
+		if err != nil {
+			errs = append(errs, fmt.Errorf("unable to post digest to %s: %w", digestDestination(digest), err))
+			continue
+		}
+		posted = append(posted, digest)
+	}
+	return posted, errors.Join(errs...)
+}
+
+func digestDestination(digest Digest) string {
+	if digest.Channel == "" {
+		return "webhook"
+	}
+	return digest.Channel
+}
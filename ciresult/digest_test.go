@@ -0,0 +1,261 @@
+/*
+ * Copyright (c) 2021, salesforce.com, inc.
+ * All rights reserved.
+ * SPDX-License-Identifier: BSD-3-Clause
+ * For full license text, see the LICENSE file in the repo root or https://opensource.org/licenses/BSD-3-Clause
+ */
+package ciresult
+
+import (
+	"context"
+	"errors"
+	"github.com/salesforce/ci-result-to-slack/ciresult/slacktest"
+	"github.com/slack-go/slack"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+var digestNow = time.Date(2024, 3, 2, 9, 0, 0, 0, time.UTC)
+
+func digestRecord(jobName string, channel string, buildStatus string, hoursAgo int, duration time.Duration) BuildRecord {
+	return BuildRecord{
+		JobName:     jobName,
+		Channel:     channel,
+		BuildStatus: buildStatus,
+		Duration:    duration,
+		Timestamp:   digestNow.Add(-time.Duration(hoursAgo) * time.Hour),
+	}
+}
+
+var queuedRecord = BuildRecord{JobName: "lint", BuildStatus: failureKey, BuildURL: "https://ci/5", Timestamp: digestNow.Add(-5 * time.Hour), Queued: true}
+
+func digestHistory() *History {
+	return &History{Records: []BuildRecord{
+		digestRecord("deploy", "C1", failureKey, 30, time.Minute),
+		digestRecord("deploy", "C1", successKey, 20, 2*time.Minute),
+		digestRecord("nightly", "C1", successKey, 19, 10*time.Minute),
+		digestRecord("nightly", "C1", failureKey, 18, 11*time.Minute),
+		digestRecord("nightly", "C1", failureKey, 17, 12*time.Minute),
+		digestRecord("nightly", "C1", unstableKey, 16, 0),
+		digestRecord("nightly", "C1", failureKey, 15, 9*time.Minute),
+		digestRecord("lint", "", successKey, 10, 30*time.Second),
+		queuedRecord,
+		digestRecord("lint", "", successKey, 1, 20*time.Second),
+		digestRecord("deploy", "C2", successKey, 2, 0),
+		digestRecord("deploy", "C1", failureKey, 0, time.Minute),
+	}}
+}
+
+func Test_Digests(t *testing.T) {
+	since := digestNow.Add(-24 * time.Hour)
+	got := digestHistory().Digests(since, digestNow)
+	want := []Digest{
+		{
+			Since: since,
+			Until: digestNow,
+			Jobs:  []JobDigest{{JobName: "lint", Builds: 3, Passed: 2, LongestFailureStreak: 1, NewlyFixed: true}},
+			SlowestBuilds: []BuildRecord{
+				digestRecord("lint", "", successKey, 10, 30*time.Second),
+				digestRecord("lint", "", successKey, 1, 20*time.Second),
+			},
+			Queued: []BuildRecord{queuedRecord},
+		},
+		{
+			Channel: "C1",
+			Since:   since,
+			Until:   digestNow,
+			Jobs: []JobDigest{
+				{JobName: "deploy", Builds: 1, Passed: 1, NewlyFixed: true},
+				{JobName: "nightly", Builds: 5, Passed: 1, LongestFailureStreak: 2, Failing: true},
+			},
+			SlowestBuilds: []BuildRecord{
+				digestRecord("nightly", "C1", failureKey, 17, 12*time.Minute),
+				digestRecord("nightly", "C1", failureKey, 18, 11*time.Minute),
+				digestRecord("nightly", "C1", successKey, 19, 10*time.Minute),
+			},
+		},
+		{
+			Channel: "C2",
+			Since:   since,
+			Until:   digestNow,
+			Jobs:    []JobDigest{{JobName: "deploy", Builds: 1, Passed: 1}},
+		},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Digests() = %+v, want %+v", got, want)
+	}
+	if got := (*History)(nil).Digests(since, digestNow); got != nil {
+		t.Errorf("Digests() of no history = %v, want nil", got)
+	}
+}
+
+func Test_RenderDigest(t *testing.T) {
+	since := digestNow.Add(-24 * time.Hour)
+	tests := []struct {
+		name   string
+		digest Digest
+		want   slack.Attachment
+	}{
+		{
+			"failing job",
+			digestHistory().Digests(since, digestNow)[1],
+			slack.Attachment{
+				Title: "Build Digest: Mar 1 09:00 UTC – Mar 2 09:00 UTC",
+				Color: failedStatus.color,
+				Fields: []slack.AttachmentField{
+					getLongAttachmentField(passRatesFieldTitle, "• deploy: 1/1 (100%)\n• nightly: 1/5 (20%)"),
+					getLongAttachmentField(failureStreaksFieldTitle, "• nightly: 2"),
+					getLongAttachmentField(slowestBuildsFieldTitle, "• nightly: 12m 0s\n• nightly: 11m 0s\n• nightly: 10m 0s"),
+					getLongAttachmentField(newlyFixedFieldTitle, "• deploy"),
+				},
+			},
+		},
+		{
+			"recovered job",
+			Digest{Since: since, Until: digestNow, Jobs: []JobDigest{{JobName: "a<b>", Builds: 3, Passed: 2, LongestFailureStreak: 1}}},
+			slack.Attachment{
+				Title: "Build Digest: Mar 1 09:00 UTC – Mar 2 09:00 UTC",
+				Color: unstableStatus.color,
+				Fields: []slack.AttachmentField{
+					getLongAttachmentField(passRatesFieldTitle, "• a&lt;b&gt;: 2/3 (67%)"),
+					getLongAttachmentField(failureStreaksFieldTitle, "• a&lt;b&gt;: 1"),
+				},
+			},
+		},
+		{
+			"queued builds",
+			Digest{
+				Since: since,
+				Until: digestNow,
+				Jobs:  []JobDigest{{JobName: "nightly", Builds: 2, Passed: 1, LongestFailureStreak: 1, Failing: true}},
+				Queued: []BuildRecord{
+					{JobName: "nightly", BuildStatus: failureKey, BuildURL: "https://ci/7", Timestamp: since.Add(14 * time.Hour), Queued: true},
+					{JobName: "a&b", BuildStatus: "ABORTED", Timestamp: since.Add(15 * time.Hour), Queued: true},
+				},
+			},
+			slack.Attachment{
+				Title: "Build Digest: Mar 1 09:00 UTC – Mar 2 09:00 UTC",
+				Color: failedStatus.color,
+				Fields: []slack.AttachmentField{
+					getLongAttachmentField(passRatesFieldTitle, "• nightly: 1/2 (50%)"),
+					getLongAttachmentField(failureStreaksFieldTitle, "• nightly: 1"),
+					getLongAttachmentField(queuedFieldTitle, "• <https://ci/7|Failed: nightly> (Mar 1 23:00 UTC)\n• ABORTED: a&amp;b (Mar 2 00:00 UTC)"),
+				},
+			},
+		},
+		{
+			"all passed",
+			Digest{Since: since, Until: digestNow, Jobs: []JobDigest{{JobName: "lint", Builds: 2, Passed: 2}}},
+			slack.Attachment{
+				Title:  "Build Digest: Mar 1 09:00 UTC – Mar 2 09:00 UTC",
+				Color:  successStatus.color,
+				Fields: []slack.AttachmentField{getLongAttachmentField(passRatesFieldTitle, "• lint: 2/2 (100%)")},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := RenderDigest(tt.digest); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("RenderDigest() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_PostDigests(t *testing.T) {
+	historyFile := filepath.Join(t.TempDir(), "history.json")
+	history := digestHistory()
+	history.path = historyFile
+	if err := history.Save(0); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name         string
+		channel      string
+		hookURL      bool
+		wantChannels []string
+		wantWebhooks int
+		wantErr      string
+	}{
+		{"every channel", "", true, []string{"C1", "C2"}, 1, ""},
+		{"one channel", "C2", true, []string{"C2"}, 0, ""},
+		{"webhook builds without HOOK_URL", "", false, []string{"C1", "C2"}, 0, "unable to post digest to webhook: " + PickRunModeErrorMessage},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := slacktest.NewServer()
+			defer server.Close()
+			buildInfo := NewBuildInfo("digest", "", unknownKey)
+			buildInfo.HistoryFile = historyFile
+			buildInfo.OauthToken = "xoxb-token"
+			buildInfo.DestChannelId = tt.channel
+			buildInfo.SlackApiUrl = server.APIURL()
+			if tt.hookURL {
+				buildInfo.HookURL = server.WebhookURL()
+			}
+			client := NewSlackClient()
+			posted, err := client.PostDigests(context.Background(), buildInfo, digestNow)
+			if tt.wantErr == "" && err != nil || tt.wantErr != "" && (err == nil || err.Error() != tt.wantErr) {
+				t.Errorf("PostDigests() error = %v, want %q", err, tt.wantErr)
+			}
+			var channels []string
+			for _, request := range server.Requests(slacktest.PostMessage) {
+				channels = append(channels, request.Form.Get("channel"))
+				attachments, _ := request.Attachments()
+				if len(attachments) != 1 || !strings.HasPrefix(attachments[0].Title, "Build Digest:") {
+					t.Errorf("expected a digest, got %+v", attachments)
+				}
+			}
+			if !reflect.DeepEqual(channels, tt.wantChannels) {
+				t.Errorf("PostDigests() posted to %v, want %v", channels, tt.wantChannels)
+			}
+			if got := len(server.Requests(slacktest.Webhook)); got != tt.wantWebhooks {
+				t.Errorf("PostDigests() posted %d webhooks, want %d", got, tt.wantWebhooks)
+			}
+			if len(posted) != len(tt.wantChannels)+tt.wantWebhooks {
+				t.Errorf("PostDigests() returned %d digests, want %d", len(posted), len(tt.wantChannels)+tt.wantWebhooks)
+			}
+		})
+	}
+
+	client := NewSlackClient()
+	_, err := client.PostDigests(context.Background(), NewBuildInfo("digest", "", unknownKey), digestNow)
+	if err == nil || err.Error() != DigestConfigErrorMessage {
+		t.Errorf("PostDigests() error = %v, want %q", err, DigestConfigErrorMessage)
+	}
+}
+
+func Test_PostDigestsKeepsContextErrors(t *testing.T) {
+	historyFile := filepath.Join(t.TempDir(), "history.json")
+	history := digestHistory()
+	history.path = historyFile
+	if err := history.Save(0); err != nil {
+		t.Fatal(err)
+	}
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-release:
+		}
+	}))
+	defer server.Close()
+	defer close(release)
+	buildInfo := NewBuildInfo("digest", "", unknownKey)
+	buildInfo.HistoryFile = historyFile
+	buildInfo.OauthToken = "xoxb-token"
+	buildInfo.SlackApiUrl = server.URL
+	buildInfo.HookURL = server.URL
+	client := NewSlackClient()
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	_, err := client.PostDigests(ctx, buildInfo, digestNow)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("PostDigests() error = %v, want it to wrap context.DeadlineExceeded", err)
+	}
+}
@@ -0,0 +1,86 @@
+/*
+ * Copyright (c) 2021, salesforce.com, inc.
+ * All rights reserved.
+ * SPDX-License-Identifier: BSD-3-Clause
+ * For full license text, see the LICENSE file in the repo root or https://opensource.org/licenses/BSD-3-Clause
+ */
+package ciresult
+
+import (
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// Discord rejects embeds exceeding these limits
+const (
+	maxDiscordTitleLength      = 256
+	maxDiscordFieldNameLength  = 256
+	maxDiscordFieldValueLength = 1024
+	maxDiscordFields           = 25
+	maxDiscordEmbedLength      = 6000
+)
+
+/*
+DiscordMessage represents a Discord webhook payload carrying a single embed
+*/
+type DiscordMessage struct {
+	Embeds []DiscordEmbed `json:"embeds"`
+}
+
+/*
+DiscordEmbed represents the Discord equivalent of a Slack attachment
+*/
+type DiscordEmbed struct {
+	Title  string              `json:"title"`
+	URL    string              `json:"url,omitempty"`
+	Color  int                 `json:"color"`
+	Fields []DiscordEmbedField `json:"fields,omitempty"`
+}
+
+/*
+DiscordEmbedField represents a single field of a DiscordEmbed
+*/
+type DiscordEmbedField struct {
+	Name   string `json:"name"`
+	Value  string `json:"value"`
+	Inline bool   `json:"inline"`
+}
+
+/*
+getDiscordMessage renders the same attachment sent to Slack as a Discord embed
+*/
+func getDiscordMessage(buildInfo BuildInfo, buildStatus Status) DiscordMessage {
+	attachment := getAttachment(buildInfo, buildStatus)
+	embed := DiscordEmbed{
+		Title: truncate(attachment.Title, maxDiscordTitleLength),
+		URL:   attachment.TitleLink,
+		Color: discordColor(attachment.Color),
+	}
+	// The title, field names and values together can't exceed maxDiscordEmbedLength, so the field reaching it is
+	// shortened and the fields after it are dropped
+	length := utf8.RuneCountInString(embed.Title)
+	for _, field := range attachment.Fields {
+		if len(embed.Fields) == maxDiscordFields {
+			break
+		}
+		name := truncate(field.Title, maxDiscordFieldNameLength)
+		remaining := maxDiscordEmbedLength - length - utf8.RuneCountInString(name)
+		if remaining < 1 {
+			break
+		}
+		value := truncate(truncate(slackToMarkdown(field.Value), maxDiscordFieldValueLength), remaining)
+		embed.Fields = append(embed.Fields, DiscordEmbedField{Name: name, Value: value, Inline: field.Short})
+		length += utf8.RuneCountInString(name) + utf8.RuneCountInString(value)
+	}
+	return DiscordMessage{Embeds: []DiscordEmbed{embed}}
+}
+
+// discordColor converts an attachment color to the integer Discord expects
+func discordColor(color string) int {
+	value, err := strconv.ParseInt(strings.TrimPrefix(attachmentColorHex(color), "#"), 16, 32)
+	if err != nil {
+		return 0
+	}
+	return int(value)
+}
@@ -0,0 +1,139 @@
+/*
+ * Copyright (c) 2021, salesforce.com, inc.
+ * All rights reserved.
+ * SPDX-License-Identifier: BSD-3-Clause
+ * For full license text, see the LICENSE file in the repo root or https://opensource.org/licenses/BSD-3-Clause
+ */
+package ciresult
+
+import (
+	"context"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func Test_getDiscordMessage(t *testing.T) {
+	tests := []struct {
+		name        string
+		buildInfo   BuildInfo
+		buildStatus Status
+		want        DiscordMessage
+	}{
+		{
+			"required fields only",
+			BuildInfo{JobName: jobName, BuildURL: buildURL, BuildStatus: successKey},
+			successStatus,
+			DiscordMessage{Embeds: []DiscordEmbed{{Title: "Success: " + jobName, URL: buildURL, Color: 0x2EB886}}},
+		},
+		{
+			"short and long fields",
+			BuildInfo{
+				JobName:     jobName,
+				BuildStatus: failureKey,
+				BranchName:  branchName,
+				Stages:      []Stage{{Name: "Build & Test", Status: failureKey}},
+				PrNumber:    "7",
+				PrUrl:       "https://example.com/pr/7",
+			},
+			failedStatus,
+			DiscordMessage{Embeds: []DiscordEmbed{{
+				Title: "Failed: " + jobName,
+				Color: 0xA30200,
+				Fields: []DiscordEmbedField{
+					{Name: branchFieldTitle, Value: branchName, Inline: true},
+					{Name: pullRequestFieldTitle, Value: "[#7](https://example.com/pr/7)"},
+					{Name: stagesFieldTitle, Value: "❌ Build & Test"},
+				},
+			}}},
+		},
+		{
+			"unknown status",
+			BuildInfo{JobName: jobName, BuildStatus: "weird"},
+			unknownStatus,
+			DiscordMessage{Embeds: []DiscordEmbed{{Title: "Unknown: " + jobName, Color: 0xDAA038}}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := getDiscordMessage(tt.buildInfo, tt.buildStatus); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("getDiscordMessage() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_getDiscordMessageLimits(t *testing.T) {
+	var stages []Stage
+	for i := 0; i < 200; i++ {
+		stages = append(stages, Stage{Name: strings.Repeat("x", 20), Status: successKey})
+	}
+	buildInfo := BuildInfo{JobName: strings.Repeat("j", 300), BuildStatus: successKey, Stages: stages}
+	embed := getDiscordMessage(buildInfo, successStatus).Embeds[0]
+	if utf8.RuneCountInString(embed.Title) != maxDiscordTitleLength {
+		t.Errorf("expected the title to be truncated to %d, got %d", maxDiscordTitleLength, utf8.RuneCountInString(embed.Title))
+	}
+	if utf8.RuneCountInString(embed.Fields[0].Value) != maxDiscordFieldValueLength {
+		t.Errorf("expected the field to be truncated to %d, got %d", maxDiscordFieldValueLength, utf8.RuneCountInString(embed.Fields[0].Value))
+	}
+}
+
+func Test_getDiscordMessageEmbedLimit(t *testing.T) {
+	long := strings.Repeat("x", 40)
+	buildInfo := NewBuildInfo("job", "https://ci/1", failureKey)
+	buildInfo.MaxFailedTests = 100
+	buildInfo.TestSummary = &TestSummary{Total: 100, Failed: 100}
+	buildInfo.GoTestSummary = &GoTestSummary{Tests: TestSummary{Total: 100, Failed: 100}}
+	for i := 0; i < 100; i++ {
+		buildInfo.Stages = append(buildInfo.Stages, Stage{Name: long, Status: failureKey})
+		buildInfo.MatrixCells = append(buildInfo.MatrixCells, MatrixCellResult{Cell: long, BuildStatus: failureKey})
+		buildInfo.Commits = append(buildInfo.Commits, Commit{SHA: "0123456789abcdef", Author: "octocat", Subject: long})
+		buildInfo.TestSummary.Failures = append(buildInfo.TestSummary.Failures, TestFailure{Name: long, Message: long})
+		buildInfo.GoTestSummary.Packages = append(buildInfo.GoTestSummary.Packages, GoTestResult{Package: long, Action: "fail"})
+		buildInfo.GoTestSummary.Slowest = append(buildInfo.GoTestSummary.Slowest, GoTestResult{Package: long, Test: long, Elapsed: 1})
+		buildInfo.GoTestSummary.Failures = append(buildInfo.GoTestSummary.Failures, GoTestFailure{Package: long, Test: long})
+	}
+	var untruncated int
+	for _, field := range RenderSlackAttachment(buildInfo).Fields {
+		untruncated += utf8.RuneCountInString(field.Title) + min(utf8.RuneCountInString(field.Value), maxDiscordFieldValueLength)
+	}
+	if untruncated <= maxDiscordEmbedLength {
+		t.Fatalf("expected the build to exceed the embed limit, got %d characters", untruncated)
+	}
+
+	embed := getDiscordMessage(buildInfo, failedStatus).Embeds[0]
+	length := utf8.RuneCountInString(embed.Title)
+	for _, field := range embed.Fields {
+		length += utf8.RuneCountInString(field.Name) + utf8.RuneCountInString(field.Value)
+	}
+	if length != maxDiscordEmbedLength {
+		t.Errorf("expected the embed to be shortened to %d characters, got %d", maxDiscordEmbedLength, length)
+	}
+	if last := embed.Fields[len(embed.Fields)-1].Value; !strings.HasSuffix(last, "…") {
+		t.Errorf("expected the last field to be shortened, got %q", last)
+	}
+}
+
+func Test_productionSlackClientWorker_postDiscordMessage(t *testing.T) {
+	var capturedURL string
+	var capturedMsg *DiscordMessage
+	worker := &productionSlackClientWorker{
+		jsonPoster: func(ctx context.Context, httpClient *http.Client, url string, payload interface{}) error {
+			capturedURL = url
+			capturedMsg, _ = payload.(*DiscordMessage)
+			return nil
+		},
+	}
+	err := worker.postDiscordMessage(context.Background(), BuildInfo{JobName: "job", BuildStatus: successKey, LastBuildStatus: failureKey, DiscordHookUrl: "https://discord/hook"})
+	if err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if capturedURL != "https://discord/hook" {
+		t.Errorf("expected URL %q, got %q", "https://discord/hook", capturedURL)
+	}
+	if capturedMsg == nil || capturedMsg.Embeds[0].Title != "Fixed: job" {
+		t.Errorf("expected the contextual status in the embed, got %+v", capturedMsg)
+	}
+}
@@ -0,0 +1,25 @@
+/*
+ * Copyright (c) 2021, salesforce.com, inc.
+ * All rights reserved.
+ * SPDX-License-Identifier: BSD-3-Clause
+ * For full license text, see the LICENSE file in the repo root or https://opensource.org/licenses/BSD-3-Clause
+ */
+
+/*
+Package ciresult renders CI build results and delivers them to Slack, Microsoft Teams, Discord, Mattermost, generic
+webhooks and email. It is the library behind the ci-result-to-slack command.
+
+A BuildInfo comes from GetBuildInfoFromEnv, which reads the same environment variables as the command, or from
+NewBuildInfo. The Render functions return each destination's message without sending it. SlackClient.Deliver and
+SlackClient.PostToSlack send it to every configured destination through the client's Pipeline, which can be extended
+with Notifier backends and Middleware.
+
+The exported API follows semantic versioning with the module's release tags: within a major version it only changes
+in backwards compatible ways. APIVersion is the major version of this API.
+*/
+package ciresult
+
+/*
+APIVersion is the major version of the package's API
+*/
+const APIVersion = 1
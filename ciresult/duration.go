@@ -0,0 +1,164 @@
+/*
+ * Copyright (c) 2021, salesforce.com, inc.
+ * All rights reserved.
+ * SPDX-License-Identifier: BSD-3-Clause
+ * For full license text, see the LICENSE file in the repo root or https://opensource.org/licenses/BSD-3-Clause
+ */
+package ciresult
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// minDurationSamples is the number of previous builds needed before a build can be flagged as slow
+const minDurationSamples = 3
+
+var (
+	humanDurationPart = regexp.MustCompile(`(?i)(\d+(?:\.\d+)?)\s*(milliseconds?|ms|seconds?|secs?|s|minutes?|mins?|m|hours?|hrs?|h|days?|d)\b`)
+
+	humanDurationUnits = map[string]time.Duration{
+		"ms": time.Millisecond, "millisecond": time.Millisecond, "milliseconds": time.Millisecond,
+		"s": time.Second, "sec": time.Second, "secs": time.Second, "second": time.Second, "seconds": time.Second,
+		"m": time.Minute, "min": time.Minute, "mins": time.Minute, "minute": time.Minute, "minutes": time.Minute,
+		"h": time.Hour, "hr": time.Hour, "hrs": time.Hour, "hour": time.Hour, "hours": time.Hour,
+		"d": 24 * time.Hour, "day": 24 * time.Hour, "days": 24 * time.Hour,
+	}
+)
+
+/*
+ParseBuildDuration sets Duration from BuildStartTime / BuildEndTime or, failing that, from BuildTime. A BuildTime
+which can't be parsed is shown as is.
+*/
+func (buildInfo *BuildInfo) ParseBuildDuration(now time.Time) error {
+	if strings.TrimSpace(buildInfo.BuildStartTime) != "" {
+		start, err := parseTimestamp(buildInfo.BuildStartTime)
+		if err != nil {
+			return fmt.Errorf("invalid BUILD_START_TIME: %s", err)
+		}
+		end := now
+		if strings.TrimSpace(buildInfo.BuildEndTime) != "" {
+			end, err = parseTimestamp(buildInfo.BuildEndTime)
+			if err != nil {
+				return fmt.Errorf("invalid BUILD_END_TIME: %s", err)
+			}
+		}
+		if end.Before(start) {
+			return fmt.Errorf("BUILD_END_TIME %s is before BUILD_START_TIME %s", buildInfo.BuildEndTime, buildInfo.BuildStartTime)
+		}
+		buildInfo.Duration = end.Sub(start)
+		return nil
+	}
+	duration, ok := parseDuration(buildInfo.BuildTime)
+	if ok {
+		buildInfo.Duration = duration
+	}
+	return nil
+}
+
+// parseTimestamp accepts RFC 3339 timestamps as well as Unix epochs in seconds or milliseconds
+func parseTimestamp(value string) (time.Time, error) {
+	value = strings.TrimSpace(value)
+	epoch, err := strconv.ParseInt(value, 10, 64)
+	if err == nil {
+		// Anything past the year 33658 in seconds is much more likely to be milliseconds
+		if epoch > 1e12 {
+			return time.UnixMilli(epoch), nil
+		}
+		return time.Unix(epoch, 0), nil
+	}
+	return time.Parse(time.RFC3339, value)
+}
+
+// parseDuration accepts Go durations (1m3s), milliseconds (63000) and human readable durations such as
+// Jenkins' durationString (1 min 3 sec)
+func parseDuration(value string) (time.Duration, bool) {
+	value = strings.TrimSpace(strings.TrimSuffix(strings.TrimSpace(value), "and counting"))
+	if value == "" {
+		return 0, false
+	}
+	milliseconds, err := strconv.ParseInt(value, 10, 64)
+	if err == nil {
+		return time.Duration(milliseconds) * time.Millisecond, milliseconds >= 0
+	}
+	duration, err := time.ParseDuration(value)
+	if err == nil {
+		return duration, duration >= 0
+	}
+	matches := humanDurationPart.FindAllStringSubmatch(value, -1)
+	if len(matches) == 0 || strings.Trim(humanDurationPart.ReplaceAllString(value, ""), " ,") != "" {
+		return 0, false
+	}
+	for _, match := range matches {
+		amount, _ := strconv.ParseFloat(match[1], 64)
+		duration += time.Duration(amount * float64(humanDurationUnits[strings.ToLower(match[2])]))
+	}
+	return duration, true
+}
+
+// formatDuration renders durations consistently, e.g. 850ms, 3.2s, 1m 3s or 2h 0m 5s
+func formatDuration(duration time.Duration) string {
+	if duration < time.Second {
+		return duration.Round(time.Millisecond).String()
+	}
+	if duration < time.Minute {
+		return strconv.FormatFloat(duration.Round(100*time.Millisecond).Seconds(), 'f', -1, 64) + "s"
+	}
+	duration = duration.Round(time.Second)
+	hours := duration / time.Hour
+	minutes := (duration % time.Hour) / time.Minute
+	seconds := (duration % time.Minute) / time.Second
+	if hours > 0 {
+		return fmt.Sprintf("%dh %dm %ds", hours, minutes, seconds)
+	}
+	return fmt.Sprintf("%dm %ds", minutes, seconds)
+}
+
+/*
+MedianDuration returns the median duration of the job's recorded builds
+*/
+func (buildInfo *BuildInfo) MedianDuration() (time.Duration, bool) {
+	if buildInfo.History == nil {
+		return 0, false
+	}
+	var durations []time.Duration
+	for _, record := range buildInfo.History.Records {
+		if record.JobName == buildInfo.JobName && record.Duration > 0 {
+			durations = append(durations, record.Duration)
+		}
+	}
+	if len(durations) < minDurationSamples {
+		return 0, false
+	}
+	sort.Slice(durations, func(i, j int) bool { return durations[i] < durations[j] })
+	middle := len(durations) / 2
+	if len(durations)%2 == 0 {
+		return (durations[middle-1] + durations[middle]) / 2, true
+	}
+	return durations[middle], true
+}
+
+/*
+IsSlow reports whether the build took more than SlowBuildFactor times the job's median duration
+*/
+func (buildInfo *BuildInfo) IsSlow() bool {
+	median, ok := buildInfo.MedianDuration()
+	return ok && buildInfo.SlowBuildFactor > 0 && buildInfo.Duration > 0 &&
+		float64(buildInfo.Duration) > buildInfo.SlowBuildFactor*float64(median)
+}
+
+func (buildInfo *BuildInfo) buildTimeText() string {
+	if buildInfo.Duration <= 0 {
+		return buildInfo.BuildTime
+	}
+	text := formatDuration(buildInfo.Duration)
+	if buildInfo.IsSlow() {
+		median, _ := buildInfo.MedianDuration()
+		text += fmt.Sprintf(" :turtle: (median %s)", formatDuration(median))
+	}
+	return text
+}
@@ -0,0 +1,130 @@
+/*
+ * Copyright (c) 2021, salesforce.com, inc.
+ * All rights reserved.
+ * SPDX-License-Identifier: BSD-3-Clause
+ * For full license text, see the LICENSE file in the repo root or https://opensource.org/licenses/BSD-3-Clause
+ */
+package ciresult
+
+import (
+	"testing"
+	"time"
+)
+
+func Test_ParseBuildDuration(t *testing.T) {
+	now := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	tests := []struct {
+		name      string
+		buildInfo BuildInfo
+		want      time.Duration
+		wantErr   bool
+	}{
+		{"no build time", BuildInfo{}, 0, false},
+		{"jenkins durationString", BuildInfo{BuildTime: "1 min 3 sec"}, 63 * time.Second, false},
+		{"jenkins durationString with fractions", BuildInfo{BuildTime: "3.2 sec"}, 3200 * time.Millisecond, false},
+		{"jenkins durationString while running", BuildInfo{BuildTime: "1 hr 2 min and counting"}, 62 * time.Minute, false},
+		{"jenkins durationString in days", BuildInfo{BuildTime: "1 day 2 hr"}, 26 * time.Hour, false},
+		{"spaced short units", BuildInfo{BuildTime: "0m 3s"}, 3 * time.Second, false},
+		{"go duration", BuildInfo{BuildTime: "1m3.5s"}, 63500 * time.Millisecond, false},
+		{"milliseconds", BuildInfo{BuildTime: "63000"}, 63 * time.Second, false},
+		{"unparseable is left alone", BuildInfo{BuildTime: "about a minute"}, 0, false},
+		{"negative is left alone", BuildInfo{BuildTime: "-5s"}, 0, false},
+		{
+			"rfc3339 timestamps",
+			BuildInfo{BuildStartTime: "2024-01-02T03:00:00Z", BuildEndTime: "2024-01-02T03:02:30Z", BuildTime: "1 sec"},
+			150 * time.Second,
+			false,
+		},
+		{"start until now", BuildInfo{BuildStartTime: "2024-01-02T03:04:00Z"}, 5 * time.Second, false},
+		{"epoch seconds", BuildInfo{BuildStartTime: "1704164400", BuildEndTime: "1704164460"}, time.Minute, false},
+		{"epoch milliseconds", BuildInfo{BuildStartTime: "1704164400000", BuildEndTime: "1704164400500"}, 500 * time.Millisecond, false},
+		{"invalid start", BuildInfo{BuildStartTime: "yesterday"}, 0, true},
+		{"invalid end", BuildInfo{BuildStartTime: "1704164400", BuildEndTime: "tomorrow"}, 0, true},
+		{"end before start", BuildInfo{BuildStartTime: "1704164460", BuildEndTime: "1704164400"}, 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.buildInfo.ParseBuildDuration(now)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ParseBuildDuration() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.buildInfo.Duration != tt.want {
+				t.Errorf("ParseBuildDuration() Duration = %v, want %v", tt.buildInfo.Duration, tt.want)
+			}
+		})
+	}
+}
+
+func Test_formatDuration(t *testing.T) {
+	tests := []struct {
+		duration time.Duration
+		want     string
+	}{
+		{850 * time.Millisecond, "850ms"},
+		{3 * time.Second, "3s"},
+		{3240 * time.Millisecond, "3.2s"},
+		{63 * time.Second, "1m 3s"},
+		{2 * time.Minute, "2m 0s"},
+		{2*time.Hour + 5*time.Second, "2h 0m 5s"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.want, func(t *testing.T) {
+			if got := formatDuration(tt.duration); got != tt.want {
+				t.Errorf("formatDuration() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_buildTimeText(t *testing.T) {
+	history := &History{Records: []BuildRecord{
+		{JobName: jobName, Duration: 60 * time.Second},
+		{JobName: jobName, Duration: 100 * time.Second},
+		{JobName: jobName, Duration: 80 * time.Second},
+		{JobName: jobName},
+		{JobName: "other job", Duration: time.Hour},
+	}}
+	tests := []struct {
+		name      string
+		buildInfo BuildInfo
+		want      string
+	}{
+		{"raw build time", BuildInfo{BuildTime: "about a minute"}, "about a minute"},
+		{"normalized", BuildInfo{BuildTime: "1 min 3 sec", Duration: 63 * time.Second}, "1m 3s"},
+		{
+			"not enough history",
+			BuildInfo{JobName: "other job", Duration: 3 * time.Hour, SlowBuildFactor: 1.5, History: history},
+			"3h 0m 0s",
+		},
+		{
+			"within the usual range",
+			BuildInfo{JobName: jobName, Duration: 120 * time.Second, SlowBuildFactor: 1.5, History: history},
+			"2m 0s",
+		},
+		{
+			"slow build",
+			BuildInfo{JobName: jobName, Duration: 121 * time.Second, SlowBuildFactor: 1.5, History: history},
+			"2m 1s :turtle: (median 1m 20s)",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.buildInfo.buildTimeText(); got != tt.want {
+				t.Errorf("buildTimeText() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_MedianDurationEvenSamples(t *testing.T) {
+	buildInfo := BuildInfo{JobName: jobName, History: &History{Records: []BuildRecord{
+		{JobName: jobName, Duration: 10 * time.Second},
+		{JobName: jobName, Duration: 40 * time.Second},
+		{JobName: jobName, Duration: 20 * time.Second},
+		{JobName: jobName, Duration: 30 * time.Second},
+	}}}
+	median, ok := buildInfo.MedianDuration()
+	if !ok || median != 25*time.Second {
+		t.Errorf("MedianDuration() = %v, %v, want 25s, true", median, ok)
+	}
+}
@@ -0,0 +1,261 @@
+/*
+ * Copyright (c) 2021, salesforce.com, inc.
+ * All rights reserved.
+ * SPDX-License-Identifier: BSD-3-Clause
+ * For full license text, see the LICENSE file in the repo root or https://opensource.org/licenses/BSD-3-Clause
+ */
+package ciresult
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"html"
+	"html/template"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net"
+	"net/smtp"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var emailHTMLTemplate = template.Must(template.New("email").Parse(`<!DOCTYPE html>
+<html>
+<body style="font-family: sans-serif">
+<h2 style="border-left: 6px solid {{.Color}}; padding-left: 8px">{{if .URL}}<a href="{{.URL}}">{{.Title}}</a>{{else}}{{.Title}}{{end}}</h2>
+{{- if .Fields}}
+<table cellpadding="4">
+{{- range .Fields}}
+<tr><th align="left" valign="top">{{.Title}}</th><td>{{.Value}}</td></tr>
+{{- end}}
+</table>
+{{- end}}
+</body>
+</html>
+`))
+
+type emailHTMLField struct {
+	Title string
+	Value template.HTML
+}
+
+/*
+Email represents a rendered build notification ready to be sent over SMTP
+*/
+type Email struct {
+	From    string
+	To      []string
+	Subject string
+	Text    string
+	HTML    string
+}
+
+/*
+EmailRecipients returns the comma separated EmailTo addresses
+*/
+func (buildInfo *BuildInfo) EmailRecipients() []string {
+	var recipients []string
+	for _, recipient := range strings.Split(buildInfo.EmailTo, ",") {
+		if strings.TrimSpace(recipient) != "" {
+			recipients = append(recipients, strings.TrimSpace(recipient))
+		}
+	}
+	return recipients
+}
+
+func getEmail(buildInfo BuildInfo, buildStatus Status) (Email, error) {
+	attachment := getAttachment(buildInfo, buildStatus)
+	email := Email{
+		From:    buildInfo.EmailFrom,
+		To:      buildInfo.EmailRecipients(),
+		Subject: attachment.Title,
+	}
+
+	var text strings.Builder
+	text.WriteString(attachment.Title + "\n")
+	if attachment.TitleLink != "" {
+		text.WriteString(attachment.TitleLink + "\n")
+	}
+	var fields []emailHTMLField
+	for _, field := range attachment.Fields {
+		value := slackToText(field.Value)
+		if field.Short {
+			fmt.Fprintf(&text, "\n%s: %s", field.Title, value)
+		} else {
+			fmt.Fprintf(&text, "\n%s:\n%s\n", field.Title, value)
+		}
+		fields = append(fields, emailHTMLField{Title: field.Title, Value: template.HTML(slackToHTML(field.Value))})
+	}
+	email.Text = strings.TrimRight(text.String(), "\n") + "\n"
+
+	var body bytes.Buffer
+	err := emailHTMLTemplate.Execute(&body, struct {
+		Title  string
+		URL    string
+		Color  string
+		Fields []emailHTMLField
+	}{attachment.Title, attachment.TitleLink, attachmentColorHex(attachment.Color), fields})
+	if err != nil {
+		return email, err
+	}
+	email.HTML = body.String()
+	return email, nil
+}
+
+/*
+slackToHTML converts Slack mrkdwn to HTML, escaping everything but the links and line breaks it adds
+*/
+func slackToHTML(text string) string {
+	var converted strings.Builder
+	plain := func(segment string) {
+		converted.WriteString(html.EscapeString(slackEmoji.Replace(mrkdwnUnescaper.Replace(segment))))
+	}
+	last := 0
+	for _, match := range slackLinkPattern.FindAllStringSubmatchIndex(text, -1) {
+		plain(text[last:match[0]])
+		linkURL := mrkdwnUnescaper.Replace(text[match[2]:match[3]])
+		linkText := slackEmoji.Replace(mrkdwnUnescaper.Replace(text[match[4]:match[5]]))
+		fmt.Fprintf(&converted, `<a href="%s">%s</a>`, html.EscapeString(linkURL), html.EscapeString(linkText))
+		last = match[1]
+	}
+	plain(text[last:])
+	return strings.ReplaceAll(converted.String(), "\n", "<br>\n")
+}
+
+/*
+Bytes renders the email as a multipart/alternative MIME message with plain text and HTML parts
+*/
+func (email Email) Bytes() ([]byte, error) {
+	var message bytes.Buffer
+	writer := multipart.NewWriter(&message)
+	headers := []string{
+		"From: " + email.From,
+		"To: " + strings.Join(email.To, ", "),
+		"Subject: " + mime.QEncoding.Encode("utf-8", email.Subject),
+		"Date: " + time.Now().Format(time.RFC1123Z),
+		"MIME-Version: 1.0",
+		"Content-Type: multipart/alternative; boundary=" + strconv.Quote(writer.Boundary()),
+	}
+	message.WriteString(strings.Join(headers, "\r\n") + "\r\n\r\n")
+	for _, part := range []struct {
+		contentType string
+		body        string
+	}{
+		{"text/plain; charset=utf-8", email.Text},
+		{"text/html; charset=utf-8", email.HTML},
+	} {
+		partWriter, err := writer.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {part.contentType},
+			"Content-Transfer-Encoding": {"quoted-printable"},
+		})
+		if err != nil {
+			return nil, err
+		}
+		encoder := quotedprintable.NewWriter(partWriter)
+		_, err = encoder.Write([]byte(part.body))
+		if err != nil {
+			return nil, err
+		}
+		err = encoder.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+	err := writer.Close()
+	if err != nil {
+		return nil, err
+	}
+	return message.Bytes(), nil
+}
+
+/*
+smtpAddress returns the host:port of the SMTP server and the authentication to use with it, if any
+*/
+func (buildInfo *BuildInfo) smtpAddress() (string, smtp.Auth) {
+	var auth smtp.Auth
+	if buildInfo.SmtpUsername != "" {
+		auth = smtp.PlainAuth("", buildInfo.SmtpUsername, buildInfo.SmtpPassword, buildInfo.SmtpHost)
+	}
+	return net.JoinHostPort(buildInfo.SmtpHost, strconv.Itoa(buildInfo.SmtpPort)), auth
+}
+
+/*
+sendMail works like smtp.SendMail, giving up as soon as ctx is done. STARTTLS uses tlsConfig when it isn't nil.
+*/
+func sendMail(ctx context.Context, addr string, auth smtp.Auth, tlsConfig *tls.Config, from string, to []string, msg []byte) error {
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return err
+	}
+	// Closing the connection unblocks whatever the exchange is waiting for
+	stop := context.AfterFunc(ctx, func() { _ = conn.Close() })
+	defer stop()
+	err = sendMailOn(conn, addr, auth, tlsConfig, from, to, msg)
+	if err != nil && ctx.Err() != nil {
+		return ctx.Err()
+	}
+	return err
+}
+
+func sendMailOn(conn net.Conn, addr string, auth smtp.Auth, tlsConfig *tls.Config, from string, to []string, msg []byte) error {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return err
+	}
+	client, err := smtp.NewClient(conn, host)
+	if err != nil {
+		_ = conn.Close()
+		return err
+	}
+	defer client.Close()
+	if ok, _ := client.Extension("STARTTLS"); ok {
+		if tlsConfig == nil {
+			tlsConfig = &tls.Config{}
+		}
+		tlsConfig = tlsConfig.Clone()
+		tlsConfig.ServerName = host
+		err = client.StartTLS(tlsConfig)
+		if err != nil {
+			return err
+		}
+	}
+	if auth != nil {
+		if ok, _ := client.Extension("AUTH"); !ok {
+			return errors.New("smtp: server doesn't support AUTH")
+		}
+		err = client.Auth(auth)
+		if err != nil {
+			return err
+		}
+	}
+	err = client.Mail(from)
+	if err != nil {
+		return err
+	}
+	for _, recipient := range to {
+		err = client.Rcpt(recipient)
+		if err != nil {
+			return err
+		}
+	}
+	writer, err := client.Data()
+	if err != nil {
+		return err
+	}
+	_, err = writer.Write(msg)
+	if err != nil {
+		return err
+	}
+	err = writer.Close()
+	if err != nil {
+		return err
+	}
+	return client.Quit()
+}
@@ -0,0 +1,179 @@
+/*
+ * Copyright (c) 2021, salesforce.com, inc.
+ * All rights reserved.
+ * SPDX-License-Identifier: BSD-3-Clause
+ * For full license text, see the LICENSE file in the repo root or https://opensource.org/licenses/BSD-3-Clause
+ */
+package ciresult
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/mail"
+	"net/smtp"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func Test_EmailRecipients(t *testing.T) {
+	buildInfo := BuildInfo{EmailTo: " dev@example.com, ,ops@example.com "}
+	want := []string{"dev@example.com", "ops@example.com"}
+	if got := buildInfo.EmailRecipients(); !reflect.DeepEqual(got, want) {
+		t.Errorf("EmailRecipients() = %v, want %v", got, want)
+	}
+}
+
+func Test_getEmail(t *testing.T) {
+	buildInfo := BuildInfo{
+		JobName:     "job",
+		BuildURL:    "https://ci/1",
+		BuildStatus: failureKey,
+		BranchName:  "main",
+		TriggeredBy: "<script>alert(1)</script>",
+		Stages:      []Stage{{Name: "Build & Test", Status: failureKey}},
+		PrNumber:    "7",
+		PrUrl:       "https://example.com/pr/7?a=1&b=2",
+		EmailFrom:   "ci@example.com",
+		EmailTo:     "dev@example.com",
+	}
+	email, err := getEmail(buildInfo, failedStatus)
+	if err != nil {
+		t.Fatalf("getEmail() unexpected error: %v", err)
+	}
+	if email.Subject != "Failed: job" || email.From != "ci@example.com" || !reflect.DeepEqual(email.To, []string{"dev@example.com"}) {
+		t.Errorf("getEmail() = %+v", email)
+	}
+	wantText := `Failed: job
+https://ci/1
+
+Branch: main
+Triggered By: <script>alert(1)</script>
+Pull Request:
+#7 (https://example.com/pr/7?a=1&b=2)
+
+Stages:
+❌ Build & Test
+`
+	if email.Text != wantText {
+		t.Errorf("getEmail() Text = %q, want %q", email.Text, wantText)
+	}
+	for _, want := range []string{
+		`<a href="https://ci/1">Failed: job</a>`,
+		`border-left: 6px solid #A30200`,
+		`<td>&lt;script&gt;alert(1)&lt;/script&gt;</td>`,
+		`<td><a href="https://example.com/pr/7?a=1&amp;b=2">#7</a></td>`,
+		`<td>❌ Build &amp; Test</td>`,
+	} {
+		if !strings.Contains(email.HTML, want) {
+			t.Errorf("getEmail() HTML = %s, expected it to contain %s", email.HTML, want)
+		}
+	}
+}
+
+func Test_slackToHTML(t *testing.T) {
+	tests := []struct {
+		text string
+		want string
+	}{
+		{"plain", "plain"},
+		{"a & <b>", "a &amp; &lt;b&gt;"},
+		{"see <https://x/?a=1&amp;b=\"2\"|x &amp; y> now", `see <a href="https://x/?a=1&amp;b=&#34;2&#34;">x &amp; y</a> now`},
+		{":white_check_mark: one\n:x: two", "✅ one<br>\n❌ two"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.text, func(t *testing.T) {
+			if got := slackToHTML(tt.text); got != tt.want {
+				t.Errorf("slackToHTML() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_EmailBytes(t *testing.T) {
+	email := Email{
+		From:    "ci@example.com",
+		To:      []string{"dev@example.com", "ops@example.com"},
+		Subject: "Still Failing: jöb",
+		Text:    "plain ✅\n",
+		HTML:    "<p>html ✅</p>\n",
+	}
+	data, err := email.Bytes()
+	if err != nil {
+		t.Fatalf("Bytes() unexpected error: %v", err)
+	}
+	message, err := mail.ReadMessage(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("unable to parse message: %v", err)
+	}
+	subject, _ := new(mime.WordDecoder).DecodeHeader(message.Header.Get("Subject"))
+	if subject != email.Subject || message.Header.Get("To") != "dev@example.com, ops@example.com" {
+		t.Errorf("unexpected headers %v", message.Header)
+	}
+	mediaType, params, err := mime.ParseMediaType(message.Header.Get("Content-Type"))
+	if err != nil || mediaType != "multipart/alternative" {
+		t.Fatalf("unexpected Content-Type %s: %v", message.Header.Get("Content-Type"), err)
+	}
+	reader := multipart.NewReader(message.Body, params["boundary"])
+	var parts []string
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("unable to read part: %v", err)
+		}
+		// NextPart decodes quoted-printable bodies, whose line breaks are CRLF
+		body, _ := io.ReadAll(part)
+		parts = append(parts, part.Header.Get("Content-Type")+": "+string(body))
+	}
+	want := []string{"text/plain; charset=utf-8: plain ✅\r\n", "text/html; charset=utf-8: <p>html ✅</p>\r\n"}
+	if !reflect.DeepEqual(parts, want) {
+		t.Errorf("Bytes() parts = %q, want %q", parts, want)
+	}
+}
+
+func Test_productionSlackClientWorker_sendEmail(t *testing.T) {
+	var capturedAddr, capturedFrom string
+	var capturedTo []string
+	var capturedAuth smtp.Auth
+	worker := &productionSlackClientWorker{
+		mailSender: func(ctx context.Context, addr string, auth smtp.Auth, tlsConfig *tls.Config, from string, to []string, msg []byte) error {
+			capturedAddr, capturedAuth, capturedFrom, capturedTo = addr, auth, from, to
+			return nil
+		},
+	}
+	buildInfo := BuildInfo{
+		JobName:     "job",
+		BuildStatus: successKey,
+		EmailTo:     "dev@example.com",
+		EmailFrom:   "ci@example.com",
+		SmtpHost:    "smtp.example.com",
+		SmtpPort:    587,
+	}
+	err := worker.sendEmail(context.Background(), buildInfo)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if capturedAddr != "smtp.example.com:587" || capturedAuth != nil || capturedFrom != "ci@example.com" ||
+		!reflect.DeepEqual(capturedTo, []string{"dev@example.com"}) {
+		t.Errorf("unexpected send %v %v %v %v", capturedAddr, capturedAuth, capturedFrom, capturedTo)
+	}
+
+	buildInfo.SmtpUsername = "user"
+	_ = worker.sendEmail(context.Background(), buildInfo)
+	if capturedAuth == nil {
+		t.Errorf("expected authentication when SMTP_USERNAME is set")
+	}
+
+	buildInfo.SmtpHost = ""
+	err = worker.sendEmail(context.Background(), buildInfo)
+	if err == nil || err.Error() != EmailConfigErrorMessage {
+		t.Errorf("sendEmail() err = %v, want %v", err, EmailConfigErrorMessage)
+	}
+}
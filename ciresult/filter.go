@@ -0,0 +1,172 @@
+/*
+ * Copyright (c) 2021, salesforce.com, inc.
+ * All rights reserved.
+ * SPDX-License-Identifier: BSD-3-Clause
+ * For full license text, see the LICENSE file in the repo root or https://opensource.org/licenses/BSD-3-Clause
+ */
+package ciresult
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"strings"
+)
+
+const (
+	// FilterOn matches the build's contextual status, e.g. Still Failing
+	FilterOn = "on"
+	// FilterBranches matches BranchName against globs, e.g. release/*
+	FilterBranches = "branches"
+	// FilterJobs matches JobName against globs
+	FilterJobs = "jobs"
+	// FilterTriggeredBy matches TriggeredBy case-insensitively against substrings, e.g. Timer
+	FilterTriggeredBy = "triggered-by"
+)
+
+// filterStatuses are the statuses FilterOn rules can name
+var filterStatuses = []Status{successStatus, fixedStatus, unstableStatus, unknownStatus, failedStatus, stillFailingStatus}
+
+/*
+FilterRule decides which builds are posted by matching one of their attributes against a list of values. A build is
+posted when it matches every notify rule and none of the skip rules.
+*/
+type FilterRule struct {
+	// Skip rules hold back the builds they match, the other rules hold back the builds they don't match
+	Skip   bool
+	Field  string
+	Values []string
+}
+
+/*
+ParseFilterRules parses semicolon separated rules of the form "[notify|skip] field: value, value", e.g.
+"notify on: Failed, Still Failing, Fixed; branches: main, release/*; skip triggered-by: Timer". Rules notify unless
+they start with skip.
+*/
+func ParseFilterRules(rules string) ([]FilterRule, error) {
+	var filterRules []FilterRule
+	var errs []error
+	for _, spec := range strings.Split(rules, ";") {
+		spec = strings.TrimSpace(spec)
+		if spec == "" {
+			continue
+		}
+		rule, err := parseFilterRule(spec)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("invalid NOTIFY_RULES rule %q: %s", spec, err))
+			continue
+		}
+		filterRules = append(filterRules, rule)
+	}
+	return filterRules, errors.Join(errs...)
+}
+
+func parseFilterRule(spec string) (FilterRule, error) {
+	var rule FilterRule
+	head, values, found := strings.Cut(spec, ":")
+	if !found {
+		return rule, errors.New("expected [notify|skip] field: values")
+	}
+	words := strings.Fields(strings.ToLower(head))
+	if len(words) == 2 && (words[0] == "notify" || words[0] == "skip") {
+		rule.Skip = words[0] == "skip"
+		words = words[1:]
+	}
+	if len(words) != 1 {
+		return rule, errors.New("expected [notify|skip] field: values")
+	}
+	rule.Field = words[0]
+	for _, value := range strings.Split(values, ",") {
+		value = strings.TrimSpace(value)
+		if value == "" {
+			continue
+		}
+		normalized, err := normalizeFilterValue(rule.Field, value)
+		if err != nil {
+			return rule, err
+		}
+		rule.Values = append(rule.Values, normalized)
+	}
+	if len(rule.Values) == 0 {
+		return rule, fmt.Errorf("expected at least one %s", rule.Field)
+	}
+	return rule, nil
+}
+
+func normalizeFilterValue(field string, value string) (string, error) {
+	switch field {
+	case FilterOn:
+		for _, status := range filterStatuses {
+			if strings.EqualFold(strings.Join(strings.Fields(value), " "), status.text) {
+				return status.text, nil
+			}
+		}
+		var texts []string
+		for _, status := range filterStatuses {
+			texts = append(texts, status.text)
+		}
+		return "", fmt.Errorf("unknown status %q, expected one of %s", value, strings.Join(texts, ", "))
+	case FilterBranches, FilterJobs:
+		_, err := path.Match(value, "")
+		if err != nil {
+			return "", fmt.Errorf("invalid glob %q: %s", value, err)
+		}
+		return value, nil
+	case FilterTriggeredBy:
+		return value, nil
+	}
+	return "", fmt.Errorf("unknown field %q, expected %s, %s, %s or %s", field, FilterOn, FilterBranches, FilterJobs, FilterTriggeredBy)
+}
+
+/*
+String returns the rule in the form it's parsed from, e.g. "skip triggered-by: Timer"
+*/
+func (rule FilterRule) String() string {
+	action := "notify"
+	if rule.Skip {
+		action = "skip"
+	}
+	return fmt.Sprintf("%s %s: %s", action, rule.Field, strings.Join(rule.Values, ", "))
+}
+
+/*
+Matches reports whether any of the rule's values matches the build
+*/
+func (rule FilterRule) Matches(buildInfo *BuildInfo) bool {
+	for _, value := range rule.Values {
+		var matched bool
+		switch rule.Field {
+		case FilterOn:
+			matched = buildInfo.GetContextualStatus().text == value
+		case FilterBranches:
+			matched, _ = path.Match(value, buildInfo.BranchName)
+		case FilterJobs:
+			matched, _ = path.Match(value, buildInfo.JobName)
+		case FilterTriggeredBy:
+			matched = strings.Contains(strings.ToLower(buildInfo.TriggeredBy), strings.ToLower(value))
+		}
+		if matched {
+			return true
+		}
+	}
+	return false
+}
+
+/*
+FilterRules returns the rules parsed from NotifyRules, followed by the skip rule of SkipIfSuccess when it's set
+*/
+func (buildInfo *BuildInfo) FilterRules() ([]FilterRule, error) {
+	rules, err := ParseFilterRules(buildInfo.NotifyRules)
+	if buildInfo.SkipIfSuccess {
+		rules = append(rules, FilterRule{Skip: true, Field: FilterOn, Values: []string{successStatus.text}})
+	}
+	return rules, err
+}
+
+/*
+ValidateNotifyRules returns an error describing every invalid rule in NotifyRules
+*/
+func (buildInfo *BuildInfo) ValidateNotifyRules() error {
+	_, err := buildInfo.FilterRules()
+	return err
+}
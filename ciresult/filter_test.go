@@ -0,0 +1,131 @@
+/*
+ * Copyright (c) 2021, salesforce.com, inc.
+ * All rights reserved.
+ * SPDX-License-Identifier: BSD-3-Clause
+ * For full license text, see the LICENSE file in the repo root or https://opensource.org/licenses/BSD-3-Clause
+ */
+package ciresult
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func Test_ParseFilterRules(t *testing.T) {
+	tests := []struct {
+		name    string
+		rules   string
+		want    []FilterRule
+		wantErr string
+	}{
+		{"empty", " ; ", nil, ""},
+		{
+			"notify and skip rules",
+			"notify on: failed, STILL  FAILING, Fixed; branches: main, release/*; skip triggered-by: Timer",
+			[]FilterRule{
+				{Field: FilterOn, Values: []string{"Failed", "Still Failing", "Fixed"}},
+				{Field: FilterBranches, Values: []string{"main", "release/*"}},
+				{Skip: true, Field: FilterTriggeredBy, Values: []string{"Timer"}},
+			},
+			"",
+		},
+		{"jobs", "Skip Jobs: nightly-*,", []FilterRule{{Skip: true, Field: FilterJobs, Values: []string{"nightly-*"}}}, ""},
+		{"missing colon", "notify on Failed", nil, `invalid NOTIFY_RULES rule "notify on Failed": expected [notify|skip] field: values`},
+		{"unknown action", "mute on: Failed", nil, "expected [notify|skip] field: values"},
+		{"unknown field", "notify authors: alice", nil, `unknown field "authors"`},
+		{"unknown status", "on: Broken", nil, `unknown status "Broken", expected one of Success, Fixed, Unstable, Unknown, Failed, Still Failing`},
+		{"invalid glob", "branches: release/[", nil, `invalid glob "release/["`},
+		{"no values", "skip branches: ,", nil, "expected at least one branches"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseFilterRules(tt.rules)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("ParseFilterRules() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseFilterRules() unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParseFilterRules() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_ParseFilterRulesReportsEveryInvalidRule(t *testing.T) {
+	_, err := ParseFilterRules("on: Broken; branches: main; jobs: [")
+	if err == nil || !strings.Contains(err.Error(), `"on: Broken"`) || !strings.Contains(err.Error(), `"jobs: ["`) {
+		t.Errorf("ParseFilterRules() error = %v, want both invalid rules", err)
+	}
+}
+
+func Test_FilterRuleString(t *testing.T) {
+	for _, rules := range []string{"notify on: Failed, Still Failing", "skip triggered-by: Timer", "notify branches: release/*"} {
+		parsed, err := ParseFilterRules(rules)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := parsed[0].String(); got != rules {
+			t.Errorf("String() = %q, want %q", got, rules)
+		}
+	}
+}
+
+func Test_ShouldSkipPostingWithNotifyRules(t *testing.T) {
+	rules := "notify on: Failed, Still Failing, Fixed; branches: main, release/*; skip triggered-by: Timer"
+	tests := []struct {
+		name      string
+		buildInfo BuildInfo
+		want      bool
+	}{
+		{"failure on main", BuildInfo{BuildStatus: failureKey, BranchName: "main"}, false},
+		{"fix on a release branch", BuildInfo{BuildStatus: successKey, LastBuildStatus: failureKey, BranchName: "release/1.2"}, false},
+		{"success", BuildInfo{BuildStatus: successKey, BranchName: "main"}, true},
+		{"unstable", BuildInfo{BuildStatus: unstableKey, BranchName: "main"}, true},
+		{"feature branch", BuildInfo{BuildStatus: failureKey, BranchName: "feature/x"}, true},
+		{"nested release branch", BuildInfo{BuildStatus: failureKey, BranchName: "release/1.2/hotfix"}, true},
+		{"no branch", BuildInfo{BuildStatus: failureKey}, true},
+		{"timer", BuildInfo{BuildStatus: failureKey, BranchName: "main", TriggeredBy: "Started by timer"}, true},
+		{"user", BuildInfo{BuildStatus: failureKey, BranchName: "main", TriggeredBy: "Started by user alice"}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.buildInfo.NotifyRules = rules
+			if got := tt.buildInfo.ShouldSkipPosting(); got != tt.want {
+				t.Errorf("ShouldSkipPosting() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_FilterRulesIncludeSkipIfSuccess(t *testing.T) {
+	buildInfo := BuildInfo{NotifyRules: "skip jobs: scratch-*", SkipIfSuccess: true}
+	got, err := buildInfo.FilterRules()
+	if err != nil {
+		t.Fatalf("FilterRules() unexpected error: %v", err)
+	}
+	want := []FilterRule{
+		{Skip: true, Field: FilterJobs, Values: []string{"scratch-*"}},
+		{Skip: true, Field: FilterOn, Values: []string{"Success"}},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("FilterRules() = %+v, want %+v", got, want)
+	}
+}
+
+func Test_GetBuildInfoFromEnvRejectsInvalidNotifyRules(t *testing.T) {
+	t.Setenv("HOOK_URL", "test")
+	t.Setenv("JOB_NAME", "test")
+	t.Setenv("BUILD_STATUS", "test")
+	t.Setenv("BUILD_URL", "test")
+	t.Setenv("NOTIFY_RULES", "notify on: Broken")
+	_, err := GetBuildInfoFromEnv()
+	if err == nil || !strings.Contains(err.Error(), "invalid NOTIFY_RULES rule") {
+		t.Errorf("GetBuildInfoFromEnv() error = %v, want the invalid rule", err)
+	}
+}
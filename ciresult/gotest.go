@@ -0,0 +1,267 @@
+/*
+ * Copyright (c) 2021, salesforce.com, inc.
+ * All rights reserved.
+ * SPDX-License-Identifier: BSD-3-Clause
+ * For full license text, see the LICENSE file in the repo root or https://opensource.org/licenses/BSD-3-Clause
+ */
+package ciresult
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"github.com/slack-go/slack"
+	"io"
+	"os"
+	"sort"
+	"strings"
+)
+
+const stdinPath = "-"
+
+var (
+	// The go test fields are titled apart from the JUnit ones since both can be in the same message
+	goTestsFieldTitle       = "Go Tests"
+	failedGoTestsFieldTitle = "Failed Go Tests"
+	packagesFieldTitle      = "Packages"
+	slowestTestsFieldTitle  = "Slowest Tests"
+)
+
+/*
+GoTestSummary represents the results parsed from a `go test -json` stream
+*/
+type GoTestSummary struct {
+	Tests    TestSummary
+	Packages []GoTestResult
+	Slowest  []GoTestResult
+	Failures []GoTestFailure
+}
+
+/*
+GoTestResult represents the outcome of a single package or test
+*/
+type GoTestResult struct {
+	Package, Test, Action string
+	Elapsed               float64
+}
+
+/*
+GoTestFailure represents a failing test (or package when no test failed) with its relevant output
+*/
+type GoTestFailure struct {
+	Package, Test string
+	Output        []string
+}
+
+type goTestEvent struct {
+	Action  string
+	Package string
+	Test    string
+	Elapsed float64
+	Output  string
+}
+
+type goTestKey struct {
+	pkg, test string
+}
+
+func (buildInfo *BuildInfo) loadGoTestReport() error {
+	if strings.TrimSpace(buildInfo.GoTestJson) == "" {
+		return nil
+	}
+	reader := io.Reader(os.Stdin)
+	if buildInfo.GoTestJson != stdinPath {
+		file, err := os.Open(buildInfo.GoTestJson)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		reader = file
+	}
+	summary, err := parseGoTestJSON(reader, buildInfo.SlowestTests)
+	if err != nil {
+		return fmt.Errorf("unable to parse go test output %s: %s", buildInfo.GoTestJson, err)
+	}
+	buildInfo.GoTestSummary = summary
+	return nil
+}
+
+func parseGoTestJSON(reader io.Reader, slowestCount int) (*GoTestSummary, error) {
+	outputs := map[goTestKey][]string{}
+	var tests, packages []GoTestResult
+
+	scanner := bufio.NewScanner(reader)
+	scanner.Buffer(make([]byte, 0, 64*1024), 4*1024*1024)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		// `go test -json` may be interleaved with plain build output
+		if !strings.HasPrefix(line, "{") {
+			continue
+		}
+		var event goTestEvent
+		err := json.Unmarshal([]byte(line), &event)
+		if err != nil {
+			return nil, err
+		}
+		key := goTestKey{event.Package, event.Test}
+		switch event.Action {
+		case "output":
+			outputs[key] = append(outputs[key], strings.TrimRight(event.Output, "\n"))
+		case "pass", "fail", "skip":
+			result := GoTestResult{Package: event.Package, Test: event.Test, Action: event.Action, Elapsed: event.Elapsed}
+			if event.Test == "" {
+				packages = append(packages, result)
+			} else {
+				tests = append(tests, result)
+			}
+		}
+	}
+	err := scanner.Err()
+	if err != nil {
+		return nil, err
+	}
+
+	summary := &GoTestSummary{Packages: packages}
+	failedTests := map[string]bool{}
+	for _, test := range tests {
+		summary.Tests.Total++
+		switch test.Action {
+		case "pass":
+			summary.Tests.Passed++
+		case "skip":
+			summary.Tests.Skipped++
+		case "fail":
+			summary.Tests.Failed++
+			failedTests[test.Package] = true
+			if !hasFailedSubtest(tests, test) {
+				summary.Failures = append(summary.Failures, GoTestFailure{
+					Package: test.Package,
+					Test:    test.Test,
+					Output:  relevantOutput(outputs[goTestKey{test.Package, test.Test}]),
+				})
+			}
+		}
+	}
+	// Packages which fail without a failing test (e.g. build failures) are reported on their own
+	for _, pkg := range packages {
+		if pkg.Action == "fail" && !failedTests[pkg.Package] {
+			summary.Failures = append(summary.Failures, GoTestFailure{
+				Package: pkg.Package,
+				Output:  relevantOutput(outputs[goTestKey{pkg.Package, ""}]),
+			})
+		}
+	}
+
+	sort.SliceStable(tests, func(i, j int) bool { return tests[i].Elapsed > tests[j].Elapsed })
+	for _, test := range tests {
+		if len(summary.Slowest) >= slowestCount {
+			break
+		}
+		if test.Action == "skip" || strings.Contains(test.Test, "/") {
+			continue
+		}
+		summary.Slowest = append(summary.Slowest, test)
+	}
+	return summary, nil
+}
+
+func hasFailedSubtest(tests []GoTestResult, parent GoTestResult) bool {
+	for _, test := range tests {
+		if test.Action == "fail" && test.Package == parent.Package && strings.HasPrefix(test.Test, parent.Test+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// relevantOutput drops the framing lines `go test` adds around each test's own output
+func relevantOutput(lines []string) []string {
+	var relevant []string
+	for _, line := range lines {
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" || strings.HasPrefix(trimmed, "=== ") || strings.HasPrefix(trimmed, "--- ") ||
+			trimmed == "FAIL" || trimmed == "PASS" || strings.HasPrefix(trimmed, "FAIL\t") || strings.HasPrefix(trimmed, "ok  \t") {
+			continue
+		}
+		relevant = append(relevant, line)
+	}
+	return relevant
+}
+
+func (summary *GoTestSummary) packagesText() string {
+	counts := map[string]int{}
+	for _, pkg := range summary.Packages {
+		counts[pkg.Action]++
+	}
+	text := fmt.Sprintf("%d passed, %d failed", counts["pass"], counts["fail"])
+	if counts["skip"] > 0 {
+		text += fmt.Sprintf(", %d without tests", counts["skip"])
+	}
+	for _, pkg := range summary.Packages {
+		if pkg.Action == "fail" {
+			text += "\n• " + mrkdwnEscaper.Replace(pkg.Package)
+		}
+	}
+	return text
+}
+
+func (summary *GoTestSummary) slowestText() string {
+	var lines []string
+	for _, test := range summary.Slowest {
+		lines = append(lines, fmt.Sprintf("• %s (%s) %.2fs", mrkdwnEscaper.Replace(test.Test), mrkdwnEscaper.Replace(test.Package), test.Elapsed))
+	}
+	return strings.Join(lines, "\n")
+}
+
+func (summary *GoTestSummary) failuresText(maxFailures int, outputLines int) string {
+	// Negative values are rejected by Validate, but Render callers may not have validated the build
+	outputLines = max(outputLines, 0)
+	var lines []string
+	for i, failure := range summary.Failures {
+		if i >= maxFailures {
+			lines = append(lines, fmt.Sprintf("...and %d more", len(summary.Failures)-maxFailures))
+			break
+		}
+		name := failure.Package
+		if failure.Test != "" {
+			name = failure.Test + " (" + failure.Package + ")"
+		}
+		lines = append(lines, "• "+mrkdwnEscaper.Replace(name))
+		output := failure.Output
+		if len(output) > outputLines {
+			output = output[:outputLines]
+		}
+		for _, line := range output {
+			lines = append(lines, "    "+mrkdwnEscaper.Replace(strings.TrimSpace(line)))
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+/*
+ValidateFailureOutputLines returns an error if FailureOutputLines is negative
+*/
+func (buildInfo *BuildInfo) ValidateFailureOutputLines() error {
+	if buildInfo.FailureOutputLines < 0 {
+		return fmt.Errorf("invalid FAILURE_OUTPUT_LINES %d, expected 0 or more", buildInfo.FailureOutputLines)
+	}
+	return nil
+}
+
+func appendGoTestSummaryFields(attachmentFields *[]slack.AttachmentField, buildInfo BuildInfo) {
+	summary := buildInfo.GoTestSummary
+	if summary == nil {
+		return
+	}
+	appendAttachmentField(attachmentFields, goTestsFieldTitle, summary.Tests.countsText())
+	if len(summary.Packages) > 0 {
+		*attachmentFields = append(*attachmentFields, getLongAttachmentField(packagesFieldTitle, summary.packagesText()))
+	}
+	if len(summary.Slowest) > 0 {
+		*attachmentFields = append(*attachmentFields, getLongAttachmentField(slowestTestsFieldTitle, summary.slowestText()))
+	}
+	if buildInfo.MaxFailedTests > 0 && len(summary.Failures) > 0 {
+		*attachmentFields = append(*attachmentFields, getLongAttachmentField(failedGoTestsFieldTitle,
+			summary.failuresText(buildInfo.MaxFailedTests, buildInfo.FailureOutputLines)))
+	}
+}
@@ -0,0 +1,195 @@
+/*
+ * Copyright (c) 2021, salesforce.com, inc.
+ * All rights reserved.
+ * SPDX-License-Identifier: BSD-3-Clause
+ * For full license text, see the LICENSE file in the repo root or https://opensource.org/licenses/BSD-3-Clause
+ */
+package ciresult
+
+import (
+	"github.com/slack-go/slack"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const (
+	apiPackage    = "github.com/example/svc/api"
+	storePackage  = "github.com/example/svc/store"
+	brokenPackage = "github.com/example/svc/broken"
+	cmdPackage    = "github.com/example/svc/cmd"
+)
+
+func Test_LoadTestReports_GoTestJSON(t *testing.T) {
+	buildInfo := BuildInfo{GoTestJson: "testdata/gotest/report.json", SlowestTests: 3}
+	err := buildInfo.LoadTestReports()
+	if err != nil {
+		t.Fatalf("LoadTestReports() unexpected error: %v", err)
+	}
+	want := &GoTestSummary{
+		Tests: TestSummary{Total: 6, Passed: 2, Failed: 3, Skipped: 1},
+		Packages: []GoTestResult{
+			{Package: apiPackage, Action: "fail", Elapsed: 5},
+			{Package: storePackage, Action: "pass", Elapsed: 0.4},
+			{Package: brokenPackage, Action: "fail"},
+			{Package: cmdPackage, Action: "skip"},
+		},
+		Slowest: []GoTestResult{
+			{Package: apiPackage, Test: "TestTable", Action: "fail", Elapsed: 3.1},
+			{Package: apiPackage, Test: "TestGet", Action: "pass", Elapsed: 1.5},
+			{Package: storePackage, Test: "TestSave", Action: "pass", Elapsed: 0.3},
+		},
+		Failures: []GoTestFailure{
+			{Package: apiPackage, Test: "TestPut", Output: []string{"    api_test.go:12: expected 200", "    api_test.go:13: got 500"}},
+			{Package: apiPackage, Test: "TestTable/empty", Output: []string{"    api_test.go:30: empty input"}},
+			{Package: brokenPackage},
+		},
+	}
+	if !reflect.DeepEqual(buildInfo.GoTestSummary, want) {
+		t.Errorf("LoadTestReports() GoTestSummary = %+v, want %+v", buildInfo.GoTestSummary, want)
+	}
+}
+
+func Test_LoadTestReports_GoTestJSONErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		goTest string
+	}{
+		{"missing file", "testdata/gotest/missing.json"},
+		{"invalid json event", "testdata/gotest/invalid.json"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			buildInfo := BuildInfo{GoTestJson: tt.goTest}
+			err := buildInfo.LoadTestReports()
+			if err == nil {
+				t.Error("LoadTestReports() expected error")
+			}
+			if buildInfo.GoTestSummary != nil {
+				t.Errorf("LoadTestReports() GoTestSummary = %+v, want nil", buildInfo.GoTestSummary)
+			}
+		})
+	}
+}
+
+func Test_parseGoTestJSON_Stream(t *testing.T) {
+	stream := strings.NewReader(`{"Action":"pass","Package":"p","Test":"TestA","Elapsed":0.1}
+{"Action":"pass","Package":"p","Elapsed":0.1}
+`)
+	summary, err := parseGoTestJSON(stream, 0)
+	if err != nil {
+		t.Fatalf("parseGoTestJSON() unexpected error: %v", err)
+	}
+	if summary.Tests.Passed != 1 || len(summary.Slowest) != 0 || len(summary.Failures) != 0 {
+		t.Errorf("parseGoTestJSON() = %+v", summary)
+	}
+}
+
+func Test_appendGoTestSummaryFields(t *testing.T) {
+	summary := &GoTestSummary{
+		Tests: TestSummary{Total: 3, Passed: 1, Failed: 2},
+		Packages: []GoTestResult{
+			{Package: apiPackage, Action: "fail"},
+			{Package: storePackage, Action: "pass"},
+			{Package: cmdPackage, Action: "skip"},
+		},
+		Slowest: []GoTestResult{{Package: storePackage, Test: "TestSave", Action: "pass", Elapsed: 1.234}},
+		Failures: []GoTestFailure{
+			{Package: apiPackage, Test: "TestPut", Output: []string{"    line 1", "    line 2", "    line 3"}},
+			{Package: brokenPackage},
+		},
+	}
+	tests := []struct {
+		name      string
+		buildInfo BuildInfo
+		want      []slack.AttachmentField
+	}{
+		{
+			"no summary",
+			BuildInfo{},
+			emptyAttachmentFields,
+		},
+		{
+			"all fields",
+			BuildInfo{GoTestSummary: summary, MaxFailedTests: 5, FailureOutputLines: 2},
+			[]slack.AttachmentField{
+				getAttachmentField(goTestsFieldTitle, "3 total, 1 passed, 2 failed, 0 skipped"),
+				getLongAttachmentField(packagesFieldTitle, "1 passed, 1 failed, 1 without tests\n• "+apiPackage),
+				getLongAttachmentField(slowestTestsFieldTitle, "• TestSave ("+storePackage+") 1.23s"),
+				getLongAttachmentField(failedGoTestsFieldTitle, "• TestPut ("+apiPackage+")\n    line 1\n    line 2\n• "+brokenPackage),
+			},
+		},
+		{
+			"mrkdwn escaped",
+			BuildInfo{GoTestSummary: &GoTestSummary{
+				Tests:    TestSummary{Total: 1, Failed: 1},
+				Packages: []GoTestResult{{Package: "example.com/a&b", Action: "fail"}},
+				Slowest:  []GoTestResult{{Package: "example.com/a&b", Test: "Test<T>", Action: "fail", Elapsed: 0.5}},
+				Failures: []GoTestFailure{{Package: "example.com/a&b", Test: "Test<T>", Output: []string{"    got <nil|x> -> want &amp;"}}},
+			}, MaxFailedTests: 5, FailureOutputLines: 5},
+			[]slack.AttachmentField{
+				getAttachmentField(goTestsFieldTitle, "1 total, 0 passed, 1 failed, 0 skipped"),
+				getLongAttachmentField(packagesFieldTitle, "0 passed, 1 failed\n• example.com/a&amp;b"),
+				getLongAttachmentField(slowestTestsFieldTitle, "• Test&lt;T&gt; (example.com/a&amp;b) 0.50s"),
+				getLongAttachmentField(failedGoTestsFieldTitle, "• Test&lt;T&gt; (example.com/a&amp;b)\n    got &lt;nil|x&gt; -&gt; want &amp;amp;"),
+			},
+		},
+		{
+			"failures capped",
+			BuildInfo{GoTestSummary: summary, MaxFailedTests: 1, FailureOutputLines: 0},
+			[]slack.AttachmentField{
+				getAttachmentField(goTestsFieldTitle, "3 total, 1 passed, 2 failed, 0 skipped"),
+				getLongAttachmentField(packagesFieldTitle, "1 passed, 1 failed, 1 without tests\n• "+apiPackage),
+				getLongAttachmentField(slowestTestsFieldTitle, "• TestSave ("+storePackage+") 1.23s"),
+				getLongAttachmentField(failedGoTestsFieldTitle, "• TestPut ("+apiPackage+")\n...and 1 more"),
+			},
+		},
+		{
+			"negative output lines",
+			BuildInfo{GoTestSummary: summary, MaxFailedTests: 5, FailureOutputLines: -1},
+			[]slack.AttachmentField{
+				getAttachmentField(goTestsFieldTitle, "3 total, 1 passed, 2 failed, 0 skipped"),
+				getLongAttachmentField(packagesFieldTitle, "1 passed, 1 failed, 1 without tests\n• "+apiPackage),
+				getLongAttachmentField(slowestTestsFieldTitle, "• TestSave ("+storePackage+") 1.23s"),
+				getLongAttachmentField(failedGoTestsFieldTitle, "• TestPut ("+apiPackage+")\n• "+brokenPackage),
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []slack.AttachmentField
+			appendGoTestSummaryFields(&got, tt.buildInfo)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("appendGoTestSummaryFields() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_ValidateFailureOutputLines(t *testing.T) {
+	for _, lines := range []int{0, 5} {
+		if err := (&BuildInfo{FailureOutputLines: lines}).ValidateFailureOutputLines(); err != nil {
+			t.Errorf("ValidateFailureOutputLines() unexpected error for %d: %v", lines, err)
+		}
+	}
+	err := (&BuildInfo{FailureOutputLines: -1}).ValidateFailureOutputLines()
+	if err == nil || !strings.Contains(err.Error(), "invalid FAILURE_OUTPUT_LINES -1") {
+		t.Errorf("ValidateFailureOutputLines() error = %v, want invalid FAILURE_OUTPUT_LINES", err)
+	}
+}
+
+func Test_TestSummaryFieldTitlesAreUnique(t *testing.T) {
+	buildInfo := NewBuildInfo("job", "https://ci/1", failureKey)
+	buildInfo.TestSummary = &TestSummary{Total: 1, Failed: 1, Failures: []TestFailure{{Name: "JUnitTest", Message: "failed"}}}
+	buildInfo.GoTestSummary = &GoTestSummary{
+		Tests:    TestSummary{Total: 1, Failed: 1},
+		Failures: []GoTestFailure{{Package: apiPackage, Test: "TestPut"}},
+	}
+	titles := map[string]bool{}
+	for _, field := range RenderSlackAttachment(buildInfo).Fields {
+		if titles[field.Title] {
+			t.Errorf("RenderSlackAttachment() has more than one %q field", field.Title)
+		}
+		titles[field.Title] = true
+	}
+}
@@ -0,0 +1,226 @@
+/*
+ * Copyright (c) 2021, salesforce.com, inc.
+ * All rights reserved.
+ * SPDX-License-Identifier: BSD-3-Clause
+ * For full license text, see the LICENSE file in the repo root or https://opensource.org/licenses/BSD-3-Clause
+ */
+package ciresult
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+const (
+	// historyLockTimeout bounds the wait for other jobs recording to the same history file
+	historyLockTimeout = 30 * time.Second
+	historyLockRetry   = 50 * time.Millisecond
+	// historyLockStale is the age after which a lock is assumed to be left behind by a job which died holding it
+	historyLockStale = 2 * time.Minute
+)
+
+/*
+BuildRecord represents a single build persisted to the history file
+*/
+type BuildRecord struct {
+	JobName     string        `json:"jobName"`
+	Channel     string        `json:"channel,omitempty"`
+	BranchName  string        `json:"branchName,omitempty"`
+	BuildStatus string        `json:"buildStatus"`
+	GitCommit   string        `json:"gitCommit,omitempty"`
+	Coverage    *float64      `json:"coverage,omitempty"`
+	Duration    time.Duration `json:"duration,omitempty"`
+	Timestamp   time.Time     `json:"timestamp"`
+	// BuildURL and Queued are only recorded for builds held during quiet hours
+	BuildURL string `json:"buildUrl,omitempty"`
+	Queued   bool   `json:"queued,omitempty"`
+	// Posted is set when the build was notified, along with the MessageTs of the message posted via the app
+	Posted    bool   `json:"posted,omitempty"`
+	MessageTs string `json:"messageTs,omitempty"`
+}
+
+/*
+History represents the recorded builds of every job sharing a history file
+*/
+type History struct {
+	path    string
+	Records []BuildRecord `json:"records"`
+}
+
+/*
+LoadHistory reads the history file at path, returning an empty History when it doesn't exist yet
+*/
+func LoadHistory(path string) (*History, error) {
+	history := &History{path: path}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return history, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	err = json.Unmarshal(data, history)
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse history file %s: %s", path, err)
+	}
+	return history, nil
+}
+
+/*
+Save writes the history back to its file, dropping records older than retention
+*/
+func (history *History) Save(retention time.Duration) error {
+	if retention > 0 {
+		cutoff := time.Now().Add(-retention)
+		var kept []BuildRecord
+		for _, record := range history.Records {
+			if record.Timestamp.After(cutoff) {
+				kept = append(kept, record)
+			}
+		}
+		history.Records = kept
+	}
+	data, err := json.MarshalIndent(history, "", "  ")
+	if err != nil {
+		return err
+	}
+	// Write to a temporary file first so a concurrent reader never sees a partial file
+	tmp, err := os.CreateTemp(filepath.Dir(history.path), filepath.Base(history.path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	_, err = tmp.Write(data)
+	closeErr := tmp.Close()
+	if err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		_ = os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), history.path)
+}
+
+/*
+Last returns the most recent record for the job and branch matching the predicate, or nil if there isn't one
+*/
+func (history *History) Last(jobName string, branchName string, predicate func(BuildRecord) bool) *BuildRecord {
+	if history == nil {
+		return nil
+	}
+	for i := len(history.Records) - 1; i >= 0; i-- {
+		record := history.Records[i]
+		if record.JobName == jobName && record.BranchName == branchName && predicate(record) {
+			return &record
+		}
+	}
+	return nil
+}
+
+func (record BuildRecord) succeeded() bool {
+	status := statusMap[record.BuildStatus]
+	return status == successStatus || status == fixedStatus
+}
+
+/*
+LoadHistory loads the history file configured via HistoryFile, if any
+*/
+func (buildInfo *BuildInfo) LoadHistory() error {
+	if buildInfo.HistoryFile == "" {
+		return nil
+	}
+	history, err := LoadHistory(buildInfo.HistoryFile)
+	if err != nil {
+		return err
+	}
+	buildInfo.History = history
+	return nil
+}
+
+/*
+RecordHistory appends this build to the history file and saves it. The file is locked and reloaded first, so the
+records of concurrent jobs sharing it are kept.
+*/
+func (buildInfo *BuildInfo) RecordHistory() error {
+	if buildInfo.History == nil {
+		return nil
+	}
+	if buildInfo.History.path == "" {
+		return errors.New("the history wasn't loaded from a file")
+	}
+	record := buildInfo.newBuildRecord(time.Now())
+	unlock, err := lockHistory(buildInfo.History.path)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	history, err := LoadHistory(buildInfo.History.path)
+	if err != nil {
+		return err
+	}
+	history.Records = append(history.Records, record)
+	buildInfo.History = history
+	return history.Save(buildInfo.HistoryRetention)
+}
+
+// lockHistory creates a lock file next to the history file, waiting for other jobs holding it, and returns the
+// function releasing it. Creating the file exclusively works on every platform, unlike advisory locks.
+func lockHistory(path string) (func(), error) {
+	lockPath := path + ".lock"
+	deadline := time.Now().Add(historyLockTimeout)
+	for {
+		file, err := os.OpenFile(lockPath, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644)
+		if err == nil {
+			_ = file.Close()
+			return func() { _ = os.Remove(lockPath) }, nil
+		}
+		if !errors.Is(err, os.ErrExist) {
+			return nil, fmt.Errorf("unable to lock history file: %s", err)
+		}
+		info, err := os.Stat(lockPath)
+		if err == nil && time.Since(info.ModTime()) > historyLockStale {
+			_ = os.Remove(lockPath)
+			continue
+		}
+		if time.Now().After(deadline) {
+			return nil, fmt.Errorf("timed out waiting for %s held by another job", lockPath)
+		}
+		time.Sleep(historyLockRetry)
+	}
+}
+
+func (buildInfo *BuildInfo) newBuildRecord(timestamp time.Time) BuildRecord {
+	record := BuildRecord{
+		JobName:     buildInfo.JobName,
+		Channel:     buildInfo.appChannel(),
+		BranchName:  buildInfo.BranchName,
+		BuildStatus: buildInfo.BuildStatus,
+		GitCommit:   buildInfo.GitCommit,
+		Coverage:    buildInfo.Coverage,
+		Duration:    buildInfo.Duration,
+		Timestamp:   timestamp.UTC(),
+	}
+	if buildInfo.queued {
+		record.BuildURL = buildInfo.BuildURL
+		record.Queued = true
+	}
+	if buildInfo.posted {
+		record.Posted = true
+		if buildInfo.slackMessage != nil {
+			record.MessageTs = buildInfo.slackMessage.timestamp
+		}
+	}
+	return record
+}
+
+// appChannel returns the channel the build is posted to via the app, empty when it's posted via HookURL
+func (buildInfo *BuildInfo) appChannel() string {
+	if buildInfo.OauthToken == "" {
+		return ""
+	}
+	return buildInfo.DestChannelId
+}
@@ -0,0 +1,174 @@
+/*
+ * Copyright (c) 2021, salesforce.com, inc.
+ * All rights reserved.
+ * SPDX-License-Identifier: BSD-3-Clause
+ * For full license text, see the LICENSE file in the repo root or https://opensource.org/licenses/BSD-3-Clause
+ */
+package ciresult
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+func Test_LoadHistory(t *testing.T) {
+	t.Run("missing file is an empty history", func(t *testing.T) {
+		history, err := LoadHistory(filepath.Join(t.TempDir(), "history.json"))
+		if err != nil {
+			t.Fatalf("LoadHistory() unexpected error: %v", err)
+		}
+		if len(history.Records) != 0 {
+			t.Errorf("LoadHistory() records = %v, want none", history.Records)
+		}
+	})
+
+	t.Run("invalid file is an error", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "history.json")
+		err := os.WriteFile(path, []byte("{"), 0o600)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = LoadHistory(path)
+		if err == nil {
+			t.Error("LoadHistory() expected error")
+		}
+	})
+}
+
+func Test_RecordHistory(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "history.json")
+	old := BuildRecord{JobName: jobName, BuildStatus: successKey, Timestamp: time.Now().Add(-48 * time.Hour)}
+	history := &History{path: path, Records: []BuildRecord{old}}
+	err := history.Save(0)
+	if err != nil {
+		t.Fatalf("Save() unexpected error: %v", err)
+	}
+
+	buildInfo := BuildInfo{
+		JobName:          jobName,
+		BranchName:       "main",
+		BuildStatus:      failureKey,
+		GitCommit:        commit,
+		Coverage:         floatPtr(42),
+		OauthToken:       "token",
+		DestChannelId:    "C12345",
+		HistoryFile:      path,
+		HistoryRetention: 24 * time.Hour,
+	}
+	err = buildInfo.LoadHistory()
+	if err != nil {
+		t.Fatalf("LoadHistory() unexpected error: %v", err)
+	}
+	if len(buildInfo.History.Records) != 1 {
+		t.Fatalf("LoadHistory() records = %v, want 1", buildInfo.History.Records)
+	}
+	err = buildInfo.RecordHistory()
+	if err != nil {
+		t.Fatalf("RecordHistory() unexpected error: %v", err)
+	}
+
+	reloaded, err := LoadHistory(path)
+	if err != nil {
+		t.Fatalf("LoadHistory() unexpected error: %v", err)
+	}
+	if len(reloaded.Records) != 1 {
+		t.Fatalf("expected the expired record to be dropped, got %v", reloaded.Records)
+	}
+	record := reloaded.Records[0]
+	if record.JobName != jobName || record.Channel != "C12345" || record.BranchName != "main" || record.BuildStatus != failureKey ||
+		record.GitCommit != commit || record.Coverage == nil || *record.Coverage != 42 {
+		t.Errorf("unexpected record %+v", record)
+	}
+}
+
+func Test_RecordHistoryConcurrently(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "history.json")
+	const jobs = 20
+	var builds []*BuildInfo
+	for i := 0; i < jobs; i++ {
+		buildInfo := &BuildInfo{JobName: fmt.Sprintf("job-%d", i), BuildStatus: successKey, HistoryFile: path}
+		if err := buildInfo.LoadHistory(); err != nil {
+			t.Fatalf("LoadHistory() unexpected error: %v", err)
+		}
+		builds = append(builds, buildInfo)
+	}
+	var wg sync.WaitGroup
+	for _, buildInfo := range builds {
+		wg.Add(1)
+		go func(buildInfo *BuildInfo) {
+			defer wg.Done()
+			if err := buildInfo.RecordHistory(); err != nil {
+				t.Errorf("RecordHistory() unexpected error: %v", err)
+			}
+		}(buildInfo)
+	}
+	wg.Wait()
+
+	history, err := LoadHistory(path)
+	if err != nil {
+		t.Fatalf("LoadHistory() unexpected error: %v", err)
+	}
+	if len(history.Records) != jobs {
+		t.Errorf("expected every job's record to be kept, got %d of %d", len(history.Records), jobs)
+	}
+	if _, err := os.Stat(path + ".lock"); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("expected the lock to be released, got %v", err)
+	}
+}
+
+func Test_RecordHistoryTakesOverStaleLock(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "history.json")
+	if err := os.WriteFile(path+".lock", nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	stale := time.Now().Add(-2 * historyLockStale)
+	if err := os.Chtimes(path+".lock", stale, stale); err != nil {
+		t.Fatal(err)
+	}
+	buildInfo := BuildInfo{JobName: jobName, BuildStatus: successKey, HistoryFile: path}
+	if err := buildInfo.LoadHistory(); err != nil {
+		t.Fatalf("LoadHistory() unexpected error: %v", err)
+	}
+	if err := buildInfo.RecordHistory(); err != nil {
+		t.Fatalf("RecordHistory() unexpected error: %v", err)
+	}
+	history, err := LoadHistory(path)
+	if err != nil || len(history.Records) != 1 {
+		t.Errorf("LoadHistory() = %v, %v, want the build recorded", history, err)
+	}
+}
+
+func Test_RecordHistoryWithoutHistoryFile(t *testing.T) {
+	buildInfo := BuildInfo{JobName: jobName}
+	if err := buildInfo.LoadHistory(); err != nil {
+		t.Errorf("LoadHistory() unexpected error: %v", err)
+	}
+	if err := buildInfo.RecordHistory(); err != nil {
+		t.Errorf("RecordHistory() unexpected error: %v", err)
+	}
+}
+
+func Test_HistoryLast(t *testing.T) {
+	history := &History{Records: []BuildRecord{
+		{JobName: jobName, BranchName: "main", BuildStatus: successKey, GitCommit: "a"},
+		{JobName: jobName, BranchName: "main", BuildStatus: fixedKey, GitCommit: "b"},
+		{JobName: jobName, BranchName: "main", BuildStatus: failureKey, GitCommit: "c"},
+		{JobName: jobName, BranchName: "dev", BuildStatus: successKey, GitCommit: "d"},
+	}}
+	got := history.Last(jobName, "main", BuildRecord.succeeded)
+	if got == nil || got.GitCommit != "b" {
+		t.Errorf("Last() = %v, want commit b", got)
+	}
+	if got := history.Last("missing", "main", BuildRecord.succeeded); got != nil {
+		t.Errorf("Last() = %v, want nil", got)
+	}
+	var empty *History
+	if got := empty.Last(jobName, "main", BuildRecord.succeeded); got != nil {
+		t.Errorf("Last() on nil history = %v, want nil", got)
+	}
+}
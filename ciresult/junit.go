@@ -0,0 +1,202 @@
+/*
+ * Copyright (c) 2021, salesforce.com, inc.
+ * All rights reserved.
+ * SPDX-License-Identifier: BSD-3-Clause
+ * For full license text, see the LICENSE file in the repo root or https://opensource.org/licenses/BSD-3-Clause
+ */
+package ciresult
+
+import (
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"github.com/slack-go/slack"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+const maxFailureMessageLength = 120
+
+var (
+	testsFieldTitle       = "Tests"
+	failedTestsFieldTitle = "Failed Tests"
+)
+
+/*
+TestSummary represents the aggregated results of one or more test reports
+*/
+type TestSummary struct {
+	Total, Passed, Failed, Skipped int
+	Failures                       []TestFailure
+}
+
+/*
+TestFailure represents a single failing test and its (untruncated) failure message
+*/
+type TestFailure struct {
+	Name, Message string
+}
+
+type junitSuite struct {
+	Suites []junitSuite `xml:"testsuite"`
+	Cases  []junitCase  `xml:"testcase"`
+}
+
+type junitCase struct {
+	Name      string       `xml:"name,attr"`
+	ClassName string       `xml:"classname,attr"`
+	Failure   *junitResult `xml:"failure"`
+	Error     *junitResult `xml:"error"`
+	Skipped   *junitResult `xml:"skipped"`
+}
+
+type junitResult struct {
+	Message string `xml:"message,attr"`
+	Text    string `xml:",chardata"`
+}
+
+/*
+LoadTestReports parses the JUnit XML files matched by JunitReports into TestSummary and the
+`go test -json` output referenced by GoTestJson into GoTestSummary
+*/
+func (buildInfo *BuildInfo) LoadTestReports() error {
+	return errors.Join(buildInfo.loadJUnitReports(), buildInfo.loadGoTestReport())
+}
+
+func (buildInfo *BuildInfo) loadJUnitReports() error {
+	if strings.TrimSpace(buildInfo.JunitReports) == "" {
+		return nil
+	}
+	paths, err := expandGlobs(buildInfo.JunitReports)
+	if err != nil {
+		return err
+	}
+	if len(paths) == 0 {
+		return nil
+	}
+	summary := &TestSummary{}
+	for _, path := range paths {
+		err = summary.addJUnitFile(path)
+		if err != nil {
+			return err
+		}
+	}
+	buildInfo.TestSummary = summary
+	return nil
+}
+
+func expandGlobs(patterns string) ([]string, error) {
+	var paths []string
+	for _, pattern := range strings.Split(patterns, ",") {
+		pattern = strings.TrimSpace(pattern)
+		if pattern == "" {
+			continue
+		}
+		matches, err := filepath.Glob(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid report pattern %q: %s", pattern, err)
+		}
+		paths = append(paths, matches...)
+	}
+	sort.Strings(paths)
+	return paths, nil
+}
+
+func (summary *TestSummary) addJUnitFile(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	var suite junitSuite
+	err = xml.Unmarshal(data, &suite)
+	if err != nil {
+		return fmt.Errorf("unable to parse JUnit report %s: %s", path, err)
+	}
+	summary.addJUnitSuite(suite)
+	return nil
+}
+
+func (summary *TestSummary) addJUnitSuite(suite junitSuite) {
+	for _, testCase := range suite.Cases {
+		summary.Total++
+		switch {
+		case testCase.Failure != nil:
+			summary.addFailure(testCase.fullName(), testCase.Failure.summary())
+		case testCase.Error != nil:
+			summary.addFailure(testCase.fullName(), testCase.Error.summary())
+		case testCase.Skipped != nil:
+			summary.Skipped++
+		default:
+			summary.Passed++
+		}
+	}
+	for _, child := range suite.Suites {
+		summary.addJUnitSuite(child)
+	}
+}
+
+func (summary *TestSummary) addFailure(name string, message string) {
+	summary.Failed++
+	summary.Failures = append(summary.Failures, TestFailure{Name: name, Message: message})
+}
+
+func (testCase junitCase) fullName() string {
+	if testCase.ClassName == "" {
+		return testCase.Name
+	}
+	return testCase.ClassName + "." + testCase.Name
+}
+
+func (result junitResult) summary() string {
+	if strings.TrimSpace(result.Message) != "" {
+		return strings.TrimSpace(result.Message)
+	}
+	return strings.TrimSpace(result.Text)
+}
+
+func (summary *TestSummary) countsText() string {
+	return fmt.Sprintf("%d total, %d passed, %d failed, %d skipped",
+		summary.Total, summary.Passed, summary.Failed, summary.Skipped)
+}
+
+func (summary *TestSummary) failuresText(maxFailures int) string {
+	var lines []string
+	for i, failure := range summary.Failures {
+		if i >= maxFailures {
+			lines = append(lines, fmt.Sprintf("...and %d more", len(summary.Failures)-maxFailures))
+			break
+		}
+		line := "• " + mrkdwnEscaper.Replace(failure.Name)
+		message := truncate(firstLine(failure.Message), maxFailureMessageLength)
+		if message != "" {
+			line += ": " + mrkdwnEscaper.Replace(message)
+		}
+		lines = append(lines, line)
+	}
+	return strings.Join(lines, "\n")
+}
+
+func appendTestSummaryFields(attachmentFields *[]slack.AttachmentField, summary *TestSummary, maxFailures int) {
+	if summary == nil {
+		return
+	}
+	appendAttachmentField(attachmentFields, testsFieldTitle, summary.countsText())
+	if maxFailures > 0 && len(summary.Failures) > 0 {
+		*attachmentFields = append(*attachmentFields, getLongAttachmentField(failedTestsFieldTitle, summary.failuresText(maxFailures)))
+	}
+}
+
+func firstLine(text string) string {
+	line, _, _ := strings.Cut(strings.TrimSpace(text), "\n")
+	return strings.TrimSpace(line)
+}
+
+func truncate(text string, maxLength int) string {
+	runes := []rune(text)
+	if len(runes) <= maxLength {
+		return text
+	}
+	return string(runes[:maxLength-1]) + "…"
+}
@@ -0,0 +1,161 @@
+/*
+ * Copyright (c) 2021, salesforce.com, inc.
+ * All rights reserved.
+ * SPDX-License-Identifier: BSD-3-Clause
+ * For full license text, see the LICENSE file in the repo root or https://opensource.org/licenses/BSD-3-Clause
+ */
+package ciresult
+
+import (
+	"github.com/slack-go/slack"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func Test_LoadTestReports(t *testing.T) {
+	tests := []struct {
+		name    string
+		reports string
+		want    *TestSummary
+		wantErr bool
+	}{
+		{
+			"no reports configured",
+			"",
+			nil,
+			false,
+		},
+		{
+			"no reports matched",
+			"testdata/junit/missing-*.xml",
+			nil,
+			false,
+		},
+		{
+			"multiple reports via glob",
+			"testdata/junit/*.xml",
+			&TestSummary{
+				Total:   5,
+				Passed:  2,
+				Failed:  2,
+				Skipped: 1,
+				Failures: []TestFailure{
+					{Name: "com.example.AccountTest.testDelete", Message: "expected 1 but was 2"},
+					{Name: "testLookup", Message: "connection refused\nat Contact.lookup"},
+				},
+			},
+			false,
+		},
+		{
+			"comma separated reports",
+			"testdata/junit/report-b.xml, testdata/junit/report-a.xml",
+			&TestSummary{
+				Total:   5,
+				Passed:  2,
+				Failed:  2,
+				Skipped: 1,
+				Failures: []TestFailure{
+					{Name: "com.example.AccountTest.testDelete", Message: "expected 1 but was 2"},
+					{Name: "testLookup", Message: "connection refused\nat Contact.lookup"},
+				},
+			},
+			false,
+		},
+		{
+			"malformed report",
+			"testdata/junit/malformed.xml.txt",
+			nil,
+			true,
+		},
+		{
+			"bad pattern",
+			"testdata/junit/[",
+			nil,
+			true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			buildInfo := BuildInfo{JunitReports: tt.reports}
+			err := buildInfo.LoadTestReports()
+			if (err != nil) != tt.wantErr {
+				t.Errorf("LoadTestReports() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !reflect.DeepEqual(buildInfo.TestSummary, tt.want) {
+				t.Errorf("LoadTestReports() TestSummary = %+v, want %+v", buildInfo.TestSummary, tt.want)
+			}
+		})
+	}
+}
+
+func Test_appendTestSummaryFields(t *testing.T) {
+	summary := &TestSummary{
+		Total:  4,
+		Passed: 1,
+		Failed: 3,
+		Failures: []TestFailure{
+			{Name: "TestA", Message: "boom\nmore detail"},
+			{Name: "TestB", Message: strings.Repeat("x", maxFailureMessageLength+10)},
+			{Name: "TestC"},
+		},
+	}
+	tests := []struct {
+		name        string
+		summary     *TestSummary
+		maxFailures int
+		want        []slack.AttachmentField
+	}{
+		{
+			"no summary",
+			nil,
+			5,
+			emptyAttachmentFields,
+		},
+		{
+			"counts and all failures",
+			summary,
+			5,
+			[]slack.AttachmentField{
+				getAttachmentField(testsFieldTitle, "4 total, 1 passed, 3 failed, 0 skipped"),
+				getLongAttachmentField(failedTestsFieldTitle, "• TestA: boom\n• TestB: "+strings.Repeat("x", maxFailureMessageLength-1)+"…\n• TestC"),
+			},
+		},
+		{
+			"failures capped",
+			summary,
+			1,
+			[]slack.AttachmentField{
+				getAttachmentField(testsFieldTitle, "4 total, 1 passed, 3 failed, 0 skipped"),
+				getLongAttachmentField(failedTestsFieldTitle, "• TestA: boom\n...and 2 more"),
+			},
+		},
+		{
+			"mrkdwn escaped",
+			&TestSummary{Total: 1, Failed: 1, Failures: []TestFailure{{Name: "Test<T>", Message: "expected <nil|x>, got a &amp; b"}}},
+			5,
+			[]slack.AttachmentField{
+				getAttachmentField(testsFieldTitle, "1 total, 0 passed, 1 failed, 0 skipped"),
+				getLongAttachmentField(failedTestsFieldTitle, "• Test&lt;T&gt;: expected &lt;nil|x&gt;, got a &amp;amp; b"),
+			},
+		},
+		{
+			"failure listing disabled",
+			summary,
+			0,
+			[]slack.AttachmentField{
+				getAttachmentField(testsFieldTitle, "4 total, 1 passed, 3 failed, 0 skipped"),
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []slack.AttachmentField
+			appendTestSummaryFields(&got, tt.summary, tt.maxFailures)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("appendTestSummaryFields() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,110 @@
+/*
+ * Copyright (c) 2021, salesforce.com, inc.
+ * All rights reserved.
+ * SPDX-License-Identifier: BSD-3-Clause
+ * For full license text, see the LICENSE file in the repo root or https://opensource.org/licenses/BSD-3-Clause
+ */
+package ciresult
+
+import (
+	"fmt"
+	"github.com/slack-go/slack"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+const (
+	logExcerptSeparator = "..."
+	logTruncatedNotice  = "[log truncated]\n"
+)
+
+/*
+ShouldUploadLog reports whether a log excerpt should be uploaded alongside the message
+*/
+func (buildInfo *BuildInfo) ShouldUploadLog() bool {
+	status := buildInfo.GetContextualStatus()
+	return strings.TrimSpace(buildInfo.LogFile) != "" && status != successStatus && status != fixedStatus
+}
+
+/*
+ValidateLogMatch returns an error if LogMatch isn't a valid regex or LogMatchContext is negative
+*/
+func (buildInfo *BuildInfo) ValidateLogMatch() error {
+	if buildInfo.LogMatchContext < 0 {
+		return fmt.Errorf("invalid LOG_MATCH_CONTEXT %d, expected 0 or more", buildInfo.LogMatchContext)
+	}
+	if buildInfo.LogMatch == "" {
+		return nil
+	}
+	_, err := regexp.Compile(buildInfo.LogMatch)
+	if err != nil {
+		return fmt.Errorf("invalid LOG_MATCH %q: %s", buildInfo.LogMatch, err)
+	}
+	return nil
+}
+
+/*
+GetLogExcerpt reads LogFile and returns the redacted portion of it selected by LogMatch, LogTailLines and LogMaxBytes
+*/
+func (buildInfo *BuildInfo) GetLogExcerpt() (string, error) {
+	data, err := os.ReadFile(buildInfo.LogFile)
+	if err != nil {
+		return "", err
+	}
+	lines := strings.Split(strings.TrimRight(string(data), "\n"), "\n")
+	if buildInfo.LogMatch != "" {
+		pattern, err := regexp.Compile(buildInfo.LogMatch)
+		if err != nil {
+			return "", fmt.Errorf("invalid LOG_MATCH %q: %s", buildInfo.LogMatch, err)
+		}
+		// Negative context is rejected by Validate, and would drop the matching lines themselves
+		lines = matchingLines(lines, pattern, max(buildInfo.LogMatchContext, 0))
+	}
+	if buildInfo.LogTailLines > 0 && len(lines) > buildInfo.LogTailLines {
+		lines = lines[len(lines)-buildInfo.LogTailLines:]
+	}
+	excerpt := buildInfo.Redact(strings.Join(lines, "\n"))
+	if buildInfo.LogMaxBytes > 0 && len(excerpt) > buildInfo.LogMaxBytes {
+		// Keep the end of the log since that's usually where the failure is
+		excerpt = logTruncatedNotice + strings.ToValidUTF8(excerpt[len(excerpt)-buildInfo.LogMaxBytes:], "")
+	}
+	return excerpt, nil
+}
+
+// matchingLines returns the lines matching pattern along with contextLines either side of them, separating
+// non-contiguous ranges with logExcerptSeparator
+func matchingLines(lines []string, pattern *regexp.Regexp, contextLines int) []string {
+	include := make([]bool, len(lines))
+	for i, line := range lines {
+		if !pattern.MatchString(line) {
+			continue
+		}
+		for j := max(0, i-contextLines); j <= min(len(lines)-1, i+contextLines); j++ {
+			include[j] = true
+		}
+	}
+	var matched []string
+	for i, line := range lines {
+		if !include[i] {
+			continue
+		}
+		if len(matched) > 0 && !include[i-1] {
+			matched = append(matched, logExcerptSeparator)
+		}
+		matched = append(matched, line)
+	}
+	return matched
+}
+
+func getLogUploadParameters(buildInfo BuildInfo, excerpt string, threadTimestamp string) slack.UploadFileParameters {
+	return slack.UploadFileParameters{
+		Content:         excerpt,
+		FileSize:        len(excerpt),
+		Filename:        filepath.Base(buildInfo.LogFile),
+		Title:           buildInfo.Redact(fmt.Sprintf("Log: %s", buildInfo.JobName)),
+		Channel:         buildInfo.DestChannelId,
+		ThreadTimestamp: threadTimestamp,
+	}
+}
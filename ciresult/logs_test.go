@@ -0,0 +1,163 @@
+/*
+ * Copyright (c) 2021, salesforce.com, inc.
+ * All rights reserved.
+ * SPDX-License-Identifier: BSD-3-Clause
+ * For full license text, see the LICENSE file in the repo root or https://opensource.org/licenses/BSD-3-Clause
+ */
+package ciresult
+
+import (
+	"strings"
+	"testing"
+)
+
+const testLogFile = "testdata/logs/build.log"
+
+func Test_GetLogExcerpt(t *testing.T) {
+	tests := []struct {
+		name      string
+		buildInfo BuildInfo
+		want      string
+		wantErr   bool
+	}{
+		{
+			"whole log is redacted",
+			BuildInfo{LogFile: testLogFile},
+			`Started by user admin
+Checking out revision 8675309
+Using token [REDACTED]
+Compiling module a
+Compiling module b
+ERROR: module b failed to compile
+Cleaning up
+Uploading artifacts
+Reticulating splines
+ERROR: artifact upload skipped
+Finished: FAILURE`,
+			false,
+		},
+		{
+			"tail lines",
+			BuildInfo{LogFile: testLogFile, LogTailLines: 2},
+			"ERROR: artifact upload skipped\nFinished: FAILURE",
+			false,
+		},
+		{
+			"matching lines with context",
+			BuildInfo{LogFile: testLogFile, LogMatch: "^ERROR", LogMatchContext: 1},
+			`Compiling module b
+ERROR: module b failed to compile
+Cleaning up
+...
+Reticulating splines
+ERROR: artifact upload skipped
+Finished: FAILURE`,
+			false,
+		},
+		{
+			"matching lines are tailed",
+			BuildInfo{LogFile: testLogFile, LogMatch: "^ERROR", LogTailLines: 1},
+			"ERROR: artifact upload skipped",
+			false,
+		},
+		{
+			"negative context keeps the matching lines",
+			BuildInfo{LogFile: testLogFile, LogMatch: "^ERROR", LogMatchContext: -1},
+			"ERROR: module b failed to compile\n...\nERROR: artifact upload skipped",
+			false,
+		},
+		{
+			"no matching lines",
+			BuildInfo{LogFile: testLogFile, LogMatch: "PANIC"},
+			"",
+			false,
+		},
+		{
+			"size limit keeps the end of the log",
+			BuildInfo{LogFile: testLogFile, LogMaxBytes: 17},
+			logTruncatedNotice + "Finished: FAILURE",
+			false,
+		},
+		{
+			"invalid match",
+			BuildInfo{LogFile: testLogFile, LogMatch: "("},
+			"",
+			true,
+		},
+		{
+			"missing log",
+			BuildInfo{LogFile: "testdata/logs/missing.log"},
+			"",
+			true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.buildInfo.GetLogExcerpt()
+			if (err != nil) != tt.wantErr {
+				t.Errorf("GetLogExcerpt() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if got != tt.want {
+				t.Errorf("GetLogExcerpt() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_ValidateLogMatch(t *testing.T) {
+	if err := (&BuildInfo{LogMatch: "^ERROR"}).ValidateLogMatch(); err != nil {
+		t.Errorf("ValidateLogMatch() unexpected error: %v", err)
+	}
+	if err := (&BuildInfo{LogMatch: "("}).ValidateLogMatch(); err == nil || !strings.Contains(err.Error(), "invalid LOG_MATCH") {
+		t.Errorf("ValidateLogMatch() error = %v, want invalid LOG_MATCH", err)
+	}
+	err := (&BuildInfo{LogMatch: "^ERROR", LogMatchContext: -1}).ValidateLogMatch()
+	if err == nil || !strings.Contains(err.Error(), "invalid LOG_MATCH_CONTEXT -1") {
+		t.Errorf("ValidateLogMatch() error = %v, want invalid LOG_MATCH_CONTEXT", err)
+	}
+}
+
+func Test_GetBuildInfoFromEnvRejectsInvalidLogMatch(t *testing.T) {
+	t.Setenv("HOOK_URL", "test")
+	t.Setenv("JOB_NAME", "test")
+	t.Setenv("BUILD_STATUS", "test")
+	t.Setenv("BUILD_URL", "test")
+	t.Setenv("LOG_MATCH", "(")
+	_, err := GetBuildInfoFromEnv()
+	if err == nil {
+		t.Error("Expected error for invalid LOG_MATCH")
+	}
+}
+
+func Test_ShouldUploadLog(t *testing.T) {
+	tests := []struct {
+		name      string
+		buildInfo BuildInfo
+		want      bool
+	}{
+		{"no log file", BuildInfo{BuildStatus: failureKey}, false},
+		{"failure", BuildInfo{BuildStatus: failureKey, LogFile: testLogFile}, true},
+		{"still failing", BuildInfo{BuildStatus: failureKey, LastBuildStatus: failureKey, LogFile: testLogFile}, true},
+		{"unstable", BuildInfo{BuildStatus: unstableKey, LogFile: testLogFile}, true},
+		{"success", BuildInfo{BuildStatus: successKey, LogFile: testLogFile}, false},
+		{"fixed", BuildInfo{BuildStatus: successKey, LastBuildStatus: failureKey, LogFile: testLogFile}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.buildInfo.ShouldUploadLog(); got != tt.want {
+				t.Errorf("ShouldUploadLog() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_getLogUploadParameters(t *testing.T) {
+	buildInfo := BuildInfo{JobName: jobName, LogFile: testLogFile, DestChannelId: "C12345"}
+	excerpt := strings.Repeat("x", 10)
+	got := getLogUploadParameters(buildInfo, excerpt, "1234.5678")
+	if got.Filename != "build.log" || got.Channel != "C12345" || got.ThreadTimestamp != "1234.5678" ||
+		got.Content != excerpt || got.FileSize != 10 || got.Title != "Log: "+jobName {
+		t.Errorf("getLogUploadParameters() = %+v", got)
+	}
+}
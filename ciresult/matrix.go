@@ -0,0 +1,178 @@
+/*
+ * Copyright (c) 2021, salesforce.com, inc.
+ * All rights reserved.
+ * SPDX-License-Identifier: BSD-3-Clause
+ * For full license text, see the LICENSE file in the repo root or https://opensource.org/licenses/BSD-3-Clause
+ */
+package ciresult
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/slack-go/slack"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+var (
+	matrixFieldTitle = "Matrix"
+
+	MatrixConfigErrorMessage = "please specify MATRIX_STORE and MATRIX_RUN_ID to aggregate matrix results"
+
+	unsafeFileNameChars = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+
+	// statusSeverity orders statuses from best to worst when aggregating matrix cells
+	statusSeverity = map[Status]int{
+		successStatus:      0,
+		fixedStatus:        0,
+		unknownStatus:      1,
+		unstableStatus:     2,
+		failedStatus:       3,
+		stillFailingStatus: 3,
+	}
+)
+
+/*
+MatrixCellResult represents the result one matrix cell recorded for the collecting invocation
+*/
+type MatrixCellResult struct {
+	Cell        string        `json:"cell"`
+	BuildStatus string        `json:"buildStatus"`
+	BuildURL    string        `json:"buildUrl,omitempty"`
+	Duration    time.Duration `json:"duration,omitempty"`
+	Timestamp   time.Time     `json:"timestamp"`
+}
+
+/*
+IsMatrixCell reports whether this invocation records a matrix cell's result instead of posting
+*/
+func (buildInfo *BuildInfo) IsMatrixCell() bool {
+	return strings.TrimSpace(buildInfo.MatrixCell) != ""
+}
+
+func (buildInfo *BuildInfo) matrixRunDir() (string, error) {
+	if strings.TrimSpace(buildInfo.MatrixStore) == "" || strings.TrimSpace(buildInfo.MatrixRunId) == "" {
+		return "", errors.New(MatrixConfigErrorMessage)
+	}
+	return filepath.Join(buildInfo.MatrixStore, safeFileName(buildInfo.MatrixRunId)), nil
+}
+
+// safeFileName returns a readable file name for name, made unique by a hash of name since different names (e.g.
+// linux/go1.25 and linux_go1.25) can have the same readable part
+func safeFileName(name string) string {
+	hash := sha256.Sum256([]byte(name))
+	return strings.Trim(unsafeFileNameChars.ReplaceAllString(name, "_"), "_.") + "-" + hex.EncodeToString(hash[:6])
+}
+
+/*
+RecordMatrixCell stores this cell's result in the shared MatrixStore for a later CollectMatrix
+*/
+func (buildInfo *BuildInfo) RecordMatrixCell() error {
+	runDir, err := buildInfo.matrixRunDir()
+	if err != nil {
+		return err
+	}
+	err = os.MkdirAll(runDir, 0o755)
+	if err != nil {
+		return err
+	}
+	result := MatrixCellResult{
+		Cell:        buildInfo.MatrixCell,
+		BuildStatus: buildInfo.BuildStatus,
+		BuildURL:    buildInfo.BuildURL,
+		Duration:    buildInfo.Duration,
+		Timestamp:   time.Now().UTC(),
+	}
+	data, err := json.MarshalIndent(result, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(runDir, safeFileName(buildInfo.MatrixCell)+".json"), data, 0o644)
+}
+
+/*
+CollectMatrix loads every cell recorded for MatrixRunId and sets BuildStatus to the worst of them (and of the
+BuildStatus passed in, unless it's UNKNOWN)
+*/
+func (buildInfo *BuildInfo) CollectMatrix() error {
+	runDir, err := buildInfo.matrixRunDir()
+	if err != nil {
+		return err
+	}
+	paths, err := filepath.Glob(filepath.Join(runDir, "*.json"))
+	if err != nil {
+		return err
+	}
+	if len(paths) == 0 {
+		return fmt.Errorf("no matrix results recorded for run %s in %s", buildInfo.MatrixRunId, buildInfo.MatrixStore)
+	}
+	var cells []MatrixCellResult
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		var cell MatrixCellResult
+		err = json.Unmarshal(data, &cell)
+		if err != nil {
+			return fmt.Errorf("unable to parse matrix result %s: %s", path, err)
+		}
+		cells = append(cells, cell)
+	}
+	sort.Slice(cells, func(i, j int) bool { return cells[i].Cell < cells[j].Cell })
+
+	overall := buildInfo.BuildStatus
+	if _, present := statusMap[overall]; !present || overall == unknownKey {
+		overall = cells[0].BuildStatus
+	}
+	for _, cell := range cells {
+		if statusSeverity[statusOf(cell.BuildStatus)] > statusSeverity[statusOf(overall)] {
+			overall = cell.BuildStatus
+		}
+	}
+	buildInfo.BuildStatus = overall
+	buildInfo.MatrixCells = cells
+	return nil
+}
+
+func statusOf(key string) Status {
+	status, present := statusMap[key]
+	if !present {
+		return defaultStatus
+	}
+	return status
+}
+
+func (buildInfo *BuildInfo) matrixCellText(cell MatrixCellResult) string {
+	emoji, present := stageEmoji[strings.ToUpper(cell.BuildStatus)]
+	if !present {
+		emoji = defaultStageEmoji
+	}
+	name := mrkdwnEscaper.Replace(cell.Cell)
+	if cell.BuildURL != "" && cell.BuildURL != buildInfo.BuildURL {
+		name = slackLink(cell.BuildURL, cell.Cell)
+	}
+	text := fmt.Sprintf("%s %s — %s", emoji, name, statusOf(cell.BuildStatus).text)
+	if cell.Duration > 0 {
+		text += " (" + formatDuration(cell.Duration) + ")"
+	}
+	return text
+}
+
+func appendMatrixField(attachmentFields *[]slack.AttachmentField, buildInfo BuildInfo) {
+	if len(buildInfo.MatrixCells) == 0 {
+		return
+	}
+	var lines []string
+	for _, cell := range buildInfo.MatrixCells {
+		lines = append(lines, buildInfo.matrixCellText(cell))
+	}
+	*attachmentFields = append(*attachmentFields, getLongAttachmentField(matrixFieldTitle, strings.Join(lines, "\n")))
+}
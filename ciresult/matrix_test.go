@@ -0,0 +1,185 @@
+/*
+ * Copyright (c) 2021, salesforce.com, inc.
+ * All rights reserved.
+ * SPDX-License-Identifier: BSD-3-Clause
+ * For full license text, see the LICENSE file in the repo root or https://opensource.org/licenses/BSD-3-Clause
+ */
+package ciresult
+
+import (
+	"github.com/slack-go/slack"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func recordCells(t *testing.T, store string, runId string, cells map[string]string) {
+	t.Helper()
+	for cell, status := range cells {
+		buildInfo := BuildInfo{MatrixStore: store, MatrixRunId: runId, MatrixCell: cell, BuildStatus: status}
+		err := buildInfo.RecordMatrixCell()
+		if err != nil {
+			t.Fatalf("RecordMatrixCell() unexpected error: %v", err)
+		}
+	}
+}
+
+func Test_RecordMatrixCell(t *testing.T) {
+	store := t.TempDir()
+	buildInfo := BuildInfo{
+		MatrixStore: store,
+		MatrixRunId: "build/42",
+		MatrixCell:  "linux / go1.25",
+		BuildStatus: successKey,
+		BuildURL:    "https://ci/linux",
+		Duration:    time.Minute,
+	}
+	err := buildInfo.RecordMatrixCell()
+	if err != nil {
+		t.Fatalf("RecordMatrixCell() unexpected error: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(store, safeFileName("build/42"), safeFileName("linux / go1.25")+".json")); err != nil {
+		t.Errorf("expected the cell to be recorded under a safe file name: %v", err)
+	}
+
+	collector := BuildInfo{MatrixStore: store, MatrixRunId: "build/42", BuildStatus: unknownKey}
+	err = collector.CollectMatrix()
+	if err != nil {
+		t.Fatalf("CollectMatrix() unexpected error: %v", err)
+	}
+	if len(collector.MatrixCells) != 1 {
+		t.Fatalf("CollectMatrix() MatrixCells = %+v, want one cell", collector.MatrixCells)
+	}
+	got := collector.MatrixCells[0]
+	got.Timestamp = time.Time{}
+	want := MatrixCellResult{Cell: "linux / go1.25", BuildStatus: successKey, BuildURL: "https://ci/linux", Duration: time.Minute}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("CollectMatrix() cell = %+v, want %+v", got, want)
+	}
+}
+
+func Test_safeFileName(t *testing.T) {
+	names := []string{"linux/go1.25", "linux_go1.25", "linux go1.25", "../linux/go1.25"}
+	seen := map[string]string{}
+	for _, name := range names {
+		fileName := safeFileName(name)
+		if !strings.HasPrefix(fileName, "linux_go1.25-") {
+			t.Errorf("safeFileName(%q) = %q, want it to start with linux_go1.25-", name, fileName)
+		}
+		if other, present := seen[fileName]; present {
+			t.Errorf("safeFileName(%q) = safeFileName(%q) = %q", name, other, fileName)
+		}
+		seen[fileName] = name
+	}
+}
+
+func Test_CollectMatrixKeepsCellsWithSimilarNames(t *testing.T) {
+	store := t.TempDir()
+	recordCells(t, store, "42", map[string]string{"linux/go1.25": failureKey, "linux_go1.25": successKey})
+	collector := BuildInfo{MatrixStore: store, MatrixRunId: "42", BuildStatus: unknownKey}
+	err := collector.CollectMatrix()
+	if err != nil {
+		t.Fatalf("CollectMatrix() unexpected error: %v", err)
+	}
+	if len(collector.MatrixCells) != 2 || collector.BuildStatus != failureKey {
+		t.Errorf("CollectMatrix() = %s with cells %+v, want FAILURE with both cells", collector.BuildStatus, collector.MatrixCells)
+	}
+}
+
+func Test_CollectMatrix(t *testing.T) {
+	tests := []struct {
+		name        string
+		cells       map[string]string
+		buildStatus string
+		want        string
+	}{
+		{"all succeeded", map[string]string{"a": successKey, "b": successKey}, unknownKey, successKey},
+		{"one unstable", map[string]string{"a": successKey, "b": unstableKey}, unknownKey, unstableKey},
+		{"one failed", map[string]string{"a": unstableKey, "b": failureKey, "c": successKey}, unknownKey, failureKey},
+		{"unrecognized cell status", map[string]string{"a": successKey, "b": "ABORTED"}, unknownKey, "ABORTED"},
+		{"worse incoming status wins", map[string]string{"a": successKey}, failureKey, failureKey},
+		{"better incoming status loses", map[string]string{"a": unstableKey}, successKey, unstableKey},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := t.TempDir()
+			recordCells(t, store, "run", tt.cells)
+			buildInfo := BuildInfo{MatrixStore: store, MatrixRunId: "run", BuildStatus: tt.buildStatus}
+			err := buildInfo.CollectMatrix()
+			if err != nil {
+				t.Fatalf("CollectMatrix() unexpected error: %v", err)
+			}
+			if buildInfo.BuildStatus != tt.want {
+				t.Errorf("CollectMatrix() BuildStatus = %v, want %v", buildInfo.BuildStatus, tt.want)
+			}
+			if len(buildInfo.MatrixCells) != len(tt.cells) {
+				t.Errorf("CollectMatrix() MatrixCells = %+v, want %d cells", buildInfo.MatrixCells, len(tt.cells))
+			}
+		})
+	}
+}
+
+func Test_CollectMatrixErrors(t *testing.T) {
+	store := t.TempDir()
+	recordCells(t, store, "run", map[string]string{"a": successKey})
+	err := os.MkdirAll(filepath.Join(store, "broken"), 0o755)
+	if err == nil {
+		err = os.WriteFile(filepath.Join(store, "broken", "a.json"), []byte("{"), 0o644)
+	}
+	if err != nil {
+		t.Fatalf("unable to write invalid result: %v", err)
+	}
+
+	tests := []struct {
+		name      string
+		buildInfo BuildInfo
+	}{
+		{"missing store", BuildInfo{MatrixRunId: "run"}},
+		{"missing run id", BuildInfo{MatrixStore: store}},
+		{"nothing recorded", BuildInfo{MatrixStore: store, MatrixRunId: "other"}},
+		{"invalid result", BuildInfo{MatrixStore: store, MatrixRunId: "broken"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.buildInfo.CollectMatrix(); err == nil {
+				t.Errorf("CollectMatrix() expected an error")
+			}
+		})
+	}
+	if err := (&BuildInfo{MatrixCell: "a"}).RecordMatrixCell(); err == nil || err.Error() != MatrixConfigErrorMessage {
+		t.Errorf("RecordMatrixCell() err = %v, want %v", err, MatrixConfigErrorMessage)
+	}
+}
+
+func Test_appendMatrixField(t *testing.T) {
+	tests := []struct {
+		name      string
+		buildInfo BuildInfo
+		want      []slack.AttachmentField
+	}{
+		{"no matrix", BuildInfo{}, emptyAttachmentFields},
+		{
+			"cells",
+			BuildInfo{BuildURL: "https://ci/run", MatrixCells: []MatrixCellResult{
+				{Cell: "linux", BuildStatus: successKey, BuildURL: "https://ci/run", Duration: 63 * time.Second},
+				{Cell: "mac & arm", BuildStatus: failureKey, BuildURL: "https://ci/mac"},
+				{Cell: "windows", BuildStatus: "ABORTED"},
+			}},
+			[]slack.AttachmentField{getLongAttachmentField(matrixFieldTitle, `:white_check_mark: linux — Success (1m 3s)
+:x: <https://ci/mac|mac &amp; arm> — Failed
+:no_entry_sign: windows — Unknown`)},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []slack.AttachmentField
+			appendMatrixField(&got, tt.buildInfo)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("appendMatrixField() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,22 @@
+/*
+ * Copyright (c) 2021, salesforce.com, inc.
+ * All rights reserved.
+ * SPDX-License-Identifier: BSD-3-Clause
+ * For full license text, see the LICENSE file in the repo root or https://opensource.org/licenses/BSD-3-Clause
+ */
+package ciresult
+
+import "github.com/slack-go/slack"
+
+/*
+getMattermostMessage renders the same attachment sent to Slack for Mattermost's Slack-compatible incoming webhooks.
+Links and escapes are converted to Markdown, which Mattermost renders instead of mrkdwn, while emoji codes are kept.
+*/
+func getMattermostMessage(buildInfo BuildInfo, buildStatus Status) slack.WebhookMessage {
+	attachment := getAttachment(buildInfo, buildStatus)
+	attachment.Color = attachmentColorHex(attachment.Color)
+	for i := range attachment.Fields {
+		attachment.Fields[i].Value = slackLinksToMarkdown(attachment.Fields[i].Value)
+	}
+	return slack.WebhookMessage{Attachments: []slack.Attachment{attachment}}
+}
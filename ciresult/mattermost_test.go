@@ -0,0 +1,83 @@
+/*
+ * Copyright (c) 2021, salesforce.com, inc.
+ * All rights reserved.
+ * SPDX-License-Identifier: BSD-3-Clause
+ * For full license text, see the LICENSE file in the repo root or https://opensource.org/licenses/BSD-3-Clause
+ */
+package ciresult
+
+import (
+	"context"
+	"github.com/slack-go/slack"
+	"net/http"
+	"reflect"
+	"testing"
+)
+
+func Test_getMattermostMessage(t *testing.T) {
+	tests := []struct {
+		name        string
+		buildInfo   BuildInfo
+		buildStatus Status
+		want        slack.WebhookMessage
+	}{
+		{
+			"required fields only",
+			BuildInfo{JobName: jobName, BuildURL: buildURL, BuildStatus: successKey},
+			successStatus,
+			slack.WebhookMessage{Attachments: []slack.Attachment{
+				{Title: "Success: " + jobName, TitleLink: buildURL, Color: "#2EB886"},
+			}},
+		},
+		{
+			"fields keep emoji codes but use markdown links",
+			BuildInfo{
+				JobName:     jobName,
+				BuildStatus: unstableKey,
+				BranchName:  branchName,
+				Stages:      []Stage{{Name: "Lint & Vet", Status: unstableKey}},
+				PrNumber:    "7",
+				PrUrl:       "https://example.com/pr/7",
+			},
+			unstableStatus,
+			slack.WebhookMessage{Attachments: []slack.Attachment{{
+				Title: "Unstable: " + jobName,
+				Color: "#DAA038",
+				Fields: []slack.AttachmentField{
+					branchNameField,
+					getLongAttachmentField(pullRequestFieldTitle, "[#7](https://example.com/pr/7)"),
+					getLongAttachmentField(stagesFieldTitle, ":warning: Lint & Vet"),
+				},
+			}}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := getMattermostMessage(tt.buildInfo, tt.buildStatus); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("getMattermostMessage() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_productionSlackClientWorker_postMattermostMessage(t *testing.T) {
+	var capturedURL string
+	var capturedMsg *slack.WebhookMessage
+	worker := &productionSlackClientWorker{
+		jsonPoster: func(ctx context.Context, httpClient *http.Client, url string, payload interface{}) error {
+			capturedURL = url
+			capturedMsg, _ = payload.(*slack.WebhookMessage)
+			return nil
+		},
+	}
+	err := worker.postMattermostMessage(context.Background(), BuildInfo{JobName: "job", BuildStatus: failureKey, MattermostHookUrl: "https://mattermost/hooks/abc"})
+	if err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if capturedURL != "https://mattermost/hooks/abc" {
+		t.Errorf("expected URL %q, got %q", "https://mattermost/hooks/abc", capturedURL)
+	}
+	if capturedMsg == nil || capturedMsg.Attachments[0].Title != "Failed: job" {
+		t.Errorf("expected the build in the attachment, got %+v", capturedMsg)
+	}
+}
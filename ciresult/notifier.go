@@ -0,0 +1,295 @@
+/*
+ * Copyright (c) 2021, salesforce.com, inc.
+ * All rights reserved.
+ * SPDX-License-Identifier: BSD-3-Clause
+ * For full license text, see the LICENSE file in the repo root or https://opensource.org/licenses/BSD-3-Clause
+ */
+package ciresult
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"time"
+)
+
+/*
+ErrFiltered is returned by notifiers wrapped with Filter when the predicate rejects the build, and by Pipeline.Notify
+when every backend rejected it
+*/
+var ErrFiltered = errors.New("delivery filtered")
+
+/*
+Notifier delivers a build result to a single destination
+*/
+type Notifier interface {
+	Name() string
+	Notify(ctx context.Context, buildInfo BuildInfo) error
+}
+
+type notifierFunc struct {
+	name   string
+	notify func(ctx context.Context, buildInfo BuildInfo) error
+}
+
+func (notifier notifierFunc) Name() string {
+	return notifier.name
+}
+
+func (notifier notifierFunc) Notify(ctx context.Context, buildInfo BuildInfo) error {
+	return notifier.notify(ctx, buildInfo)
+}
+
+/*
+NewNotifier returns a Notifier calling notify
+*/
+func NewNotifier(name string, notify func(ctx context.Context, buildInfo BuildInfo) error) Notifier {
+	return notifierFunc{name: name, notify: notify}
+}
+
+/*
+NotifierFactory returns the Notifier for a backend, or nil when the build doesn't configure that backend
+*/
+type NotifierFactory func(buildInfo BuildInfo) Notifier
+
+/*
+Registry holds the available backends in the order they're notified
+*/
+type Registry struct {
+	names     []string
+	factories map[string]NotifierFactory
+}
+
+/*
+NewRegistry returns an empty Registry
+*/
+func NewRegistry() *Registry {
+	return &Registry{factories: map[string]NotifierFactory{}}
+}
+
+/*
+Register adds a backend, replacing any backend already registered under name while keeping its position
+*/
+func (registry *Registry) Register(name string, factory NotifierFactory) {
+	if _, present := registry.factories[name]; !present {
+		registry.names = append(registry.names, name)
+	}
+	registry.factories[name] = factory
+}
+
+/*
+Unregister removes the backend registered under name, if any
+*/
+func (registry *Registry) Unregister(name string) {
+	if _, present := registry.factories[name]; !present {
+		return
+	}
+	delete(registry.factories, name)
+	for i, registered := range registry.names {
+		if registered == name {
+			registry.names = append(registry.names[:i], registry.names[i+1:]...)
+			break
+		}
+	}
+}
+
+/*
+Names returns the names of the registered backends
+*/
+func (registry *Registry) Names() []string {
+	return append([]string(nil), registry.names...)
+}
+
+/*
+Notifiers returns a Notifier for every registered backend the build configures
+*/
+func (registry *Registry) Notifiers(buildInfo BuildInfo) []Notifier {
+	var notifiers []Notifier
+	for _, name := range registry.names {
+		notifier := registry.factories[name](buildInfo)
+		if notifier != nil {
+			notifiers = append(notifiers, notifier)
+		}
+	}
+	return notifiers
+}
+
+/*
+Middleware wraps a Notifier to change how, or whether, it delivers
+*/
+type Middleware func(next Notifier) Notifier
+
+/*
+Chain wraps notifier with middleware, the first of which sees the build first
+*/
+func Chain(notifier Notifier, middleware ...Middleware) Notifier {
+	for i := len(middleware) - 1; i >= 0; i-- {
+		notifier = middleware[i](notifier)
+	}
+	return notifier
+}
+
+/*
+Filter skips delivery, returning ErrFiltered, when predicate returns false
+*/
+func Filter(predicate func(buildInfo BuildInfo) bool) Middleware {
+	return func(next Notifier) Notifier {
+		return NewNotifier(next.Name(), func(ctx context.Context, buildInfo BuildInfo) error {
+			if !predicate(buildInfo) {
+				return ErrFiltered
+			}
+			return next.Notify(ctx, buildInfo)
+		})
+	}
+}
+
+/*
+Enrich lets enrich modify the build before delivery, aborting delivery if it returns an error
+*/
+func Enrich(enrich func(ctx context.Context, buildInfo *BuildInfo) error) Middleware {
+	return func(next Notifier) Notifier {
+		return NewNotifier(next.Name(), func(ctx context.Context, buildInfo BuildInfo) error {
+			err := enrich(ctx, &buildInfo)
+			if err != nil {
+				return err
+			}
+			return next.Notify(ctx, buildInfo)
+		})
+	}
+}
+
+/*
+Redact masks matches of patterns in everything delivered, in addition to REDACT_PATTERNS
+*/
+func Redact(patterns ...*regexp.Regexp) Middleware {
+	return func(next Notifier) Notifier {
+		return NewNotifier(next.Name(), func(ctx context.Context, buildInfo BuildInfo) error {
+			buildInfo.redactors = append(append([]*regexp.Regexp(nil), buildInfo.redactors...), patterns...)
+			return next.Notify(ctx, buildInfo)
+		})
+	}
+}
+
+/*
+Retry makes up to attempts deliveries, waiting delay after the first failure and doubling it after each further one.
+It stops waiting when ctx is done and doesn't retry filtered deliveries.
+*/
+func Retry(attempts int, delay time.Duration) Middleware {
+	return func(next Notifier) Notifier {
+		return NewNotifier(next.Name(), func(ctx context.Context, buildInfo BuildInfo) error {
+			wait := delay
+			for attempt := 1; ; attempt++ {
+				err := next.Notify(ctx, buildInfo)
+				if err == nil || errors.Is(err, ErrFiltered) || attempt >= attempts {
+					return err
+				}
+				timer := time.NewTimer(wait)
+				select {
+				case <-ctx.Done():
+					timer.Stop()
+					return err
+				case <-timer.C:
+				}
+				wait *= 2
+			}
+		})
+	}
+}
+
+/*
+Pipeline delivers builds to every backend of its Registry the build configures, through its Middleware
+*/
+type Pipeline struct {
+	Registry   *Registry
+	Middleware []Middleware
+}
+
+/*
+Use appends middleware to the pipeline
+*/
+func (pipeline *Pipeline) Use(middleware ...Middleware) {
+	pipeline.Middleware = append(pipeline.Middleware, middleware...)
+}
+
+/*
+Notify delivers the build to every configured backend, returning the errors of all failed deliveries, or ErrFiltered
+when every backend filtered the build
+*/
+func (pipeline *Pipeline) Notify(ctx context.Context, buildInfo BuildInfo) error {
+	_, err := pipeline.deliver(ctx, buildInfo)
+	return err
+}
+
+// deliver is Notify, also returning the number of backends the build was delivered to
+func (pipeline *Pipeline) deliver(ctx context.Context, buildInfo BuildInfo) (int, error) {
+	notifiers := pipeline.Registry.Notifiers(buildInfo)
+	if len(notifiers) == 0 {
+		return 0, errors.New(PickRunModeErrorMessage)
+	}
+	var delivered, filtered int
+	var errs []error
+	for _, notifier := range notifiers {
+		err := pipeline.notify(ctx, notifier, buildInfo)
+		switch {
+		case err == nil:
+			delivered++
+		case errors.Is(err, ErrFiltered):
+			filtered++
+		default:
+			errs = append(errs, err)
+		}
+	}
+	if filtered == len(notifiers) {
+		return 0, ErrFiltered
+	}
+	return delivered, errors.Join(errs...)
+}
+
+// notify delivers the build to a single notifier through the pipeline's middleware
+func (pipeline *Pipeline) notify(ctx context.Context, notifier Notifier, buildInfo BuildInfo) error {
+	return Chain(notifier, pipeline.Middleware...).Notify(ctx, buildInfo)
+}
+
+/*
+newBuiltinRegistry registers the Slack, Teams, Discord, Mattermost, webhook and email backends delivered through
+transport
+*/
+func newBuiltinRegistry(transport slackClient) *Registry {
+	registry := NewRegistry()
+	registry.Register("slack", func(buildInfo BuildInfo) Notifier {
+		if buildInfo.OauthToken != "" && buildInfo.DestChannelId != "" {
+			return NewNotifier("Slack", transport.postChannelMessage)
+		} else if buildInfo.HookURL != "" {
+			return NewNotifier("Slack", transport.postWebhookMessage)
+		}
+		return nil
+	})
+	for _, backend := range []struct {
+		name        string
+		displayName string
+		url         func(buildInfo BuildInfo) string
+		post        func(ctx context.Context, buildInfo BuildInfo) error
+	}{
+		{"teams", "Teams", func(buildInfo BuildInfo) string { return buildInfo.TeamsHookUrl }, transport.postTeamsMessage},
+		{"discord", "Discord", func(buildInfo BuildInfo) string { return buildInfo.DiscordHookUrl }, transport.postDiscordMessage},
+		{"mattermost", "Mattermost", func(buildInfo BuildInfo) string { return buildInfo.MattermostHookUrl }, transport.postMattermostMessage},
+		{"webhook", "webhook", func(buildInfo BuildInfo) string { return buildInfo.WebhookUrl }, transport.postGenericWebhook},
+		{"email", "email", func(buildInfo BuildInfo) string { return buildInfo.EmailTo }, transport.sendEmail},
+	} {
+		backend := backend
+		registry.Register(backend.name, func(buildInfo BuildInfo) Notifier {
+			if backend.url(buildInfo) == "" {
+				return nil
+			}
+			return NewNotifier(backend.displayName, func(ctx context.Context, buildInfo BuildInfo) error {
+				err := backend.post(ctx, buildInfo)
+				if err != nil {
+					return fmt.Errorf("unable to post to %s: %w", backend.displayName, err)
+				}
+				return nil
+			})
+		})
+	}
+	return registry
+}
@@ -0,0 +1,232 @@
+/*
+ * Copyright (c) 2021, salesforce.com, inc.
+ * All rights reserved.
+ * SPDX-License-Identifier: BSD-3-Clause
+ * For full license text, see the LICENSE file in the repo root or https://opensource.org/licenses/BSD-3-Clause
+ */
+package ciresult
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"regexp"
+	"testing"
+	"time"
+)
+
+// recordingNotifier records the builds it's asked to deliver, failing the first failures of them
+type recordingNotifier struct {
+	name     string
+	builds   []BuildInfo
+	failures int
+}
+
+func (notifier *recordingNotifier) Name() string {
+	return notifier.name
+}
+
+func (notifier *recordingNotifier) Notify(ctx context.Context, buildInfo BuildInfo) error {
+	notifier.builds = append(notifier.builds, buildInfo)
+	if len(notifier.builds) <= notifier.failures {
+		return errors.New(notifier.name + " failed")
+	}
+	return nil
+}
+
+func Test_Registry(t *testing.T) {
+	registry := NewRegistry()
+	always := func(name string) NotifierFactory {
+		return func(buildInfo BuildInfo) Notifier { return &recordingNotifier{name: name} }
+	}
+	registry.Register("a", always("a"))
+	registry.Register("b", func(buildInfo BuildInfo) Notifier {
+		if buildInfo.JobName != "b" {
+			return nil
+		}
+		return &recordingNotifier{name: "b"}
+	})
+	registry.Register("c", always("c"))
+	registry.Register("a", always("replaced a"))
+	registry.Unregister("c")
+	registry.Unregister("missing")
+
+	if got := registry.Names(); !reflect.DeepEqual(got, []string{"a", "b"}) {
+		t.Errorf("Names() = %v, want [a b]", got)
+	}
+	names := func(notifiers []Notifier) []string {
+		var names []string
+		for _, notifier := range notifiers {
+			names = append(names, notifier.Name())
+		}
+		return names
+	}
+	if got := names(registry.Notifiers(BuildInfo{JobName: "b"})); !reflect.DeepEqual(got, []string{"replaced a", "b"}) {
+		t.Errorf("Notifiers() = %v, want [replaced a b]", got)
+	}
+	if got := names(registry.Notifiers(BuildInfo{})); !reflect.DeepEqual(got, []string{"replaced a"}) {
+		t.Errorf("Notifiers() = %v, want [replaced a]", got)
+	}
+}
+
+func Test_Chain(t *testing.T) {
+	var order []string
+	tag := func(name string) Middleware {
+		return Enrich(func(ctx context.Context, buildInfo *BuildInfo) error {
+			order = append(order, name)
+			buildInfo.TriggeredBy += name
+			return nil
+		})
+	}
+	notifier := &recordingNotifier{name: "n"}
+	err := Chain(notifier, tag("1"), tag("2")).Notify(context.Background(), BuildInfo{})
+	if err != nil {
+		t.Fatalf("Notify() unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(order, []string{"1", "2"}) || notifier.builds[0].TriggeredBy != "12" {
+		t.Errorf("expected middleware to run in order, got %v and %q", order, notifier.builds[0].TriggeredBy)
+	}
+	if Chain(notifier, tag("3")).Name() != "n" {
+		t.Errorf("expected middleware to keep the notifier's name")
+	}
+}
+
+func Test_Filter(t *testing.T) {
+	notifier := &recordingNotifier{name: "n"}
+	onlyFailures := Chain(notifier, Filter(func(buildInfo BuildInfo) bool {
+		return buildInfo.GetContextualStatus() != successStatus
+	}))
+	if err := onlyFailures.Notify(context.Background(), BuildInfo{BuildStatus: successKey}); !errors.Is(err, ErrFiltered) {
+		t.Errorf("Notify() of a rejected build error = %v, want %v", err, ErrFiltered)
+	}
+	if err := onlyFailures.Notify(context.Background(), BuildInfo{BuildStatus: failureKey}); err != nil {
+		t.Errorf("Notify() unexpected error: %v", err)
+	}
+	if len(notifier.builds) != 1 || notifier.builds[0].BuildStatus != failureKey {
+		t.Errorf("expected only the failure to be delivered, got %+v", notifier.builds)
+	}
+}
+
+func Test_RetryDoesNotRetryFiltered(t *testing.T) {
+	notifier := &recordingNotifier{name: "n"}
+	rejectAll := Filter(func(buildInfo BuildInfo) bool { return false })
+	err := Chain(notifier, Retry(3, time.Hour), rejectAll).Notify(context.Background(), BuildInfo{})
+	if !errors.Is(err, ErrFiltered) || len(notifier.builds) != 0 {
+		t.Errorf("expected a single filtered attempt, got %v and %+v", err, notifier.builds)
+	}
+}
+
+func Test_PipelineFiltered(t *testing.T) {
+	pipeline := &Pipeline{Registry: NewRegistry()}
+	first := &recordingNotifier{name: "first"}
+	second := &recordingNotifier{name: "second"}
+	pipeline.Registry.Register("first", func(buildInfo BuildInfo) Notifier { return first })
+	pipeline.Registry.Register("second", func(buildInfo BuildInfo) Notifier { return second })
+	onlyFirst := func(next Notifier) Notifier {
+		return Chain(next, Filter(func(buildInfo BuildInfo) bool { return next.Name() == "first" }))
+	}
+	pipeline.Use(onlyFirst)
+	delivered, err := pipeline.deliver(context.Background(), BuildInfo{})
+	if err != nil || delivered != 1 {
+		t.Errorf("deliver() = %d, %v, want a single delivery", delivered, err)
+	}
+
+	pipeline.Use(Filter(func(buildInfo BuildInfo) bool { return false }))
+	delivered, err = pipeline.deliver(context.Background(), BuildInfo{})
+	if !errors.Is(err, ErrFiltered) || delivered != 0 {
+		t.Errorf("deliver() = %d, %v, want %v", delivered, err, ErrFiltered)
+	}
+}
+
+func Test_EnrichError(t *testing.T) {
+	notifier := &recordingNotifier{name: "n"}
+	err := Chain(notifier, Enrich(func(ctx context.Context, buildInfo *BuildInfo) error { return errors.New("lookup failed") })).Notify(context.Background(), BuildInfo{})
+	if err == nil || err.Error() != "lookup failed" || len(notifier.builds) != 0 {
+		t.Errorf("expected delivery to be aborted, got %v and %+v", err, notifier.builds)
+	}
+}
+
+func Test_RedactMiddleware(t *testing.T) {
+	var got string
+	notifier := NewNotifier("n", func(ctx context.Context, buildInfo BuildInfo) error {
+		got = getAttachment(buildInfo, buildInfo.GetContextualStatus()).Fields[0].Value
+		return nil
+	})
+	buildInfo := BuildInfo{TriggeredBy: "deploy to db-7.internal by hunter2"}
+	err := Chain(notifier, Redact(regexp.MustCompile(`db-\d+\.internal`)), Redact(regexp.MustCompile(`hunter\d`))).Notify(context.Background(), buildInfo)
+	if err != nil {
+		t.Fatalf("Notify() unexpected error: %v", err)
+	}
+	if got != "deploy to [REDACTED] by [REDACTED]" {
+		t.Errorf("expected both patterns to be redacted, got %q", got)
+	}
+	if len(buildInfo.redactors) != 0 {
+		t.Errorf("expected the caller's build to be left alone")
+	}
+}
+
+func Test_Retry(t *testing.T) {
+	tests := []struct {
+		name      string
+		failures  int
+		attempts  int
+		wantCalls int
+		wantErr   bool
+	}{
+		{"succeeds first time", 0, 3, 1, false},
+		{"succeeds on retry", 2, 3, 3, false},
+		{"gives up", 5, 3, 3, true},
+		{"no retries", 1, 1, 1, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			notifier := &recordingNotifier{name: "n", failures: tt.failures}
+			err := Chain(notifier, Retry(tt.attempts, time.Millisecond)).Notify(context.Background(), BuildInfo{})
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Notify() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if len(notifier.builds) != tt.wantCalls {
+				t.Errorf("Notify() made %d attempts, want %d", len(notifier.builds), tt.wantCalls)
+			}
+		})
+	}
+}
+
+func Test_Pipeline(t *testing.T) {
+	custom := &recordingNotifier{name: "custom", failures: 1}
+	client := newTestClient(false, false)
+	client.Registry.Register("custom", func(buildInfo BuildInfo) Notifier { return custom })
+	client.Use(Enrich(func(ctx context.Context, buildInfo *BuildInfo) error {
+		buildInfo.TriggeredBy = "enriched"
+		return nil
+	}))
+
+	err := client.PostToSlack(context.Background(), BuildInfo{JobName: "job", BuildStatus: failureKey})
+	if err == nil || err.Error() != "custom failed" {
+		t.Errorf("PostToSlack() err = %v, want custom failed", err)
+	}
+	client.Use(Retry(2, time.Millisecond))
+	err = client.PostToSlack(context.Background(), BuildInfo{JobName: "job", BuildStatus: failureKey, HookURL: "https://hooks.slack.com/test"})
+	if err != nil {
+		t.Errorf("PostToSlack() unexpected error: %v", err)
+	}
+	if len(custom.builds) != 2 || custom.builds[1].TriggeredBy != "enriched" {
+		t.Errorf("expected the custom backend to see enriched builds, got %+v", custom.builds)
+	}
+
+	client.Registry.Unregister("custom")
+	err = client.PostToSlack(context.Background(), BuildInfo{JobName: "job", BuildStatus: failureKey})
+	if err == nil || err.Error() != PickRunModeErrorMessage {
+		t.Errorf("PostToSlack() err = %v, want %v", err, PickRunModeErrorMessage)
+	}
+}
+
+func Test_RetryStopsWhenCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	notifier := &recordingNotifier{name: "n", failures: 5}
+	err := Chain(notifier, Retry(5, time.Hour)).Notify(ctx, BuildInfo{})
+	if err == nil || len(notifier.builds) != 1 {
+		t.Errorf("expected a single attempt once cancelled, got %v after %d attempts", err, len(notifier.builds))
+	}
+}
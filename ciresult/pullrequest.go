@@ -0,0 +1,181 @@
+/*
+ * Copyright (c) 2021, salesforce.com, inc.
+ * All rights reserved.
+ * SPDX-License-Identifier: BSD-3-Clause
+ * For full license text, see the LICENSE file in the repo root or https://opensource.org/licenses/BSD-3-Clause
+ */
+package ciresult
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/slack-go/slack"
+	"os"
+	"strconv"
+	"strings"
+)
+
+var (
+	pullRequestFieldTitle = "Pull Request"
+
+	mrkdwnEscaper = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;")
+)
+
+/*
+PullRequest represents the pull / merge request a build belongs to
+*/
+type PullRequest struct {
+	Number, Title, URL, Author, TargetBranch string
+}
+
+// pullRequestDetectors read the pull request details a CI system exposes, in order of precedence
+var pullRequestDetectors = []func() PullRequest{
+	detectJenkinsPullRequest,
+	detectGitHubPullRequest,
+	detectGitLabMergeRequest,
+	detectBitbucketPullRequest,
+	detectCirclePullRequest,
+}
+
+/*
+DetectPullRequest fills in any pull request details not set explicitly from the variables the CI system exposes
+*/
+func (buildInfo *BuildInfo) DetectPullRequest() {
+	for _, detect := range pullRequestDetectors {
+		detected := detect()
+		if detected.Number == "" && detected.URL == "" {
+			continue
+		}
+		setIfEmpty(&buildInfo.PrNumber, detected.Number)
+		setIfEmpty(&buildInfo.PrTitle, detected.Title)
+		setIfEmpty(&buildInfo.PrUrl, detected.URL)
+		setIfEmpty(&buildInfo.PrAuthor, detected.Author)
+		setIfEmpty(&buildInfo.PrTargetBranch, detected.TargetBranch)
+		return
+	}
+}
+
+func setIfEmpty(field *string, value string) {
+	if strings.TrimSpace(*field) == "" {
+		*field = value
+	}
+}
+
+func detectJenkinsPullRequest() PullRequest {
+	return PullRequest{
+		Number:       os.Getenv("CHANGE_ID"),
+		Title:        os.Getenv("CHANGE_TITLE"),
+		URL:          os.Getenv("CHANGE_URL"),
+		Author:       os.Getenv("CHANGE_AUTHOR"),
+		TargetBranch: os.Getenv("CHANGE_TARGET"),
+	}
+}
+
+func detectGitHubPullRequest() PullRequest {
+	eventName := os.Getenv("GITHUB_EVENT_NAME")
+	if eventName != "pull_request" && eventName != "pull_request_target" {
+		return PullRequest{}
+	}
+	var event struct {
+		PullRequest struct {
+			Number  int    `json:"number"`
+			Title   string `json:"title"`
+			HTMLURL string `json:"html_url"`
+			User    struct {
+				Login string `json:"login"`
+			} `json:"user"`
+			Base struct {
+				Ref string `json:"ref"`
+			} `json:"base"`
+		} `json:"pull_request"`
+	}
+	data, err := os.ReadFile(os.Getenv("GITHUB_EVENT_PATH"))
+	if err == nil && json.Unmarshal(data, &event) == nil && event.PullRequest.Number != 0 {
+		return PullRequest{
+			Number:       strconv.Itoa(event.PullRequest.Number),
+			Title:        event.PullRequest.Title,
+			URL:          event.PullRequest.HTMLURL,
+			Author:       event.PullRequest.User.Login,
+			TargetBranch: event.PullRequest.Base.Ref,
+		}
+	}
+	// Without the event payload the number is still available from the merge ref (refs/pull/<number>/merge)
+	number := strings.TrimSuffix(strings.TrimPrefix(os.Getenv("GITHUB_REF"), "refs/pull/"), "/merge")
+	if _, err := strconv.Atoi(number); err != nil {
+		return PullRequest{}
+	}
+	pullRequest := PullRequest{Number: number, Author: os.Getenv("GITHUB_ACTOR"), TargetBranch: os.Getenv("GITHUB_BASE_REF")}
+	if os.Getenv("GITHUB_SERVER_URL") != "" && os.Getenv("GITHUB_REPOSITORY") != "" {
+		pullRequest.URL = fmt.Sprintf("%s/%s/pull/%s", os.Getenv("GITHUB_SERVER_URL"), os.Getenv("GITHUB_REPOSITORY"), number)
+	}
+	return pullRequest
+}
+
+func detectGitLabMergeRequest() PullRequest {
+	number := os.Getenv("CI_MERGE_REQUEST_IID")
+	if number == "" {
+		return PullRequest{}
+	}
+	pullRequest := PullRequest{
+		Number:       number,
+		Title:        os.Getenv("CI_MERGE_REQUEST_TITLE"),
+		Author:       os.Getenv("GITLAB_USER_LOGIN"),
+		TargetBranch: os.Getenv("CI_MERGE_REQUEST_TARGET_BRANCH_NAME"),
+	}
+	if projectURL := os.Getenv("CI_MERGE_REQUEST_PROJECT_URL"); projectURL != "" {
+		pullRequest.URL = fmt.Sprintf("%s/-/merge_requests/%s", projectURL, number)
+	}
+	return pullRequest
+}
+
+func detectBitbucketPullRequest() PullRequest {
+	number := os.Getenv("BITBUCKET_PR_ID")
+	if number == "" {
+		return PullRequest{}
+	}
+	pullRequest := PullRequest{Number: number, TargetBranch: os.Getenv("BITBUCKET_PR_DESTINATION_BRANCH")}
+	if origin := os.Getenv("BITBUCKET_GIT_HTTP_ORIGIN"); origin != "" {
+		pullRequest.URL = fmt.Sprintf("%s/pull-requests/%s", origin, number)
+	}
+	return pullRequest
+}
+
+func detectCirclePullRequest() PullRequest {
+	pullRequestURL := os.Getenv("CIRCLE_PULL_REQUEST")
+	number := os.Getenv("CIRCLE_PR_NUMBER")
+	if number == "" && pullRequestURL != "" {
+		number = pullRequestURL[strings.LastIndex(pullRequestURL, "/")+1:]
+	}
+	return PullRequest{Number: number, URL: pullRequestURL, Author: os.Getenv("CIRCLE_PR_USERNAME")}
+}
+
+func (buildInfo *BuildInfo) pullRequestText() string {
+	if strings.TrimSpace(buildInfo.PrNumber) == "" && strings.TrimSpace(buildInfo.PrUrl) == "" {
+		return ""
+	}
+	text := "Pull request"
+	if buildInfo.PrNumber != "" {
+		text = "#" + buildInfo.PrNumber
+	}
+	if buildInfo.PrTitle != "" {
+		text += ": " + buildInfo.PrTitle
+	}
+	text = mrkdwnEscaper.Replace(text)
+	if buildInfo.PrUrl != "" {
+		text = fmt.Sprintf("<%s|%s>", buildInfo.PrUrl, text)
+	}
+	if buildInfo.PrAuthor != "" {
+		text += " by " + mrkdwnEscaper.Replace(buildInfo.PrAuthor)
+	}
+	if buildInfo.PrTargetBranch != "" {
+		text += " into " + mrkdwnEscaper.Replace(buildInfo.PrTargetBranch)
+	}
+	return text
+}
+
+func appendPullRequestField(attachmentFields *[]slack.AttachmentField, buildInfo BuildInfo) {
+	text := buildInfo.pullRequestText()
+	if text != "" {
+		*attachmentFields = append(*attachmentFields, getLongAttachmentField(pullRequestFieldTitle, text))
+	}
+}
@@ -0,0 +1,126 @@
+/*
+ * Copyright (c) 2021, salesforce.com, inc.
+ * All rights reserved.
+ * SPDX-License-Identifier: BSD-3-Clause
+ * For full license text, see the LICENSE file in the repo root or https://opensource.org/licenses/BSD-3-Clause
+ */
+package ciresult
+
+import (
+	"github.com/slack-go/slack"
+	"reflect"
+	"testing"
+)
+
+var pullRequestEnvVars = []string{
+	"CHANGE_ID", "CHANGE_TITLE", "CHANGE_URL", "CHANGE_AUTHOR", "CHANGE_TARGET",
+	"GITHUB_EVENT_NAME", "GITHUB_EVENT_PATH", "GITHUB_REF", "GITHUB_ACTOR", "GITHUB_BASE_REF", "GITHUB_SERVER_URL", "GITHUB_REPOSITORY",
+	"CI_MERGE_REQUEST_IID", "CI_MERGE_REQUEST_TITLE", "GITLAB_USER_LOGIN", "CI_MERGE_REQUEST_TARGET_BRANCH_NAME", "CI_MERGE_REQUEST_PROJECT_URL",
+	"BITBUCKET_PR_ID", "BITBUCKET_PR_DESTINATION_BRANCH", "BITBUCKET_GIT_HTTP_ORIGIN",
+	"CIRCLE_PULL_REQUEST", "CIRCLE_PR_NUMBER", "CIRCLE_PR_USERNAME",
+}
+
+func Test_DetectPullRequest(t *testing.T) {
+	tests := []struct {
+		name      string
+		env       map[string]string
+		buildInfo BuildInfo
+		want      BuildInfo
+	}{
+		{
+			"not a pull request",
+			map[string]string{"GITHUB_EVENT_NAME": "push", "GITHUB_REF": "refs/heads/main"},
+			BuildInfo{},
+			BuildInfo{},
+		},
+		{
+			"jenkins",
+			map[string]string{"CHANGE_ID": "7", "CHANGE_TITLE": "Fix it", "CHANGE_URL": "https://git/pr/7", "CHANGE_AUTHOR": "jdoe", "CHANGE_TARGET": "main"},
+			BuildInfo{},
+			BuildInfo{PrNumber: "7", PrTitle: "Fix it", PrUrl: "https://git/pr/7", PrAuthor: "jdoe", PrTargetBranch: "main"},
+		},
+		{
+			"github event payload",
+			map[string]string{"GITHUB_EVENT_NAME": "pull_request", "GITHUB_EVENT_PATH": "testdata/github/pull_request_event.json"},
+			BuildInfo{},
+			BuildInfo{PrNumber: "42", PrTitle: "Add retries to the <uploader>", PrUrl: "https://github.com/example/svc/pull/42", PrAuthor: "octocat", PrTargetBranch: "main"},
+		},
+		{
+			"github without event payload",
+			map[string]string{"GITHUB_EVENT_NAME": "pull_request", "GITHUB_REF": "refs/pull/43/merge", "GITHUB_ACTOR": "octocat",
+				"GITHUB_BASE_REF": "main", "GITHUB_SERVER_URL": "https://github.com", "GITHUB_REPOSITORY": "example/svc"},
+			BuildInfo{},
+			BuildInfo{PrNumber: "43", PrUrl: "https://github.com/example/svc/pull/43", PrAuthor: "octocat", PrTargetBranch: "main"},
+		},
+		{
+			"gitlab",
+			map[string]string{"CI_MERGE_REQUEST_IID": "9", "CI_MERGE_REQUEST_TITLE": "Draft: thing", "GITLAB_USER_LOGIN": "gl",
+				"CI_MERGE_REQUEST_TARGET_BRANCH_NAME": "develop", "CI_MERGE_REQUEST_PROJECT_URL": "https://gitlab.com/example/svc"},
+			BuildInfo{},
+			BuildInfo{PrNumber: "9", PrTitle: "Draft: thing", PrUrl: "https://gitlab.com/example/svc/-/merge_requests/9", PrAuthor: "gl", PrTargetBranch: "develop"},
+		},
+		{
+			"bitbucket",
+			map[string]string{"BITBUCKET_PR_ID": "3", "BITBUCKET_PR_DESTINATION_BRANCH": "master", "BITBUCKET_GIT_HTTP_ORIGIN": "http://bitbucket.org/example/svc"},
+			BuildInfo{},
+			BuildInfo{PrNumber: "3", PrUrl: "http://bitbucket.org/example/svc/pull-requests/3", PrTargetBranch: "master"},
+		},
+		{
+			"circleci",
+			map[string]string{"CIRCLE_PULL_REQUEST": "https://github.com/example/svc/pull/11", "CIRCLE_PR_USERNAME": "circle"},
+			BuildInfo{},
+			BuildInfo{PrNumber: "11", PrUrl: "https://github.com/example/svc/pull/11", PrAuthor: "circle"},
+		},
+		{
+			"explicit values win",
+			map[string]string{"CHANGE_ID": "7", "CHANGE_TITLE": "Fix it", "CHANGE_TARGET": "main"},
+			BuildInfo{PrTitle: "Explicit title"},
+			BuildInfo{PrNumber: "7", PrTitle: "Explicit title", PrTargetBranch: "main"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, key := range pullRequestEnvVars {
+				t.Setenv(key, tt.env[key])
+			}
+			tt.buildInfo.DetectPullRequest()
+			if !reflect.DeepEqual(tt.buildInfo, tt.want) {
+				t.Errorf("DetectPullRequest() = %+v, want %+v", tt.buildInfo, tt.want)
+			}
+		})
+	}
+}
+
+func Test_appendPullRequestField(t *testing.T) {
+	tests := []struct {
+		name      string
+		buildInfo BuildInfo
+		want      []slack.AttachmentField
+	}{
+		{"no pull request", BuildInfo{PrAuthor: "jdoe"}, emptyAttachmentFields},
+		{
+			"all details",
+			BuildInfo{PrNumber: "42", PrTitle: "Fix <thing> & stuff", PrUrl: "https://git/pr/42", PrAuthor: "jdoe", PrTargetBranch: "main"},
+			[]slack.AttachmentField{getLongAttachmentField(pullRequestFieldTitle, "<https://git/pr/42|#42: Fix &lt;thing&gt; &amp; stuff> by jdoe into main")},
+		},
+		{
+			"number only",
+			BuildInfo{PrNumber: "42"},
+			[]slack.AttachmentField{getLongAttachmentField(pullRequestFieldTitle, "#42")},
+		},
+		{
+			"url only",
+			BuildInfo{PrUrl: "https://git/pr/42"},
+			[]slack.AttachmentField{getLongAttachmentField(pullRequestFieldTitle, "<https://git/pr/42|Pull request>")},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []slack.AttachmentField
+			appendPullRequestField(&got, tt.buildInfo)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("appendPullRequestField() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,257 @@
+/*
+ * Copyright (c) 2021, salesforce.com, inc.
+ * All rights reserved.
+ * SPDX-License-Identifier: BSD-3-Clause
+ * For full license text, see the LICENSE file in the repo root or https://opensource.org/licenses/BSD-3-Clause
+ */
+package ciresult
+
+import (
+	"errors"
+	"fmt"
+	"github.com/slack-go/slack"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+/*
+QuietAction is what happens to a build posted during quiet hours
+*/
+type QuietAction string
+
+const (
+	// QuietSuppress skips posting the build
+	QuietSuppress QuietAction = "suppress"
+	// QuietDowngrade posts the build with its mentions turned into plain text so nobody is notified
+	QuietDowngrade QuietAction = "downgrade"
+	// QuietQueue skips posting the build and lists it in the next digest instead
+	QuietQueue QuietAction = "queue"
+)
+
+var (
+	QuietQueueConfigErrorMessage = "please specify HISTORY_FILE to queue builds for the digest during quiet hours"
+
+	weekdays = map[string]time.Weekday{
+		"sun": time.Sunday, "mon": time.Monday, "tue": time.Tuesday, "wed": time.Wednesday,
+		"thu": time.Thursday, "fri": time.Friday, "sat": time.Saturday,
+	}
+
+	// slackMentionPattern matches user, user group and broadcast mentions with an optional label
+	slackMentionPattern = regexp.MustCompile(`<([@!])(subteam\^)?([A-Za-z0-9]+)(?:\|@?([^>]*))?>`)
+)
+
+/*
+QuietWindow is a recurring period of quiet hours. A window ending before it starts runs past midnight into the
+next day.
+*/
+type QuietWindow struct {
+	// Days are the weekdays the window starts on
+	Days   [7]bool
+	Start  time.Duration
+	End    time.Duration
+	Action QuietAction
+}
+
+/*
+Contains reports whether t falls within the window
+*/
+func (window QuietWindow) Contains(t time.Time) bool {
+	sinceMidnight := time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute
+	today := t.Weekday()
+	if window.Start < window.End {
+		return window.Days[today] && sinceMidnight >= window.Start && sinceMidnight < window.End
+	}
+	yesterday := (today + 6) % 7
+	return window.Days[today] && sinceMidnight >= window.Start || window.Days[yesterday] && sinceMidnight < window.End
+}
+
+/*
+ParseQuietHours parses semicolon separated windows of the form "[days ]HH:MM-HH:MM[=action]", e.g.
+"Mon-Fri 22:00-07:00; Sat,Sun 00:00-24:00=queue". Windows apply every day unless days are given and use
+defaultAction unless an action is given.
+*/
+func ParseQuietHours(quietHours string, defaultAction QuietAction) ([]QuietWindow, error) {
+	var windows []QuietWindow
+	for _, spec := range strings.Split(quietHours, ";") {
+		spec = strings.TrimSpace(spec)
+		if spec == "" {
+			continue
+		}
+		window, err := parseQuietWindow(spec, defaultAction)
+		if err != nil {
+			return nil, fmt.Errorf("invalid QUIET_HOURS window %q: %s", spec, err)
+		}
+		windows = append(windows, window)
+	}
+	return windows, nil
+}
+
+func parseQuietWindow(spec string, defaultAction QuietAction) (QuietWindow, error) {
+	window := QuietWindow{Action: defaultAction}
+	spec, action, found := strings.Cut(spec, "=")
+	if found {
+		window.Action = QuietAction(strings.ToLower(strings.TrimSpace(action)))
+	}
+	if err := validateQuietAction(window.Action); err != nil {
+		return window, err
+	}
+	fields := strings.Fields(spec)
+	switch len(fields) {
+	case 1:
+		for day := range window.Days {
+			window.Days[day] = true
+		}
+	case 2:
+		days, err := parseWeekdays(fields[0])
+		if err != nil {
+			return window, err
+		}
+		window.Days = days
+		fields = fields[1:]
+	default:
+		return window, errors.New("expected [days ]HH:MM-HH:MM")
+	}
+	start, end, found := strings.Cut(fields[0], "-")
+	if !found {
+		return window, errors.New("expected a time range such as 22:00-07:00")
+	}
+	var err error
+	window.Start, err = parseTimeOfDay(start)
+	if err != nil {
+		return window, err
+	}
+	window.End, err = parseTimeOfDay(end)
+	if err != nil {
+		return window, err
+	}
+	if window.Start == window.End || window.Start == 24*time.Hour {
+		return window, errors.New("the window is empty")
+	}
+	return window, nil
+}
+
+func validateQuietAction(action QuietAction) error {
+	switch action {
+	case QuietSuppress, QuietDowngrade, QuietQueue:
+		return nil
+	}
+	return fmt.Errorf("unknown action %q, expected %s, %s or %s", action, QuietSuppress, QuietDowngrade, QuietQueue)
+}
+
+// parseWeekdays parses comma separated days and ranges of days, e.g. Mon-Fri,Sun
+func parseWeekdays(spec string) ([7]bool, error) {
+	var days [7]bool
+	for _, part := range strings.Split(spec, ",") {
+		first, last, isRange := strings.Cut(part, "-")
+		from, present := weekdays[strings.ToLower(strings.TrimSpace(first))]
+		if !present {
+			return days, fmt.Errorf("unknown day %q", first)
+		}
+		to := from
+		if isRange {
+			to, present = weekdays[strings.ToLower(strings.TrimSpace(last))]
+			if !present {
+				return days, fmt.Errorf("unknown day %q", last)
+			}
+		}
+		for day := from; ; day = (day + 1) % 7 {
+			days[day] = true
+			if day == to {
+				break
+			}
+		}
+	}
+	return days, nil
+}
+
+func parseTimeOfDay(spec string) (time.Duration, error) {
+	hours, minutes, found := strings.Cut(strings.TrimSpace(spec), ":")
+	hour, err := strconv.Atoi(hours)
+	if !found || err != nil || len(minutes) != 2 {
+		return 0, fmt.Errorf("invalid time %q, expected HH:MM", spec)
+	}
+	minute, err := strconv.Atoi(minutes)
+	if err != nil || hour < 0 || minute < 0 || minute > 59 || hour > 24 || hour == 24 && minute != 0 {
+		return 0, fmt.Errorf("invalid time %q, expected HH:MM", spec)
+	}
+	return time.Duration(hour)*time.Hour + time.Duration(minute)*time.Minute, nil
+}
+
+/*
+ValidateQuietHours returns an error if QuietHours, QuietHoursAction or QuietHoursTimezone is invalid, or builds
+would be queued without a history file
+*/
+func (buildInfo *BuildInfo) ValidateQuietHours() error {
+	windows, err := buildInfo.quietWindows()
+	if err != nil {
+		return err
+	}
+	_, err = time.LoadLocation(buildInfo.QuietHoursTimezone)
+	if err != nil {
+		return fmt.Errorf("invalid QUIET_HOURS_TIMEZONE: %s", err)
+	}
+	for _, window := range windows {
+		if window.Action == QuietQueue && buildInfo.HistoryFile == "" {
+			return errors.New(QuietQueueConfigErrorMessage)
+		}
+	}
+	return nil
+}
+
+func (buildInfo *BuildInfo) quietWindows() ([]QuietWindow, error) {
+	defaultAction := QuietAction(strings.ToLower(strings.TrimSpace(buildInfo.QuietHoursAction)))
+	if strings.TrimSpace(buildInfo.QuietHours) == "" {
+		return nil, nil
+	}
+	if err := validateQuietAction(defaultAction); err != nil {
+		return nil, fmt.Errorf("invalid QUIET_HOURS_ACTION: %s", err)
+	}
+	return ParseQuietHours(buildInfo.QuietHours, defaultAction)
+}
+
+/*
+QuietAction returns the action of the first quiet hours window containing now in QuietHoursTimezone, or an empty
+action outside quiet hours
+*/
+func (buildInfo *BuildInfo) QuietAction(now time.Time) QuietAction {
+	// Invalid settings are rejected by Validate before anything is delivered
+	windows, _ := buildInfo.quietWindows()
+	location, err := time.LoadLocation(buildInfo.QuietHoursTimezone)
+	if err != nil {
+		location = time.UTC
+	}
+	for _, window := range windows {
+		if window.Contains(now.In(location)) {
+			return window.Action
+		}
+	}
+	return ""
+}
+
+/*
+silenceMentions turns Slack mentions (e.g. <!here> or <@U012AB3CD>) into plain text which doesn't notify anybody
+*/
+func silenceMentions(text string) string {
+	return slackMentionPattern.ReplaceAllStringFunc(text, func(mention string) string {
+		groups := slackMentionPattern.FindStringSubmatch(mention)
+		if groups[4] != "" {
+			return "@" + groups[4]
+		}
+		return "@" + groups[3]
+	})
+}
+
+func silenceAttachment(attachment slack.Attachment) slack.Attachment {
+	attachment.Title = silenceMentions(attachment.Title)
+	attachment.Pretext = silenceMentions(attachment.Pretext)
+	attachment.Text = silenceMentions(attachment.Text)
+	var fields []slack.AttachmentField
+	for _, field := range attachment.Fields {
+		field.Value = silenceMentions(field.Value)
+		fields = append(fields, field)
+	}
+	attachment.Fields = fields
+	return attachment
+}
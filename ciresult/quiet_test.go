@@ -0,0 +1,175 @@
+/*
+ * Copyright (c) 2021, salesforce.com, inc.
+ * All rights reserved.
+ * SPDX-License-Identifier: BSD-3-Clause
+ * For full license text, see the LICENSE file in the repo root or https://opensource.org/licenses/BSD-3-Clause
+ */
+package ciresult
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func days(weekdays ...time.Weekday) [7]bool {
+	var days [7]bool
+	for _, day := range weekdays {
+		days[day] = true
+	}
+	return days
+}
+
+var everyDay = days(time.Sunday, time.Monday, time.Tuesday, time.Wednesday, time.Thursday, time.Friday, time.Saturday)
+
+func Test_ParseQuietHours(t *testing.T) {
+	tests := []struct {
+		name       string
+		quietHours string
+		want       []QuietWindow
+		wantErr    string
+	}{
+		{"empty", " ", nil, ""},
+		{"every day", "22:00-07:30", []QuietWindow{{everyDay, 22 * time.Hour, 7*time.Hour + 30*time.Minute, QuietSuppress}}, ""},
+		{
+			"days and actions",
+			"Mon-Fri 22:00-07:00; sat,SUN 00:00-24:00=Queue",
+			[]QuietWindow{
+				{days(time.Monday, time.Tuesday, time.Wednesday, time.Thursday, time.Friday), 22 * time.Hour, 7 * time.Hour, QuietSuppress},
+				{days(time.Saturday, time.Sunday), 0, 24 * time.Hour, QuietQueue},
+			},
+			"",
+		},
+		{"wrapping day range", "Fri-Mon 18:00-20:00=downgrade", []QuietWindow{{days(time.Friday, time.Saturday, time.Sunday, time.Monday), 18 * time.Hour, 20 * time.Hour, QuietDowngrade}}, ""},
+		{"unknown action", "22:00-07:00=mute", nil, `invalid QUIET_HOURS window "22:00-07:00=mute": unknown action "mute"`},
+		{"unknown day", "Funday 22:00-07:00", nil, `unknown day "Funday"`},
+		{"missing range", "22:00", nil, "expected a time range"},
+		{"invalid time", "22:00-7:0", nil, `invalid time "7:0"`},
+		{"hour out of range", "22:00-25:00", nil, `invalid time "25:00"`},
+		{"empty window", "07:00-07:00", nil, "the window is empty"},
+		{"too many fields", "Mon 22:00 - 07:00", nil, "expected [days ]HH:MM-HH:MM"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseQuietHours(tt.quietHours, QuietSuppress)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("ParseQuietHours() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseQuietHours() unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParseQuietHours() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_QuietWindowContains(t *testing.T) {
+	weeknights := QuietWindow{days(time.Monday, time.Tuesday, time.Wednesday, time.Thursday, time.Friday), 22 * time.Hour, 7 * time.Hour, QuietSuppress}
+	// March 4th 2024 is a Monday
+	monday := func(day int, hour int, minute int) time.Time {
+		return time.Date(2024, 3, 4+day, hour, minute, 0, 0, time.UTC)
+	}
+	tests := []struct {
+		name   string
+		window QuietWindow
+		t      time.Time
+		want   bool
+	}{
+		{"before the window", weeknights, monday(0, 21, 59), false},
+		{"start of the window", weeknights, monday(0, 22, 0), true},
+		{"past midnight", weeknights, monday(1, 6, 59), true},
+		{"end of the window", weeknights, monday(1, 7, 0), false},
+		{"Monday morning belongs to Sunday night", weeknights, monday(0, 3, 0), false},
+		{"Saturday morning belongs to Friday night", weeknights, monday(5, 3, 0), true},
+		{"Saturday night", weeknights, monday(5, 23, 0), false},
+		{"whole day", QuietWindow{days(time.Sunday), 0, 24 * time.Hour, QuietQueue}, monday(6, 23, 59), true},
+		{"daytime window", QuietWindow{everyDay, 12 * time.Hour, 13 * time.Hour, QuietQueue}, monday(2, 12, 30), true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.window.Contains(tt.t); got != tt.want {
+				t.Errorf("Contains(%s) = %v, want %v", tt.t.Format(time.RFC1123), got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_QuietAction(t *testing.T) {
+	buildInfo := NewBuildInfo("job", "https://ci/1", failureKey)
+	buildInfo.QuietHours = "22:00-07:00; Sat,Sun 00:00-24:00=downgrade"
+	buildInfo.QuietHoursAction = "queue"
+	buildInfo.QuietHoursTimezone = "America/New_York"
+	tests := []struct {
+		name string
+		now  time.Time
+		want QuietAction
+	}{
+		{"weekday afternoon", time.Date(2024, 3, 6, 18, 0, 0, 0, time.UTC), ""},
+		{"late at night in New York", time.Date(2024, 3, 7, 3, 30, 0, 0, time.UTC), QuietQueue},
+		{"first matching window wins", time.Date(2024, 3, 9, 8, 0, 0, 0, time.UTC), QuietQueue},
+		{"weekend", time.Date(2024, 3, 9, 16, 0, 0, 0, time.UTC), QuietDowngrade},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := buildInfo.QuietAction(tt.now); got != tt.want {
+				t.Errorf("QuietAction() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+	buildInfo = NewBuildInfo("job", "https://ci/1", failureKey)
+	if got := buildInfo.QuietAction(time.Now()); got != "" {
+		t.Errorf("QuietAction() without QUIET_HOURS = %q, want none", got)
+	}
+}
+
+func Test_ValidateQuietHours(t *testing.T) {
+	tests := []struct {
+		name     string
+		hours    string
+		action   string
+		timezone string
+		history  string
+		wantErr  string
+	}{
+		{"not configured", "", "nonsense", "UTC", "", ""},
+		{"valid", "22:00-07:00", "Downgrade", "Europe/Berlin", "", ""},
+		{"invalid action", "22:00-07:00", "mute", "UTC", "", "invalid QUIET_HOURS_ACTION"},
+		{"invalid window", "22:00", "suppress", "UTC", "", "invalid QUIET_HOURS window"},
+		{"invalid timezone", "22:00-07:00", "suppress", "Mars/Olympus", "", "invalid QUIET_HOURS_TIMEZONE"},
+		{"queue without history", "22:00-07:00=queue", "suppress", "UTC", "", QuietQueueConfigErrorMessage},
+		{"queue with history", "22:00-07:00=queue", "suppress", "UTC", "history.json", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			buildInfo := BuildInfo{QuietHours: tt.hours, QuietHoursAction: tt.action, QuietHoursTimezone: tt.timezone, HistoryFile: tt.history}
+			err := buildInfo.ValidateQuietHours()
+			if tt.wantErr == "" && err != nil || tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)) {
+				t.Errorf("ValidateQuietHours() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func Test_silenceMentions(t *testing.T) {
+	tests := []struct {
+		text string
+		want string
+	}{
+		{"<!here> deploy failed", "@here deploy failed"},
+		{"<!channel|@channel> and <!everyone>", "@channel and @everyone"},
+		{"by <@U012AB3CD> and <@W0123|alice>", "by @U012AB3CD and @alice"},
+		{"paging <!subteam^S0123|@oncall>", "paging @oncall"},
+		{"<https://ci.example.com|build> & <#C0123|general>", "<https://ci.example.com|build> & <#C0123|general>"},
+	}
+	for _, tt := range tests {
+		if got := silenceMentions(tt.text); got != tt.want {
+			t.Errorf("silenceMentions(%q) = %q, want %q", tt.text, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,96 @@
+/*
+ * Copyright (c) 2021, salesforce.com, inc.
+ * All rights reserved.
+ * SPDX-License-Identifier: BSD-3-Clause
+ * For full license text, see the LICENSE file in the repo root or https://opensource.org/licenses/BSD-3-Clause
+ */
+package ciresult
+
+import (
+	"errors"
+	"fmt"
+	"github.com/slack-go/slack"
+	"regexp"
+	"strings"
+)
+
+const redactedText = "[REDACTED]"
+
+var secretPatterns = []*regexp.Regexp{
+	// Slack bot, user, app and configuration tokens
+	regexp.MustCompile(`\bxox[abposre]-[A-Za-z0-9-]+`),
+	regexp.MustCompile(`\bxapp-[A-Za-z0-9-]+`),
+	regexp.MustCompile(`https://hooks\.slack\.com/[A-Za-z0-9/_-]+`),
+	// AWS access key IDs and secret access key assignments
+	regexp.MustCompile(`\b(?:AKIA|ASIA)[0-9A-Z]{16}\b`),
+	regexp.MustCompile(`(?i)aws_secret_access_key["']?\s*[:=]\s*["']?[A-Za-z0-9/+=]{40}`),
+	// GitHub personal access, OAuth, app and refresh tokens
+	regexp.MustCompile(`\bgh[pousr]_[A-Za-z0-9]{36,}\b`),
+	regexp.MustCompile(`\bgithub_pat_[A-Za-z0-9_]{22,}\b`),
+	// JSON Web Tokens
+	regexp.MustCompile(`\beyJ[A-Za-z0-9_-]+\.eyJ[A-Za-z0-9_-]+\.[A-Za-z0-9_-]+`),
+}
+
+/*
+Redact masks the configured credentials, anything shaped like a well known secret and anything matching
+RedactPatterns in text
+*/
+func (buildInfo *BuildInfo) Redact(text string) string {
+	secrets := []string{
+		buildInfo.OauthToken, buildInfo.HookURL, buildInfo.TeamsHookUrl, buildInfo.DiscordHookUrl,
+		buildInfo.MattermostHookUrl, buildInfo.WebhookUrl, buildInfo.SmtpPassword,
+	}
+	for _, secret := range secrets {
+		if strings.TrimSpace(secret) != "" {
+			text = strings.ReplaceAll(text, secret, redactedText)
+		}
+	}
+	for _, pattern := range secretPatterns {
+		text = pattern.ReplaceAllString(text, redactedText)
+	}
+	// Invalid patterns are rejected by Validate before anything is delivered
+	patterns, _ := buildInfo.compileRedactPatterns()
+	for _, pattern := range append(patterns, buildInfo.redactors...) {
+		text = pattern.ReplaceAllString(text, redactedText)
+	}
+	return text
+}
+
+/*
+ValidateRedactPatterns returns an error if any of the RedactPatterns isn't a valid regex
+*/
+func (buildInfo *BuildInfo) ValidateRedactPatterns() error {
+	_, err := buildInfo.compileRedactPatterns()
+	return err
+}
+
+func (buildInfo *BuildInfo) compileRedactPatterns() ([]*regexp.Regexp, error) {
+	var patterns []*regexp.Regexp
+	var errs []error
+	for _, expr := range strings.Fields(buildInfo.RedactPatterns) {
+		pattern, err := regexp.Compile(expr)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("invalid REDACT_PATTERNS entry %q: %s", expr, err))
+			continue
+		}
+		patterns = append(patterns, pattern)
+	}
+	return patterns, errors.Join(errs...)
+}
+
+func (buildInfo *BuildInfo) redactAttachment(attachment slack.Attachment) slack.Attachment {
+	attachment.Title = buildInfo.Redact(attachment.Title)
+	attachment.TitleLink = buildInfo.Redact(attachment.TitleLink)
+	attachment.Pretext = buildInfo.Redact(attachment.Pretext)
+	attachment.Text = buildInfo.Redact(attachment.Text)
+	attachment.Fallback = buildInfo.Redact(attachment.Fallback)
+	attachment.Footer = buildInfo.Redact(attachment.Footer)
+	var fields []slack.AttachmentField
+	for _, field := range attachment.Fields {
+		field.Title = buildInfo.Redact(field.Title)
+		field.Value = buildInfo.Redact(field.Value)
+		fields = append(fields, field)
+	}
+	attachment.Fields = fields
+	return attachment
+}
@@ -0,0 +1,51 @@
+/*
+ * Copyright (c) 2021, salesforce.com, inc.
+ * All rights reserved.
+ * SPDX-License-Identifier: BSD-3-Clause
+ * For full license text, see the LICENSE file in the repo root or https://opensource.org/licenses/BSD-3-Clause
+ */
+package ciresult
+
+import "github.com/slack-go/slack"
+
+/*
+RenderSlackAttachment renders the build as the attachment posted to Slack
+*/
+func RenderSlackAttachment(buildInfo BuildInfo) slack.Attachment {
+	return getAttachment(buildInfo, buildInfo.GetContextualStatus())
+}
+
+/*
+RenderTeamsMessage renders the build as the Adaptive Card posted to Microsoft Teams
+*/
+func RenderTeamsMessage(buildInfo BuildInfo) TeamsMessage {
+	return getTeamsMessage(buildInfo, buildInfo.GetContextualStatus())
+}
+
+/*
+RenderDiscordMessage renders the build as the embed posted to Discord
+*/
+func RenderDiscordMessage(buildInfo BuildInfo) DiscordMessage {
+	return getDiscordMessage(buildInfo, buildInfo.GetContextualStatus())
+}
+
+/*
+RenderMattermostMessage renders the build as the attachment posted to Mattermost
+*/
+func RenderMattermostMessage(buildInfo BuildInfo) slack.WebhookMessage {
+	return getMattermostMessage(buildInfo, buildInfo.GetContextualStatus())
+}
+
+/*
+RenderWebhookBody renders the build as the body sent to WebhookUrl
+*/
+func RenderWebhookBody(buildInfo BuildInfo) ([]byte, error) {
+	return getWebhookBody(buildInfo, buildInfo.GetContextualStatus())
+}
+
+/*
+RenderEmail renders the build as the email sent to EmailTo
+*/
+func RenderEmail(buildInfo BuildInfo) (Email, error) {
+	return getEmail(buildInfo, buildInfo.GetContextualStatus())
+}
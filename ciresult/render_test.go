@@ -0,0 +1,210 @@
+/*
+ * Copyright (c) 2021, salesforce.com, inc.
+ * All rights reserved.
+ * SPDX-License-Identifier: BSD-3-Clause
+ * For full license text, see the LICENSE file in the repo root or https://opensource.org/licenses/BSD-3-Clause
+ */
+package ciresult
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files in testdata/render with the rendered messages")
+
+func Test_RenderUsesContextualStatus(t *testing.T) {
+	buildInfo := NewBuildInfo("job", "https://ci/1", successKey)
+	buildInfo.LastBuildStatus = failureKey
+	want := "Fixed: job"
+
+	if got := RenderSlackAttachment(buildInfo).Title; got != want {
+		t.Errorf("RenderSlackAttachment() title = %v, want %v", got, want)
+	}
+	if got := RenderTeamsMessage(buildInfo).Attachments[0].Content.Body[0].Text; got != want {
+		t.Errorf("RenderTeamsMessage() title = %v, want %v", got, want)
+	}
+	if got := RenderDiscordMessage(buildInfo).Embeds[0].Title; got != want {
+		t.Errorf("RenderDiscordMessage() title = %v, want %v", got, want)
+	}
+	if got := RenderMattermostMessage(buildInfo).Attachments[0].Title; got != want {
+		t.Errorf("RenderMattermostMessage() title = %v, want %v", got, want)
+	}
+	body, err := RenderWebhookBody(buildInfo)
+	if err != nil || !strings.Contains(string(body), `"title":"Fixed: job"`) {
+		t.Errorf("RenderWebhookBody() = %s, %v", body, err)
+	}
+	email, err := RenderEmail(buildInfo)
+	if err != nil || email.Subject != want {
+		t.Errorf("RenderEmail() subject = %v, %v", email.Subject, err)
+	}
+}
+
+// goldenTransitions covers every path through GetContextualStatus
+var goldenTransitions = []struct {
+	name            string
+	buildStatus     string
+	lastBuildStatus string
+}{
+	{"success", successKey, successKey},
+	{"fixed", successKey, failureKey},
+	{"failed", failureKey, successKey},
+	{"still-failing", failureKey, failureKey},
+	{"unstable", unstableKey, successKey},
+	{"unstable-after-failure", unstableKey, failureKey},
+	{"unknown", unknownKey, successKey},
+	{"unrecognized", "ABORTED", unknownKey},
+	{"fixed-given", fixedKey, unknownKey},
+	{"still-failing-given", stillFailingKey, unknownKey},
+}
+
+func goldenBuildInfo(t *testing.T, buildStatus string, lastBuildStatus string) BuildInfo {
+	t.Helper()
+	buildInfo := NewBuildInfo("deploy", "https://ci.example.com/job/deploy/42/", buildStatus)
+	buildInfo.LastBuildStatus = lastBuildStatus
+	buildInfo.RepoUrl = "https://github.com/example/app"
+	buildInfo.RepoHost = "github"
+	buildInfo.BranchName = "main"
+	buildInfo.GitCommit = "0123456789abcdef0123456789abcdef01234567"
+	buildInfo.Duration = 63 * time.Second
+	buildInfo.TriggeredBy = "Push by octocat"
+	buildInfo.PrNumber = "7"
+	buildInfo.PrTitle = "Fix <flaky> & slow tests"
+	buildInfo.PrUrl = "https://github.com/example/app/pull/7"
+	buildInfo.PrAuthor = "octocat"
+	buildInfo.PrTargetBranch = "main"
+	buildInfo.Commits = []Commit{
+		{SHA: "0123456789abcdef0123456789abcdef01234567", Author: "octocat", Subject: "Fix the flaky test"},
+		{SHA: "89abcdef0123456789abcdef0123456789abcdef", Author: "hubot", Subject: "Speed up the build"},
+	}
+	err := json.Unmarshal([]byte(`[{"name":"Build","status":"SUCCESS","duration":"1m3s"},{"name":"Test","status":"`+buildStatus+`"}]`), &buildInfo.Stages)
+	if err != nil {
+		t.Fatal(err)
+	}
+	buildInfo.EmailTo = "team@example.com"
+	buildInfo.EmailFrom = "ci@example.com"
+	return buildInfo
+}
+
+// goldenRichBuildInfo adds every optional section to a failed build: test reports, coverage with its delta, a slow
+// build against the job's median and matrix cells
+func goldenRichBuildInfo(t *testing.T) BuildInfo {
+	t.Helper()
+	buildInfo := goldenBuildInfo(t, failureKey, successKey)
+	buildInfo.TestSummary = &TestSummary{
+		Total:   120,
+		Passed:  117,
+		Failed:  2,
+		Skipped: 1,
+		Failures: []TestFailure{
+			{Name: "LoginTest.rejects <admin>", Message: "expected 401 & got *200*"},
+			{Name: "CartTest.total", Message: "expected 10 but was 9"},
+		},
+	}
+	buildInfo.GoTestSummary = &GoTestSummary{
+		Tests: TestSummary{Total: 40, Passed: 38, Failed: 1, Skipped: 1},
+		Packages: []GoTestResult{
+			{Package: "example.com/app/api", Action: "fail", Elapsed: 2.5},
+			{Package: "example.com/app/store", Action: "pass", Elapsed: 1.25},
+		},
+		Slowest: []GoTestResult{
+			{Package: "example.com/app/api", Test: "TestCheckout", Action: "fail", Elapsed: 2.1},
+			{Package: "example.com/app/store", Test: "TestSave_<nil>", Action: "pass", Elapsed: 0.9},
+		},
+		Failures: []GoTestFailure{
+			{Package: "example.com/app/api", Test: "TestCheckout", Output: []string{"checkout_test.go:12: got *500* want 200"}},
+		},
+	}
+	coverage := 81.2
+	buildInfo.Coverage = &coverage
+	previousCoverage := 84.5
+	recorded := time.Date(2024, 3, 4, 12, 0, 0, 0, time.UTC)
+	buildInfo.History = &History{}
+	for i, duration := range []time.Duration{30 * time.Second, 40 * time.Second, 35 * time.Second} {
+		record := BuildRecord{JobName: "deploy", BranchName: "main", BuildStatus: successKey, Duration: duration, Timestamp: recorded.Add(time.Duration(i) * time.Hour)}
+		if i == 2 {
+			record.Coverage = &previousCoverage
+		}
+		buildInfo.History.Records = append(buildInfo.History.Records, record)
+	}
+	buildInfo.MatrixCells = []MatrixCellResult{
+		{Cell: "linux", BuildStatus: successKey, BuildURL: "https://ci.example.com/job/deploy/42/linux/", Duration: 50 * time.Second, Timestamp: recorded},
+		{Cell: "windows", BuildStatus: failureKey, BuildURL: "https://ci.example.com/job/deploy/42/windows/", Duration: 63 * time.Second, Timestamp: recorded},
+	}
+	return buildInfo
+}
+
+func Test_RenderGolden(t *testing.T) {
+	for _, transition := range goldenTransitions {
+		assertRenderedGolden(t, transition.name, goldenBuildInfo(t, transition.buildStatus, transition.lastBuildStatus))
+	}
+	assertRenderedGolden(t, "rich", goldenRichBuildInfo(t))
+}
+
+// assertRenderedGolden renders the build for every destination and compares the messages with testdata/render/name
+func assertRenderedGolden(t *testing.T, name string, buildInfo BuildInfo) {
+	t.Helper()
+	webhookBody, err := RenderWebhookBody(buildInfo)
+	if err != nil {
+		t.Fatalf("RenderWebhookBody() unexpected error: %v", err)
+	}
+	email, err := RenderEmail(buildInfo)
+	if err != nil {
+		t.Fatalf("RenderEmail() unexpected error: %v", err)
+	}
+	rendered := map[string][]byte{
+		"slack.json":      goldenJSON(t, RenderSlackAttachment(buildInfo)),
+		"teams.json":      goldenJSON(t, RenderTeamsMessage(buildInfo)),
+		"discord.json":    goldenJSON(t, RenderDiscordMessage(buildInfo)),
+		"mattermost.json": goldenJSON(t, RenderMattermostMessage(buildInfo)),
+		"webhook.json":    goldenJSON(t, json.RawMessage(webhookBody)),
+		"email.txt":       []byte("Subject: " + email.Subject + "\n\n" + email.Text),
+		"email.html":      []byte(email.HTML),
+	}
+	for format, got := range rendered {
+		t.Run(name+"/"+format, func(t *testing.T) {
+			assertGolden(t, filepath.Join("testdata", "render", name, format), got)
+		})
+	}
+}
+
+func goldenJSON(t *testing.T, message interface{}) []byte {
+	t.Helper()
+	var buffer bytes.Buffer
+	encoder := json.NewEncoder(&buffer)
+	encoder.SetEscapeHTML(false)
+	encoder.SetIndent("", "  ")
+	err := encoder.Encode(message)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return buffer.Bytes()
+}
+
+// assertGolden compares got with the golden file, rewriting it instead when the -update flag is set
+func assertGolden(t *testing.T, golden string, got []byte) {
+	t.Helper()
+	if *update {
+		err := os.MkdirAll(filepath.Dir(golden), 0755)
+		if err == nil {
+			err = os.WriteFile(golden, got, 0644)
+		}
+		if err != nil {
+			t.Fatalf("unable to update %s: %v", golden, err)
+		}
+		return
+	}
+	want, err := os.ReadFile(golden)
+	if err != nil {
+		t.Fatalf("unable to read %s, run go test -update to create it: %v", golden, err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("rendered message differs from %s, run go test -update and review the diff:\n%s", golden, got)
+	}
+}
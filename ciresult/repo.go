@@ -0,0 +1,213 @@
+/*
+ * Copyright (c) 2021, salesforce.com, inc.
+ * All rights reserved.
+ * SPDX-License-Identifier: BSD-3-Clause
+ * For full license text, see the LICENSE file in the repo root or https://opensource.org/licenses/BSD-3-Clause
+ */
+package ciresult
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"regexp"
+	"strings"
+)
+
+const shortCommitLength = 7
+
+var (
+	githubHost    = "github"
+	gitlabHost    = "gitlab"
+	bitbucketHost = "bitbucket"
+	giteaHost     = "gitea"
+
+	repoHosts = map[string]RepoHost{
+		githubHost: {
+			commitPath:  "/commit/%s",
+			treePath:    "/tree/%s",
+			comparePath: "/compare/%s...%s",
+		},
+		gitlabHost: {
+			commitPath:  "/-/commit/%s",
+			treePath:    "/-/tree/%s",
+			comparePath: "/-/compare/%s...%s",
+		},
+		bitbucketHost: {
+			commitPath:  "/commits/%s",
+			treePath:    "/src/%s",
+			comparePath: "/branches/compare/%[2]s%%0D%[1]s",
+		},
+		giteaHost: {
+			commitPath:  "/commit/%s",
+			treePath:    "/src/branch/%s",
+			comparePath: "/compare/%s...%s",
+		},
+	}
+
+	scpLikeGitURL = regexp.MustCompile(`^(?:[\w.-]+@)?([\w.-]+):(.+)$`)
+)
+
+/*
+RepoHost represents the URL layout of a source host's commit, tree and compare pages
+*/
+type RepoHost struct {
+	commitPath, treePath, comparePath string
+}
+
+/*
+DetectRepo fills in RepoUrl and RepoHost, when not set explicitly, from the variables the CI system exposes
+*/
+func (buildInfo *BuildInfo) DetectRepo() {
+	if strings.TrimSpace(buildInfo.RepoUrl) == "" {
+		buildInfo.RepoUrl = detectRepoURL()
+	}
+	buildInfo.RepoUrl = normalizeRepoURL(buildInfo.RepoUrl)
+	if strings.TrimSpace(buildInfo.RepoHost) == "" {
+		buildInfo.RepoHost = detectRepoHost(buildInfo.RepoUrl)
+	}
+	buildInfo.RepoHost = strings.ToLower(buildInfo.RepoHost)
+}
+
+func detectRepoURL() string {
+	if os.Getenv("GITHUB_SERVER_URL") != "" && os.Getenv("GITHUB_REPOSITORY") != "" {
+		return os.Getenv("GITHUB_SERVER_URL") + "/" + os.Getenv("GITHUB_REPOSITORY")
+	}
+	for _, key := range []string{"CI_PROJECT_URL", "BITBUCKET_GIT_HTTP_ORIGIN", "GIT_URL", "CIRCLE_REPOSITORY_URL"} {
+		if value := os.Getenv(key); value != "" {
+			return value
+		}
+	}
+	return ""
+}
+
+// normalizeRepoURL turns clone URLs (e.g. git@github.com:org/repo.git) into the repo's web URL
+func normalizeRepoURL(repoURL string) string {
+	repoURL = strings.TrimSpace(repoURL)
+	if repoURL == "" {
+		return ""
+	}
+	if !strings.Contains(repoURL, "://") {
+		if matches := scpLikeGitURL.FindStringSubmatch(repoURL); matches != nil {
+			repoURL = "https://" + matches[1] + "/" + matches[2]
+		}
+	}
+	parsed, err := url.Parse(repoURL)
+	if err == nil && (parsed.Scheme == "ssh" || parsed.Scheme == "git") {
+		parsed.Scheme = "https"
+		parsed.User = nil
+		parsed.Host = parsed.Hostname()
+		repoURL = parsed.String()
+	} else if err == nil && parsed.User != nil {
+		parsed.User = nil
+		repoURL = parsed.String()
+	}
+	return strings.TrimSuffix(strings.TrimSuffix(repoURL, "/"), ".git")
+}
+
+func detectRepoHost(repoURL string) string {
+	if os.Getenv("GITEA_ACTIONS") == "true" {
+		return giteaHost
+	}
+	parsed, err := url.Parse(repoURL)
+	if err != nil {
+		return ""
+	}
+	for _, host := range []string{githubHost, gitlabHost, bitbucketHost, giteaHost} {
+		if strings.Contains(parsed.Hostname(), host) {
+			return host
+		}
+	}
+	return ""
+}
+
+func (buildInfo *BuildInfo) repoHost() (RepoHost, bool) {
+	if buildInfo.RepoUrl == "" {
+		return RepoHost{}, false
+	}
+	host, ok := repoHosts[buildInfo.RepoHost]
+	return host, ok
+}
+
+/*
+CommitURL returns the web URL of the commit, or an empty string if the repo's host isn't known
+*/
+func (buildInfo *BuildInfo) CommitURL(commit string) string {
+	host, ok := buildInfo.repoHost()
+	if !ok || commit == "" {
+		return ""
+	}
+	return buildInfo.RepoUrl + fmt.Sprintf(host.commitPath, url.PathEscape(commit))
+}
+
+/*
+BranchURL returns the web URL of the branch, or an empty string if the repo's host isn't known
+*/
+func (buildInfo *BuildInfo) BranchURL(branch string) string {
+	host, ok := buildInfo.repoHost()
+	if !ok || branch == "" {
+		return ""
+	}
+	segments := strings.Split(branch, "/")
+	for i, segment := range segments {
+		segments[i] = url.PathEscape(segment)
+	}
+	return buildInfo.RepoUrl + fmt.Sprintf(host.treePath, strings.Join(segments, "/"))
+}
+
+/*
+CompareURL returns the web URL comparing two commits, or an empty string if the repo's host isn't known
+*/
+func (buildInfo *BuildInfo) CompareURL(from string, to string) string {
+	host, ok := buildInfo.repoHost()
+	if !ok || from == "" || to == "" {
+		return ""
+	}
+	return buildInfo.RepoUrl + fmt.Sprintf(host.comparePath, url.PathEscape(from), url.PathEscape(to))
+}
+
+/*
+LastSuccessfulCommit returns the commit of the last successful build of the job and branch from the history
+*/
+func (buildInfo *BuildInfo) LastSuccessfulCommit() string {
+	record := buildInfo.History.Last(buildInfo.JobName, buildInfo.BranchName, func(record BuildRecord) bool {
+		return record.succeeded() && record.GitCommit != ""
+	})
+	if record == nil {
+		return ""
+	}
+	return record.GitCommit
+}
+
+func shortCommit(commit string) string {
+	if len(commit) > shortCommitLength {
+		return commit[:shortCommitLength]
+	}
+	return commit
+}
+
+func slackLink(linkURL string, text string) string {
+	return fmt.Sprintf("<%s|%s>", linkURL, mrkdwnEscaper.Replace(text))
+}
+
+func (buildInfo *BuildInfo) branchText() string {
+	branchURL := buildInfo.BranchURL(strings.TrimSpace(buildInfo.BranchName))
+	if branchURL == "" {
+		return buildInfo.BranchName
+	}
+	return slackLink(branchURL, buildInfo.BranchName)
+}
+
+func (buildInfo *BuildInfo) commitText() string {
+	commit := strings.TrimSpace(buildInfo.GitCommit)
+	commitURL := buildInfo.CommitURL(commit)
+	if commitURL == "" {
+		return buildInfo.GitCommit
+	}
+	text := slackLink(commitURL, shortCommit(commit))
+	lastSuccessfulCommit := buildInfo.LastSuccessfulCommit()
+	if lastSuccessfulCommit != "" && lastSuccessfulCommit != commit {
+		text += " (" + slackLink(buildInfo.CompareURL(lastSuccessfulCommit, commit), "since "+shortCommit(lastSuccessfulCommit)) + ")"
+	}
+	return text
+}
@@ -0,0 +1,354 @@
+/*
+ * Copyright (c) 2021, salesforce.com, inc.
+ * All rights reserved.
+ * SPDX-License-Identifier: BSD-3-Clause
+ * For full license text, see the LICENSE file in the repo root or https://opensource.org/licenses/BSD-3-Clause
+ */
+package ciresult
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"github.com/slack-go/slack"
+	"log"
+	"net/http"
+	"net/smtp"
+	"net/url"
+	"strings"
+)
+
+var EmailConfigErrorMessage = "please specify SMTP_HOST and EMAIL_FROM to send email"
+
+var (
+	// attachmentColors are the hex values Slack renders for its named attachment colors
+	attachmentColors = map[string]string{
+		successStatus.color:  "#2EB886",
+		unstableStatus.color: "#DAA038",
+		failedStatus.color:   "#A30200",
+	}
+)
+
+/*
+SlackClient delivers builds through its Pipeline, which starts out with the built-in backends registered. Backends
+and Middleware can be added with Pipeline.Registry.Register and Pipeline.Use.
+*/
+type SlackClient struct {
+	slackClient
+	*Pipeline
+}
+
+// slackClient is the transport used by the built-in backends
+
+type slackClient interface {
+	postChannelMessage(ctx context.Context, buildInfo BuildInfo) error
+	postWebhookMessage(ctx context.Context, buildInfo BuildInfo) error
+	postTeamsMessage(ctx context.Context, buildInfo BuildInfo) error
+	postDiscordMessage(ctx context.Context, buildInfo BuildInfo) error
+	postMattermostMessage(ctx context.Context, buildInfo BuildInfo) error
+	postGenericWebhook(ctx context.Context, buildInfo BuildInfo) error
+	sendEmail(ctx context.Context, buildInfo BuildInfo) error
+	postAttachment(ctx context.Context, buildInfo BuildInfo, channel string, attachment slack.Attachment) error
+	postThreadReply(ctx context.Context, buildInfo BuildInfo, channel string, threadTimestamp string, text string) error
+}
+
+type slackAPI interface {
+	PostMessageContext(ctx context.Context, channelID string, options ...slack.MsgOption) (string, string, error)
+	UploadFileContext(ctx context.Context, params slack.UploadFileParameters) (*slack.FileSummary, error)
+}
+
+var _ slackAPI = (*slack.Client)(nil)
+
+type productionSlackClientWorker struct {
+	apiFactory    func(token string, options ...slack.Option) slackAPI
+	webhookPoster func(ctx context.Context, httpClient *http.Client, url string, msg *slack.WebhookMessage) error
+	jsonPoster    func(ctx context.Context, httpClient *http.Client, url string, payload interface{}) error
+	requestSender func(httpClient *http.Client, request *http.Request) error
+	mailSender    func(ctx context.Context, addr string, auth smtp.Auth, tlsConfig *tls.Config, from string, to []string, msg []byte) error
+}
+
+func (client *productionSlackClientWorker) api(buildInfo BuildInfo) (slackAPI, error) {
+	httpClient, err := buildInfo.HTTPClient("slack")
+	if err != nil {
+		return nil, err
+	}
+	return client.apiFactory(buildInfo.OauthToken, slack.OptionHTTPClient(httpClient), slack.OptionAPIURL(buildInfo.slackAPIURL())), nil
+}
+
+func (client *productionSlackClientWorker) postChannelMessage(ctx context.Context, buildInfo BuildInfo) error {
+	api, err := client.api(buildInfo)
+	if err != nil {
+		return err
+	}
+	postMessage := getPostMessage(buildInfo, buildInfo.GetContextualStatus())
+	_, timestamp, err := api.PostMessageContext(ctx, buildInfo.DestChannelId, postMessage...)
+	if err != nil {
+		return err
+	}
+	if buildInfo.slackMessage != nil {
+		buildInfo.slackMessage.timestamp = timestamp
+	}
+	// The message has been posted, so failing to upload the log is logged rather than failing (and retrying) it
+	err = uploadLog(ctx, api, buildInfo, timestamp)
+	if err != nil {
+		log.Printf("%s", err)
+	}
+	return nil
+}
+
+// uploadLog uploads the build's log excerpt in the thread of the message at timestamp, if there is one
+func uploadLog(ctx context.Context, api slackAPI, buildInfo BuildInfo, timestamp string) error {
+	if !buildInfo.ShouldUploadLog() {
+		return nil
+	}
+	excerpt, err := buildInfo.GetLogExcerpt()
+	if err != nil {
+		return fmt.Errorf("unable to read log: %s", err)
+	}
+	if excerpt == "" {
+		return nil
+	}
+	_, err = api.UploadFileContext(ctx, getLogUploadParameters(buildInfo, excerpt, timestamp))
+	if err != nil {
+		return fmt.Errorf("unable to upload log: %s", err)
+	}
+	return nil
+}
+
+func (client *productionSlackClientWorker) postWebhookMessage(ctx context.Context, buildInfo BuildInfo) error {
+	httpClient, err := buildInfo.HTTPClient("slack")
+	if err != nil {
+		return err
+	}
+	message := getWebhookMessage(buildInfo, buildInfo.GetContextualStatus())
+	return client.webhookPoster(ctx, httpClient, buildInfo.HookURL, &message)
+}
+
+func (client *productionSlackClientWorker) postTeamsMessage(ctx context.Context, buildInfo BuildInfo) error {
+	httpClient, err := buildInfo.HTTPClient("teams")
+	if err != nil {
+		return err
+	}
+	message := getTeamsMessage(buildInfo, buildInfo.GetContextualStatus())
+	return client.jsonPoster(ctx, httpClient, buildInfo.TeamsHookUrl, &message)
+}
+
+func (client *productionSlackClientWorker) postDiscordMessage(ctx context.Context, buildInfo BuildInfo) error {
+	httpClient, err := buildInfo.HTTPClient("discord")
+	if err != nil {
+		return err
+	}
+	message := getDiscordMessage(buildInfo, buildInfo.GetContextualStatus())
+	return client.jsonPoster(ctx, httpClient, buildInfo.DiscordHookUrl, &message)
+}
+
+func (client *productionSlackClientWorker) postMattermostMessage(ctx context.Context, buildInfo BuildInfo) error {
+	httpClient, err := buildInfo.HTTPClient("mattermost")
+	if err != nil {
+		return err
+	}
+	message := getMattermostMessage(buildInfo, buildInfo.GetContextualStatus())
+	return client.jsonPoster(ctx, httpClient, buildInfo.MattermostHookUrl, &message)
+}
+
+func (client *productionSlackClientWorker) postGenericWebhook(ctx context.Context, buildInfo BuildInfo) error {
+	httpClient, err := buildInfo.HTTPClient("webhook")
+	if err != nil {
+		return err
+	}
+	request, err := getWebhookRequest(ctx, buildInfo, buildInfo.GetContextualStatus())
+	if err != nil {
+		return err
+	}
+	return client.requestSender(httpClient, request)
+}
+
+func (client *productionSlackClientWorker) sendEmail(ctx context.Context, buildInfo BuildInfo) error {
+	if buildInfo.SmtpHost == "" || buildInfo.EmailFrom == "" {
+		return errors.New(EmailConfigErrorMessage)
+	}
+	email, err := getEmail(buildInfo, buildInfo.GetContextualStatus())
+	if err != nil {
+		return err
+	}
+	message, err := email.Bytes()
+	if err != nil {
+		return err
+	}
+	tlsConfig, err := buildInfo.TLSConfig()
+	if err != nil {
+		return err
+	}
+	addr, auth := buildInfo.smtpAddress()
+	return client.mailSender(ctx, addr, auth, tlsConfig, email.From, email.To, message)
+}
+
+/*
+postAttachment posts an attachment other than the build's (e.g. a digest) to channel via the app, or via HookURL
+when channel is empty
+*/
+func (client *productionSlackClientWorker) postAttachment(ctx context.Context, buildInfo BuildInfo, channel string, attachment slack.Attachment) error {
+	if channel != "" && buildInfo.OauthToken != "" {
+		api, err := client.api(buildInfo)
+		if err != nil {
+			return err
+		}
+		_, _, err = api.PostMessageContext(ctx, channel, getMessageOptions(buildInfo, attachment)...)
+		return err
+	}
+	if buildInfo.HookURL == "" {
+		return errors.New(PickRunModeErrorMessage)
+	}
+	httpClient, err := buildInfo.HTTPClient("slack")
+	if err != nil {
+		return err
+	}
+	return client.webhookPoster(ctx, httpClient, buildInfo.HookURL, &slack.WebhookMessage{Attachments: []slack.Attachment{attachment}})
+}
+
+/*
+postThreadReply posts text as a reply in the thread of the message at threadTimestamp in channel via the app
+*/
+func (client *productionSlackClientWorker) postThreadReply(ctx context.Context, buildInfo BuildInfo, channel string, threadTimestamp string, text string) error {
+	api, err := client.api(buildInfo)
+	if err != nil {
+		return err
+	}
+	msgOptions := append([]slack.MsgOption{slack.MsgOptionText(text, false), slack.MsgOptionTS(threadTimestamp)}, getTeamOptions(buildInfo)...)
+	_, _, err = api.PostMessageContext(ctx, channel, msgOptions...)
+	return err
+}
+
+/*
+PostToSlack posts the build to every configured destination: Slack (via the app or an incoming webhook), Microsoft
+Teams, Discord, Mattermost, a generic webhook, email and any backend added to the Pipeline
+*/
+func (client *SlackClient) PostToSlack(ctx context.Context, buildInfo BuildInfo) error {
+	return client.Pipeline.Notify(ctx, buildInfo)
+}
+
+func newSlackClient(transport slackClient) SlackClient {
+	return SlackClient{slackClient: transport, Pipeline: &Pipeline{Registry: newBuiltinRegistry(transport)}}
+}
+
+func NewSlackClient() SlackClient {
+	return newSlackClient(&productionSlackClientWorker{
+		apiFactory: func(token string, options ...slack.Option) slackAPI {
+			return slack.New(token, options...)
+		},
+		webhookPoster: func(ctx context.Context, httpClient *http.Client, url string, msg *slack.WebhookMessage) error {
+			return slack.PostWebhookCustomHTTPContext(ctx, url, httpClient, msg)
+		},
+		jsonPoster:    postJSONWebhook,
+		requestSender: sendWebhookRequest,
+		mailSender:    sendMail,
+	})
+}
+
+func getPostMessage(buildInfo BuildInfo, buildStatus Status) []slack.MsgOption {
+	return getMessageOptions(buildInfo, getAttachment(buildInfo, buildStatus))
+}
+
+func getMessageOptions(buildInfo BuildInfo, attachment slack.Attachment) []slack.MsgOption {
+	msgOptions := []slack.MsgOption{
+		slack.MsgOptionAttachments(attachment),
+	}
+	return append(msgOptions, getTeamOptions(buildInfo)...)
+}
+
+// getTeamOptions returns the option posting in SlackTeamId, if it's set
+func getTeamOptions(buildInfo BuildInfo) []slack.MsgOption {
+	if buildInfo.SlackTeamId == "" {
+		return nil
+	}
+	// slack-go has no team_id option, so chat.postMessage is set again along with it
+	return []slack.MsgOption{slack.UnsafeMsgOptionEndpoint(buildInfo.slackAPIURL()+"chat.postMessage", func(values url.Values) {
+		values.Set("team_id", buildInfo.SlackTeamId)
+	})}
+}
+
+/*
+slackAPIURL returns SlackApiUrl with the trailing slash slack-go expects, or the public Slack API
+*/
+func (buildInfo *BuildInfo) slackAPIURL() string {
+	if buildInfo.SlackApiUrl == "" {
+		return slack.APIURL
+	}
+	return strings.TrimSuffix(buildInfo.SlackApiUrl, "/") + "/"
+}
+
+func getWebhookMessage(buildInfo BuildInfo, buildStatus Status) slack.WebhookMessage {
+	attachment := getAttachment(buildInfo, buildStatus)
+	message := slack.WebhookMessage{Attachments: []slack.Attachment{attachment}}
+	return message
+}
+
+func getAttachment(buildInfo BuildInfo, buildStatus Status) slack.Attachment {
+	attachment := slack.Attachment{
+		Title:     fmt.Sprintf("%s: %s", buildStatus.text, buildInfo.JobName),
+		TitleLink: buildInfo.BuildURL,
+		Color:     getAttachmentColor(buildInfo, buildStatus),
+		Fields:    getSpecifiedAttachmentFields(buildInfo),
+	}
+	attachment = buildInfo.redactAttachment(attachment)
+	if buildInfo.silenced {
+		attachment = silenceAttachment(attachment)
+	}
+	return attachment
+}
+
+func getAttachmentColor(buildInfo BuildInfo, buildStatus Status) string {
+	if buildStatus.color == successStatus.color && buildInfo.CoverageDropped() {
+		return unstableStatus.color
+	}
+	return buildStatus.color
+}
+
+// attachmentColorHex returns the hex value of a named attachment color for platforms which only accept hex colors
+func attachmentColorHex(color string) string {
+	hex, present := attachmentColors[color]
+	if !present {
+		return color
+	}
+	return hex
+}
+
+func getSpecifiedAttachmentFields(buildInfo BuildInfo) []slack.AttachmentField {
+	var attachmentFields []slack.AttachmentField
+
+	appendAttachmentField(&attachmentFields, branchFieldTitle, buildInfo.branchText())
+	appendAttachmentField(&attachmentFields, commitFieldTitle, buildInfo.commitText())
+	appendAttachmentField(&attachmentFields, buildTimeFieldTitle, buildInfo.buildTimeText())
+	appendAttachmentField(&attachmentFields, triggeredByFieldTitle, buildInfo.TriggeredBy)
+	appendPullRequestField(&attachmentFields, buildInfo)
+	appendStagesField(&attachmentFields, buildInfo.Stages)
+	appendMatrixField(&attachmentFields, buildInfo)
+	appendChangelogField(&attachmentFields, buildInfo)
+	appendTestSummaryFields(&attachmentFields, buildInfo.TestSummary, buildInfo.MaxFailedTests)
+	appendGoTestSummaryFields(&attachmentFields, buildInfo)
+	appendCoverageField(&attachmentFields, buildInfo)
+	return attachmentFields
+}
+
+func appendAttachmentField(attachmentFields *[]slack.AttachmentField, fieldTitle string, fieldValue string) {
+	if strings.TrimSpace(fieldValue) != "" {
+		*attachmentFields = append(*attachmentFields, getAttachmentField(fieldTitle, fieldValue))
+	}
+}
+
+func getAttachmentField(title string, value string) slack.AttachmentField {
+	return slack.AttachmentField{
+		Title: title,
+		Value: value,
+		Short: true,
+	}
+}
+
+func getLongAttachmentField(title string, value string) slack.AttachmentField {
+	return slack.AttachmentField{
+		Title: title,
+		Value: value,
+		Short: false,
+	}
+}
@@ -0,0 +1,884 @@
+/*
+ * Copyright (c) 2021, salesforce.com, inc.
+ * All rights reserved.
+ * SPDX-License-Identifier: BSD-3-Clause
+ * For full license text, see the LICENSE file in the repo root or https://opensource.org/licenses/BSD-3-Clause
+ */
+package ciresult
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/slack-go/slack"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"testing"
+	"time"
+)
+
+const channelMessageTestErr = "error from postChannelMessage"
+const webhookMessageTestErr = "error from postWebhookMessage"
+const teamsMessageTestErr = "error from postTeamsMessage"
+const discordMessageTestErr = "error from postDiscordMessage"
+const mattermostMessageTestErr = "error from postMattermostMessage"
+const genericWebhookTestErr = "error from postGenericWebhook"
+const emailTestErr = "error from sendEmail"
+const attachmentTestErr = "error from postAttachment"
+const threadReplyTestErr = "error from postThreadReply"
+
+type testSlackClientWorker struct {
+	postChannelMessageShouldError    bool
+	postWebhookMessageShouldError    bool
+	postTeamsMessageShouldError      bool
+	postDiscordMessageShouldError    bool
+	postMattermostMessageShouldError bool
+	postGenericWebhookShouldError    bool
+	sendEmailShouldError             bool
+	postAttachmentShouldError        bool
+	postThreadReplyShouldError       bool
+}
+
+func (client *testSlackClientWorker) postChannelMessage(ctx context.Context, buildInfo BuildInfo) error {
+	if client.postChannelMessageShouldError {
+		return errors.New(channelMessageTestErr)
+	}
+	return nil
+}
+
+func (client *testSlackClientWorker) postWebhookMessage(ctx context.Context, buildInfo BuildInfo) error {
+	if client.postWebhookMessageShouldError {
+		return errors.New(webhookMessageTestErr)
+	}
+	return nil
+}
+
+func (client *testSlackClientWorker) postTeamsMessage(ctx context.Context, buildInfo BuildInfo) error {
+	if client.postTeamsMessageShouldError {
+		return errors.New(teamsMessageTestErr)
+	}
+	return nil
+}
+
+func (client *testSlackClientWorker) postDiscordMessage(ctx context.Context, buildInfo BuildInfo) error {
+	if client.postDiscordMessageShouldError {
+		return errors.New(discordMessageTestErr)
+	}
+	return nil
+}
+
+func (client *testSlackClientWorker) postMattermostMessage(ctx context.Context, buildInfo BuildInfo) error {
+	if client.postMattermostMessageShouldError {
+		return errors.New(mattermostMessageTestErr)
+	}
+	return nil
+}
+
+func (client *testSlackClientWorker) postGenericWebhook(ctx context.Context, buildInfo BuildInfo) error {
+	if client.postGenericWebhookShouldError {
+		return errors.New(genericWebhookTestErr)
+	}
+	return nil
+}
+
+func (client *testSlackClientWorker) sendEmail(ctx context.Context, buildInfo BuildInfo) error {
+	if client.sendEmailShouldError {
+		return errors.New(emailTestErr)
+	}
+	return nil
+}
+
+func (client *testSlackClientWorker) postAttachment(ctx context.Context, buildInfo BuildInfo, channel string, attachment slack.Attachment) error {
+	if client.postAttachmentShouldError {
+		return errors.New(attachmentTestErr)
+	}
+	return nil
+}
+
+func (client *testSlackClientWorker) postThreadReply(ctx context.Context, buildInfo BuildInfo, channel string, threadTimestamp string, text string) error {
+	if client.postThreadReplyShouldError {
+		return errors.New(threadReplyTestErr)
+	}
+	return nil
+}
+
+func newTestClient(postChannelMessageShouldError bool, postWebhookMessageShouldError bool) SlackClient {
+	return newSlackClient(&testSlackClientWorker{
+		postWebhookMessageShouldError: postWebhookMessageShouldError,
+		postChannelMessageShouldError: postChannelMessageShouldError,
+	})
+}
+
+var (
+	jobName    = "my test job"
+	buildURL   = "https://www.com"
+	branchName = "test branch name"
+
+	branchNameField  = getAttachmentField(branchFieldTitle, branchName)
+	commit           = "8675309"
+	commitField      = getAttachmentField(commitFieldTitle, commit)
+	buildTime        = "0m 3s"
+	buildTimeField   = getAttachmentField(buildTimeFieldTitle, buildTime)
+	triggeredBy      = "Pull request"
+	triggeredByField = getAttachmentField(triggeredByFieldTitle, triggeredBy)
+
+	emptyAttachmentFields []slack.AttachmentField
+)
+
+func Test_PostToSlack(t *testing.T) {
+	happySlackClient := newTestClient(false, false)
+
+	type args struct {
+		buildInfo   BuildInfo
+		slackClient SlackClient
+	}
+	tests := []struct {
+		name    string
+		args    args
+		wantErr bool
+		errTest string
+	}{
+		{
+			"run mode error thrown if HOOK_URL, DEST_CHANNEL_ID, and OAUTH_TOKEN not specified",
+			args{
+				buildInfo: BuildInfo{
+					JobName:     "somejob",
+					BuildURL:    "someurl",
+					BuildStatus: "somestatus",
+				},
+				slackClient: happySlackClient,
+			},
+			true,
+			PickRunModeErrorMessage,
+		},
+		{
+			"run mode error thrown if OAUTH_TOKEN not specified with DEST_CHANNEL_ID",
+			args{
+				buildInfo: BuildInfo{
+					JobName:       "somejob",
+					BuildURL:      "someurl",
+					BuildStatus:   "somestatus",
+					DestChannelId: "somechannelid",
+				},
+				slackClient: happySlackClient,
+			},
+			true,
+			PickRunModeErrorMessage,
+		},
+		{
+			"run mode error thrown if DEST_CHANNEL_ID not specified with OAUTH_TOKEN",
+			args{
+				buildInfo: BuildInfo{
+					JobName:     "somejob",
+					BuildURL:    "someurl",
+					BuildStatus: "somestatus",
+					OauthToken:  "sometoken",
+				},
+				slackClient: happySlackClient,
+			},
+			true,
+			PickRunModeErrorMessage,
+		},
+		{
+			"successful post if client is happy and we've filled in all required values and a hookURL",
+			args{
+				buildInfo: BuildInfo{
+					JobName:     "somejob",
+					BuildURL:    "someurl",
+					BuildStatus: "somestatus",
+					HookURL:     "somehookurl",
+				},
+				slackClient: happySlackClient,
+			},
+			false,
+			"",
+		},
+		{
+			"successful post if client is happy and we've filled in all required values and a destChannelID / Oauth",
+			args{
+				buildInfo: BuildInfo{
+					JobName:       "somejob",
+					BuildURL:      "someurl",
+					BuildStatus:   "somestatus",
+					DestChannelId: "somechannel",
+					OauthToken:    "sometoken",
+				},
+				slackClient: happySlackClient,
+			},
+			false,
+			"",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.args.slackClient.PostToSlack(context.Background(), tt.args.buildInfo)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("PostToSlack() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+		})
+	}
+}
+
+func Test_getWebhookMessage(t *testing.T) {
+	type args struct {
+		buildInfo   BuildInfo
+		buildStatus Status
+	}
+	tests := []struct {
+		name string
+		args args
+		want slack.WebhookMessage
+	}{
+		{"success - required fields only",
+			args{
+				buildInfo: BuildInfo{
+					JobName:     jobName,
+					BuildURL:    buildURL,
+					BuildStatus: successKey,
+				},
+				buildStatus: successStatus,
+			},
+			slack.WebhookMessage{Attachments: []slack.Attachment{
+				{
+					Title:     fmt.Sprintf("%s: %s", successStatus.text, jobName),
+					TitleLink: buildURL,
+					Color:     "good",
+				}}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := getWebhookMessage(tt.args.buildInfo, tt.args.buildStatus); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("getWebhookMessage() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_getSpecifiedAttachmentFields(t *testing.T) {
+	type args struct {
+		buildInfo BuildInfo
+	}
+	tests := []struct {
+		name string
+		args args
+		want []slack.AttachmentField
+	}{
+		{"all the fields",
+			args{buildInfo: BuildInfo{
+				BranchName:  branchName,
+				GitCommit:   commit,
+				BuildTime:   buildTime,
+				TriggeredBy: triggeredBy,
+			}},
+			[]slack.AttachmentField{
+				branchNameField,
+				commitField,
+				buildTimeField,
+				triggeredByField,
+			},
+		},
+		{"branch name",
+			args{buildInfo: BuildInfo{BranchName: branchName}},
+			[]slack.AttachmentField{branchNameField}},
+		{"commit",
+			args{buildInfo: BuildInfo{GitCommit: commit}},
+			[]slack.AttachmentField{commitField}},
+		{"build time",
+			args{buildInfo: BuildInfo{BuildTime: buildTime}},
+			[]slack.AttachmentField{buildTimeField}},
+		{"triggered by",
+			args{buildInfo: BuildInfo{TriggeredBy: triggeredBy}},
+			[]slack.AttachmentField{triggeredByField}},
+		{"no fields in build info",
+			args{buildInfo: BuildInfo{}},
+			emptyAttachmentFields},
+		{"empty value",
+			args{buildInfo: BuildInfo{BuildTime: ""}},
+			emptyAttachmentFields},
+		{"whitespace value",
+			args{buildInfo: BuildInfo{BuildTime: "  "}},
+			emptyAttachmentFields},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := getSpecifiedAttachmentFields(tt.args.buildInfo); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("getSpecifiedAttachmentFields() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_getAttachment(t *testing.T) {
+	type args struct {
+		buildInfo   BuildInfo
+		buildStatus Status
+	}
+	tests := []struct {
+		name string
+		args args
+		want slack.Attachment
+	}{
+		{"success - required fields only",
+			args{
+				buildInfo: BuildInfo{
+					JobName:     jobName,
+					BuildURL:    buildURL,
+					BuildStatus: successKey,
+				},
+				buildStatus: successStatus,
+			},
+			slack.Attachment{
+				Title:     fmt.Sprintf("%s: %s", successStatus.text, jobName),
+				TitleLink: buildURL,
+				Color:     "good",
+			}},
+		{"success - with attachments",
+			args{
+				buildInfo: BuildInfo{
+					JobName:     jobName,
+					BuildURL:    buildURL,
+					BuildStatus: successKey,
+					BranchName:  branchName,
+					GitCommit:   commit,
+					BuildTime:   buildTime,
+					TriggeredBy: triggeredBy,
+				},
+				buildStatus: successStatus,
+			},
+			slack.Attachment{
+				Title:     fmt.Sprintf("%s: %s", successStatus.text, jobName),
+				TitleLink: buildURL,
+				Color:     "good",
+				Fields: []slack.AttachmentField{
+					branchNameField,
+					commitField,
+					buildTimeField,
+					triggeredByField,
+				},
+			}},
+		{"failure - required fields only",
+			args{
+				buildInfo: BuildInfo{
+					JobName:     jobName,
+					BuildURL:    buildURL,
+					BuildStatus: "FAILURE",
+				},
+				buildStatus: failedStatus,
+			},
+			slack.Attachment{
+				Title:     fmt.Sprintf("%s: %s", failedStatus.text, jobName),
+				TitleLink: buildURL,
+				Color:     "danger",
+			}},
+		{"unstable - required fields only",
+			args{
+				buildInfo: BuildInfo{
+					JobName:     jobName,
+					BuildURL:    buildURL,
+					BuildStatus: "UNSTABLE",
+				},
+				buildStatus: unstableStatus,
+			},
+			slack.Attachment{
+				Title:     fmt.Sprintf("%s: %s", unstableStatus.text, jobName),
+				TitleLink: buildURL,
+				Color:     "warning",
+			}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := getAttachment(tt.args.buildInfo, tt.args.buildStatus); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("getAttachment() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_getPostMessage(t *testing.T) {
+	buildInfo := BuildInfo{
+		JobName:     "test-job",
+		BuildURL:    "https://example.com/build/1",
+		BuildStatus: successKey,
+		BranchName:  "main",
+		GitCommit:   "abc123",
+	}
+
+	msgOptions := getPostMessage(buildInfo, successStatus)
+
+	if len(msgOptions) == 0 {
+		t.Error("Expected message options to be returned")
+	}
+
+	// Verify the structure contains message options (we can't easily inspect MsgOption internals)
+	// This ensures the function executes and returns the expected slice structure
+}
+
+// fakeSlackAPI is a test double for the slackAPI interface.
+type fakeSlackAPI struct {
+	capturedChannelID string
+	capturedOptions   []slack.MsgOption
+	capturedUploads   []slack.UploadFileParameters
+	timestamp         string
+	err               error
+	uploadErr         error
+}
+
+func (f *fakeSlackAPI) PostMessageContext(ctx context.Context, channelID string, options ...slack.MsgOption) (string, string, error) {
+	f.capturedChannelID = channelID
+	f.capturedOptions = options
+	return channelID, f.timestamp, f.err
+}
+
+func (f *fakeSlackAPI) UploadFileContext(ctx context.Context, params slack.UploadFileParameters) (*slack.FileSummary, error) {
+	f.capturedUploads = append(f.capturedUploads, params)
+	return &slack.FileSummary{}, f.uploadErr
+}
+
+func Test_productionSlackClientWorker_postChannelMessage(t *testing.T) {
+	t.Run("calls PostMessage with correct channelID and non-empty options", func(t *testing.T) {
+		fakeAPI := &fakeSlackAPI{}
+		worker := &productionSlackClientWorker{
+			apiFactory: func(token string, options ...slack.Option) slackAPI { return fakeAPI },
+		}
+		buildInfo := BuildInfo{
+			JobName:       "test-job",
+			BuildURL:      "https://example.com",
+			BuildStatus:   successKey,
+			OauthToken:    "token",
+			DestChannelId: "C12345",
+		}
+		err := worker.postChannelMessage(context.Background(), buildInfo)
+		if err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+		if fakeAPI.capturedChannelID != "C12345" {
+			t.Errorf("expected channelID %q, got %q", "C12345", fakeAPI.capturedChannelID)
+		}
+		if len(fakeAPI.capturedOptions) == 0 {
+			t.Error("expected non-empty message options")
+		}
+	})
+
+	t.Run("propagates error from PostMessage", func(t *testing.T) {
+		fakeAPI := &fakeSlackAPI{err: fmt.Errorf("api error")}
+		worker := &productionSlackClientWorker{
+			apiFactory: func(token string, options ...slack.Option) slackAPI { return fakeAPI },
+		}
+		buildInfo := BuildInfo{
+			OauthToken:    "token",
+			DestChannelId: "C12345",
+			BuildStatus:   successKey,
+		}
+		err := worker.postChannelMessage(context.Background(), buildInfo)
+		if err == nil || err.Error() != "api error" {
+			t.Errorf("expected 'api error', got %v", err)
+		}
+	})
+}
+
+func Test_productionSlackClientWorker_postChannelMessageUploadsLog(t *testing.T) {
+	buildInfo := BuildInfo{
+		JobName:       "test-job",
+		BuildURL:      "https://example.com",
+		BuildStatus:   failureKey,
+		OauthToken:    "token",
+		DestChannelId: "C12345",
+		LogFile:       testLogFile,
+		LogTailLines:  1,
+	}
+
+	t.Run("uploads log excerpt in the message thread", func(t *testing.T) {
+		fakeAPI := &fakeSlackAPI{timestamp: "1234.5678"}
+		worker := &productionSlackClientWorker{
+			apiFactory: func(token string, options ...slack.Option) slackAPI { return fakeAPI },
+		}
+		err := worker.postChannelMessage(context.Background(), buildInfo)
+		if err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+		want := []slack.UploadFileParameters{getLogUploadParameters(buildInfo, "Finished: FAILURE", "1234.5678")}
+		if !reflect.DeepEqual(fakeAPI.capturedUploads, want) {
+			t.Errorf("expected uploads %+v, got %+v", want, fakeAPI.capturedUploads)
+		}
+	})
+
+	t.Run("skips upload for successful builds", func(t *testing.T) {
+		fakeAPI := &fakeSlackAPI{}
+		worker := &productionSlackClientWorker{
+			apiFactory: func(token string, options ...slack.Option) slackAPI { return fakeAPI },
+		}
+		successfulBuild := buildInfo
+		successfulBuild.BuildStatus = successKey
+		err := worker.postChannelMessage(context.Background(), successfulBuild)
+		if err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+		if len(fakeAPI.capturedUploads) != 0 {
+			t.Errorf("expected no uploads, got %+v", fakeAPI.capturedUploads)
+		}
+	})
+
+	t.Run("doesn't fail the posted message when UploadFile fails", func(t *testing.T) {
+		fakeAPI := &fakeSlackAPI{timestamp: "1234.5678", uploadErr: fmt.Errorf("upload error")}
+		worker := &productionSlackClientWorker{
+			apiFactory: func(token string, options ...slack.Option) slackAPI { return fakeAPI },
+		}
+		message := &postedMessage{}
+		failingBuild := buildInfo
+		failingBuild.slackMessage = message
+		err := worker.postChannelMessage(context.Background(), failingBuild)
+		if err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+		if message.timestamp != "1234.5678" {
+			t.Errorf("expected the posted message to be reported, got %+v", message)
+		}
+	})
+
+	t.Run("doesn't fail the posted message when the log can't be read", func(t *testing.T) {
+		fakeAPI := &fakeSlackAPI{}
+		worker := &productionSlackClientWorker{
+			apiFactory: func(token string, options ...slack.Option) slackAPI { return fakeAPI },
+		}
+		missingLog := buildInfo
+		missingLog.LogFile = "testdata/missing.log"
+		err := worker.postChannelMessage(context.Background(), missingLog)
+		if err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+		if len(fakeAPI.capturedUploads) != 0 {
+			t.Errorf("expected no uploads, got %+v", fakeAPI.capturedUploads)
+		}
+	})
+}
+
+func Test_productionSlackClientWorker_postWebhookMessage(t *testing.T) {
+	t.Run("calls webhookPoster with correct URL and non-nil message", func(t *testing.T) {
+		var capturedURL string
+		var capturedMsg *slack.WebhookMessage
+		worker := &productionSlackClientWorker{
+			webhookPoster: func(ctx context.Context, httpClient *http.Client, url string, msg *slack.WebhookMessage) error {
+				capturedURL = url
+				capturedMsg = msg
+				return nil
+			},
+		}
+		buildInfo := BuildInfo{
+			JobName:     "test-job",
+			BuildURL:    "https://example.com",
+			BuildStatus: successKey,
+			HookURL:     "https://hooks.slack.com/test",
+		}
+		err := worker.postWebhookMessage(context.Background(), buildInfo)
+		if err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+		if capturedURL != "https://hooks.slack.com/test" {
+			t.Errorf("expected URL %q, got %q", "https://hooks.slack.com/test", capturedURL)
+		}
+		if capturedMsg == nil {
+			t.Error("expected non-nil webhook message")
+		}
+	})
+
+	t.Run("propagates error from webhookPoster", func(t *testing.T) {
+		worker := &productionSlackClientWorker{
+			webhookPoster: func(ctx context.Context, httpClient *http.Client, url string, msg *slack.WebhookMessage) error {
+				return fmt.Errorf("webhook error")
+			},
+		}
+		buildInfo := BuildInfo{
+			HookURL:     "https://hooks.slack.com/test",
+			BuildStatus: successKey,
+		}
+		err := worker.postWebhookMessage(context.Background(), buildInfo)
+		if err == nil || err.Error() != "webhook error" {
+			t.Errorf("expected 'webhook error', got %v", err)
+		}
+	})
+}
+
+func Test_NewSlackClient(t *testing.T) {
+	client := NewSlackClient()
+	if client.slackClient == nil {
+		t.Error("Expected non-nil slack client")
+	}
+}
+
+func Test_PostToSlack_EdgeCases(t *testing.T) {
+	tests := []struct {
+		name        string
+		buildInfo   BuildInfo
+		slackClient SlackClient
+		wantErr     bool
+		errContains string
+	}{
+		{
+			"both webhook and oauth set - should prefer oauth and succeed",
+			BuildInfo{
+				JobName:       "job",
+				BuildURL:      "url",
+				BuildStatus:   "SUCCESS",
+				HookURL:       "https://hook",
+				OauthToken:    "token",
+				DestChannelId: "channel",
+			},
+			newTestClient(false, false),
+			false,
+			"",
+		},
+		{
+			"empty strings should be treated as not set",
+			BuildInfo{
+				JobName:       "job",
+				BuildURL:      "url",
+				BuildStatus:   "SUCCESS",
+				HookURL:       "",
+				OauthToken:    "",
+				DestChannelId: "",
+			},
+			newTestClient(false, false),
+			true,
+			PickRunModeErrorMessage,
+		},
+		{
+			"only oauth token without channel id should error",
+			BuildInfo{
+				JobName:     "job",
+				BuildURL:    "url",
+				BuildStatus: "SUCCESS",
+				OauthToken:  "token",
+			},
+			newTestClient(false, false),
+			true,
+			PickRunModeErrorMessage,
+		},
+		{
+			"only channel id without oauth token should error",
+			BuildInfo{
+				JobName:       "job",
+				BuildURL:      "url",
+				BuildStatus:   "SUCCESS",
+				DestChannelId: "channel",
+			},
+			newTestClient(false, false),
+			true,
+			PickRunModeErrorMessage,
+		},
+		{
+			"channel message client returns error - PostToSlack propagates it",
+			BuildInfo{
+				JobName:       "job",
+				BuildURL:      "url",
+				BuildStatus:   "SUCCESS",
+				OauthToken:    "token",
+				DestChannelId: "channel",
+			},
+			newTestClient(true, false),
+			true,
+			channelMessageTestErr,
+		},
+		{
+			"webhook client returns error - PostToSlack propagates it",
+			BuildInfo{
+				JobName:     "job",
+				BuildURL:    "url",
+				BuildStatus: "SUCCESS",
+				HookURL:     "https://hooks.slack.com/test",
+			},
+			newTestClient(false, true),
+			true,
+			webhookMessageTestErr,
+		},
+		{
+			"teams webhook alone is enough",
+			BuildInfo{
+				JobName:      "job",
+				BuildURL:     "url",
+				BuildStatus:  "SUCCESS",
+				TeamsHookUrl: "https://example.webhook.office.com/test",
+			},
+			newTestClient(false, false),
+			false,
+			"",
+		},
+		{
+			"teams client returns error - PostToSlack propagates it",
+			BuildInfo{
+				JobName:      "job",
+				BuildURL:     "url",
+				BuildStatus:  "SUCCESS",
+				TeamsHookUrl: "https://example.webhook.office.com/test",
+			},
+			newSlackClient(&testSlackClientWorker{postTeamsMessageShouldError: true}),
+			true,
+			"unable to post to Teams: " + teamsMessageTestErr,
+		},
+		{
+			"slack and teams errors are both reported",
+			BuildInfo{
+				JobName:      "job",
+				BuildURL:     "url",
+				BuildStatus:  "SUCCESS",
+				HookURL:      "https://hooks.slack.com/test",
+				TeamsHookUrl: "https://example.webhook.office.com/test",
+			},
+			newSlackClient(&testSlackClientWorker{postWebhookMessageShouldError: true, postTeamsMessageShouldError: true}),
+			true,
+			webhookMessageTestErr + "\nunable to post to Teams: " + teamsMessageTestErr,
+		},
+		{
+			"every destination is posted to",
+			BuildInfo{
+				JobName:           "job",
+				BuildURL:          "url",
+				BuildStatus:       "SUCCESS",
+				TeamsHookUrl:      "https://example.webhook.office.com/test",
+				DiscordHookUrl:    "https://discord.com/api/webhooks/test",
+				MattermostHookUrl: "https://mattermost.example.com/hooks/test",
+			},
+			newSlackClient(&testSlackClientWorker{postDiscordMessageShouldError: true, postMattermostMessageShouldError: true}),
+			true,
+			"unable to post to Discord: " + discordMessageTestErr + "\nunable to post to Mattermost: " + mattermostMessageTestErr,
+		},
+		{
+			"webhook and email errors are reported",
+			BuildInfo{
+				JobName:     "job",
+				BuildURL:    "url",
+				BuildStatus: "SUCCESS",
+				WebhookUrl:  "https://dashboard.example.com/builds",
+				EmailTo:     "dev@example.com",
+			},
+			newSlackClient(&testSlackClientWorker{postGenericWebhookShouldError: true, sendEmailShouldError: true}),
+			true,
+			"unable to post to webhook: " + genericWebhookTestErr + "\nunable to post to email: " + emailTestErr,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.slackClient.PostToSlack(context.Background(), tt.buildInfo)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("PostToSlack() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.errContains != "" && err != nil && err.Error() != tt.errContains {
+				t.Errorf("PostToSlack() error = %v, expected to contain %v", err.Error(), tt.errContains)
+			}
+		})
+	}
+}
+
+func Test_productionSlackClientWorker_honorsContext(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-release:
+		}
+	}))
+	defer server.Close()
+	defer close(release)
+	worker := NewSlackClient().slackClient.(*productionSlackClientWorker)
+	buildInfo := BuildInfo{
+		SlackApiUrl:    server.URL,
+		JobName:        "job",
+		BuildStatus:    failureKey,
+		OauthToken:     "token",
+		DestChannelId:  "C12345",
+		HookURL:        server.URL,
+		TeamsHookUrl:   server.URL,
+		DiscordHookUrl: server.URL,
+		WebhookUrl:     server.URL,
+	}
+	for name, post := range map[string]func(ctx context.Context, buildInfo BuildInfo) error{
+		"channel": worker.postChannelMessage,
+		"webhook": worker.postWebhookMessage,
+		"teams":   worker.postTeamsMessage,
+		"generic": worker.postGenericWebhook,
+		"discord": worker.postDiscordMessage,
+	} {
+		t.Run(name, func(t *testing.T) {
+			ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+			defer cancel()
+			err := post(ctx, buildInfo)
+			if !errors.Is(err, context.DeadlineExceeded) {
+				t.Errorf("expected the deadline to cut the request short, got %v", err)
+			}
+		})
+	}
+}
+
+func Test_PostToSlackKeepsContextErrors(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-release:
+		}
+	}))
+	defer server.Close()
+	defer close(release)
+	buildInfo := NewBuildInfo("job", "https://ci/1", failureKey)
+	buildInfo.TeamsHookUrl = server.URL
+	client := NewSlackClient()
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	err := client.PostToSlack(ctx, buildInfo)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("PostToSlack() error = %v, want it to wrap context.DeadlineExceeded", err)
+	}
+}
+
+func Test_postChannelMessage_slackAPIURLAndTeam(t *testing.T) {
+	tests := []struct {
+		name        string
+		apiURL      func(serverURL string) string
+		teamId      string
+		wantTeamId  string
+		wantPresent bool
+	}{
+		{"api url without trailing slash", func(serverURL string) string { return serverURL + "/api" }, "", "", false},
+		{"api url with trailing slash", func(serverURL string) string { return serverURL + "/api/" }, "", "", false},
+		{"team id", func(serverURL string) string { return serverURL + "/api" }, "T0123", "T0123", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var paths []string
+			var forms []url.Values
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				_ = r.ParseForm()
+				paths = append(paths, r.URL.Path)
+				forms = append(forms, r.PostForm)
+				w.Header().Set("Content-Type", "application/json")
+				_, _ = w.Write([]byte(`{"ok": true, "channel": "C12345", "ts": "1234.5678"}`))
+			}))
+			defer server.Close()
+			worker := NewSlackClient().slackClient.(*productionSlackClientWorker)
+			buildInfo := BuildInfo{
+				JobName:       "job",
+				BuildStatus:   failureKey,
+				OauthToken:    "token",
+				DestChannelId: "C12345",
+				SlackApiUrl:   tt.apiURL(server.URL),
+				SlackTeamId:   tt.teamId,
+			}
+			err := worker.postChannelMessage(context.Background(), buildInfo)
+			if err != nil {
+				t.Fatalf("postChannelMessage() unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(paths, []string{"/api/chat.postMessage"}) {
+				t.Fatalf("postChannelMessage() requested %v, want [/api/chat.postMessage]", paths)
+			}
+			teamId, present := forms[0]["team_id"]
+			if present != tt.wantPresent || (present && teamId[0] != tt.wantTeamId) {
+				t.Errorf("postChannelMessage() team_id = %v, want %q", teamId, tt.wantTeamId)
+			}
+			if forms[0].Get("channel") != "C12345" {
+				t.Errorf("postChannelMessage() channel = %q, want C12345", forms[0].Get("channel"))
+			}
+		})
+	}
+}
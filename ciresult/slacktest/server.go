@@ -0,0 +1,237 @@
+/*
+ * Copyright (c) 2021, salesforce.com, inc.
+ * All rights reserved.
+ * SPDX-License-Identifier: BSD-3-Clause
+ * For full license text, see the LICENSE file in the repo root or https://opensource.org/licenses/BSD-3-Clause
+ */
+
+/*
+Package slacktest provides a fake Slack server for integration tests. It serves the Web API methods ciresult calls
+and incoming webhooks, records every request and can be told to fail requests with HTTP errors. Point SLACK_API_URL
+at APIURL and HOOK_URL at WebhookURL to use it.
+*/
+package slacktest
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/slack-go/slack"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+)
+
+// Endpoints a Request can be made to, which are also used to inject failures
+const (
+	PostMessage    = "chat.postMessage"
+	UpdateMessage  = "chat.update"
+	GetUploadURL   = "files.getUploadURLExternal"
+	Upload         = "upload"
+	CompleteUpload = "files.completeUploadExternal"
+	Webhook        = "webhook"
+)
+
+const apiPath = "/api/"
+const uploadPath = "/upload/"
+const webhookPath = "/services/T00000000/B00000000/XXXXXXXXXXXXXXXXXXXXXXXX"
+
+// firstTimestamp is the timestamp of the first message posted, later messages count up from it
+const firstTimestamp = 1700000000
+
+/*
+Request is a request received by the Server
+*/
+type Request struct {
+	// Endpoint is the Web API method (e.g. chat.postMessage), Upload or Webhook
+	Endpoint string
+	Header   http.Header
+	// Form holds the parameters of Web API methods
+	Form url.Values
+	// Body is the raw request body, or the uploaded file's content for Upload
+	Body []byte
+}
+
+/*
+Attachments decodes the attachments of a chat.postMessage, chat.update or webhook request
+*/
+func (request Request) Attachments() ([]slack.Attachment, error) {
+	var attachments []slack.Attachment
+	if request.Endpoint == Webhook {
+		var message slack.WebhookMessage
+		err := json.Unmarshal(request.Body, &message)
+		return message.Attachments, err
+	}
+	encoded := request.Form.Get("attachments")
+	if encoded == "" {
+		return nil, nil
+	}
+	err := json.Unmarshal([]byte(encoded), &attachments)
+	return attachments, err
+}
+
+/*
+Server is a fake Slack. Create one with NewServer and Close it when done.
+*/
+type Server struct {
+	// URL is the base URL of the server, without a trailing slash
+	URL string
+
+	server   *httptest.Server
+	mutex    sync.Mutex
+	requests []Request
+	failures map[string][]int
+	posted   int
+	uploaded int
+}
+
+/*
+NewServer starts a fake Slack server
+*/
+func NewServer() *Server {
+	server := &Server{failures: map[string][]int{}}
+	server.server = httptest.NewServer(http.HandlerFunc(server.handle))
+	server.URL = server.server.URL
+	return server
+}
+
+/*
+Close shuts the server down
+*/
+func (server *Server) Close() {
+	server.server.Close()
+}
+
+/*
+APIURL returns the Web API base URL, for SLACK_API_URL or slack.OptionAPIURL
+*/
+func (server *Server) APIURL() string {
+	return server.URL + apiPath
+}
+
+/*
+WebhookURL returns an incoming webhook URL, for HOOK_URL
+*/
+func (server *Server) WebhookURL() string {
+	return server.URL + webhookPath
+}
+
+/*
+Requests returns the requests received for endpoint in order, or every request if endpoint is empty
+*/
+func (server *Server) Requests(endpoint string) []Request {
+	server.mutex.Lock()
+	defer server.mutex.Unlock()
+	var requests []Request
+	for _, request := range server.requests {
+		if endpoint == "" || request.Endpoint == endpoint {
+			requests = append(requests, request)
+		}
+	}
+	return requests
+}
+
+/*
+Fail makes the next times requests to endpoint fail with statusCode. Rate limit (429) responses ask the client to
+retry after a second.
+*/
+func (server *Server) Fail(endpoint string, statusCode int, times int) {
+	server.mutex.Lock()
+	defer server.mutex.Unlock()
+	for i := 0; i < times; i++ {
+		server.failures[endpoint] = append(server.failures[endpoint], statusCode)
+	}
+}
+
+func (server *Server) handle(w http.ResponseWriter, r *http.Request) {
+	request, err := readRequest(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	server.mutex.Lock()
+	defer server.mutex.Unlock()
+	server.requests = append(server.requests, request)
+	if failures := server.failures[request.Endpoint]; len(failures) > 0 {
+		server.failures[request.Endpoint] = failures[1:]
+		if failures[0] == http.StatusTooManyRequests {
+			w.Header().Set("Retry-After", "1")
+		}
+		http.Error(w, http.StatusText(failures[0]), failures[0])
+		return
+	}
+
+	switch request.Endpoint {
+	case Webhook:
+		_, _ = io.WriteString(w, "ok")
+	case Upload:
+		_, _ = io.WriteString(w, "OK - "+fmt.Sprint(len(request.Body)))
+	case PostMessage:
+		server.posted++
+		writeJSON(w, map[string]interface{}{
+			"ok":      true,
+			"channel": request.Form.Get("channel"),
+			"ts":      fmt.Sprintf("%d.%06d", firstTimestamp+server.posted, 0),
+		})
+	case UpdateMessage:
+		writeJSON(w, map[string]interface{}{
+			"ok":      true,
+			"channel": request.Form.Get("channel"),
+			"ts":      request.Form.Get("ts"),
+			"text":    request.Form.Get("text"),
+		})
+	case GetUploadURL:
+		server.uploaded++
+		fileID := fmt.Sprintf("F%08d", server.uploaded)
+		writeJSON(w, map[string]interface{}{
+			"ok":         true,
+			"upload_url": server.URL + uploadPath + fileID,
+			"file_id":    fileID,
+		})
+	case CompleteUpload:
+		var files []slack.FileSummary
+		_ = json.Unmarshal([]byte(request.Form.Get("files")), &files)
+		writeJSON(w, map[string]interface{}{"ok": true, "files": files})
+	default:
+		writeJSON(w, map[string]interface{}{"ok": false, "error": "unknown_method"})
+	}
+}
+
+func readRequest(r *http.Request) (Request, error) {
+	request := Request{Header: r.Header.Clone()}
+	switch {
+	case r.URL.Path == webhookPath:
+		request.Endpoint = Webhook
+	case strings.HasPrefix(r.URL.Path, uploadPath):
+		request.Endpoint = Upload
+		file, _, err := r.FormFile("file")
+		if err != nil {
+			return request, fmt.Errorf("unable to read upload: %s", err)
+		}
+		defer file.Close()
+		request.Body, err = io.ReadAll(file)
+		return request, err
+	case strings.HasPrefix(r.URL.Path, apiPath):
+		request.Endpoint = strings.TrimPrefix(r.URL.Path, apiPath)
+	default:
+		return request, errors.New("unknown path " + r.URL.Path)
+	}
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		return request, err
+	}
+	request.Body = body
+	if request.Endpoint != Webhook {
+		request.Form, err = url.ParseQuery(string(body))
+	}
+	return request, err
+}
+
+func writeJSON(w http.ResponseWriter, response interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(response)
+}
@@ -0,0 +1,134 @@
+/*
+ * Copyright (c) 2021, salesforce.com, inc.
+ * All rights reserved.
+ * SPDX-License-Identifier: BSD-3-Clause
+ * For full license text, see the LICENSE file in the repo root or https://opensource.org/licenses/BSD-3-Clause
+ */
+package slacktest
+
+import (
+	"context"
+	"errors"
+	"github.com/slack-go/slack"
+	"net/http"
+	"reflect"
+	"testing"
+)
+
+func Test_ServerWebAPI(t *testing.T) {
+	server := NewServer()
+	defer server.Close()
+	api := slack.New("token", slack.OptionAPIURL(server.APIURL()))
+	ctx := context.Background()
+	attachment := slack.Attachment{Title: "FAILURE: job", Color: "danger"}
+
+	channel, timestamp, err := api.PostMessageContext(ctx, "C12345", slack.MsgOptionAttachments(attachment))
+	if err != nil {
+		t.Fatalf("PostMessageContext() unexpected error: %v", err)
+	}
+	if channel != "C12345" || timestamp != "1700000001.000000" {
+		t.Errorf("PostMessageContext() = %s, %s, want C12345, 1700000001.000000", channel, timestamp)
+	}
+	_, _, _, err = api.UpdateMessageContext(ctx, channel, timestamp, slack.MsgOptionText("updated", false))
+	if err != nil {
+		t.Fatalf("UpdateMessageContext() unexpected error: %v", err)
+	}
+	file, err := api.UploadFileContext(ctx, slack.UploadFileParameters{
+		Content:         "log line",
+		FileSize:        8,
+		Filename:        "build.log",
+		Title:           "Log",
+		Channel:         channel,
+		ThreadTimestamp: timestamp,
+	})
+	if err != nil {
+		t.Fatalf("UploadFileContext() unexpected error: %v", err)
+	}
+	if file.ID != "F00000001" || file.Title != "Log" {
+		t.Errorf("UploadFileContext() = %+v, want F00000001 titled Log", file)
+	}
+
+	var endpoints []string
+	for _, request := range server.Requests("") {
+		endpoints = append(endpoints, request.Endpoint)
+	}
+	wantEndpoints := []string{PostMessage, UpdateMessage, GetUploadURL, Upload, CompleteUpload}
+	if !reflect.DeepEqual(endpoints, wantEndpoints) {
+		t.Errorf("Requests() endpoints = %v, want %v", endpoints, wantEndpoints)
+	}
+	attachments, err := server.Requests(PostMessage)[0].Attachments()
+	if err != nil {
+		t.Fatalf("Attachments() unexpected error: %v", err)
+	}
+	if len(attachments) != 1 || attachments[0].Title != attachment.Title || attachments[0].Color != attachment.Color {
+		t.Errorf("Attachments() = %+v, want %+v", attachments, attachment)
+	}
+	if got := server.Requests(UpdateMessage)[0].Form.Get("ts"); got != timestamp {
+		t.Errorf("chat.update ts = %q, want %q", got, timestamp)
+	}
+	if got := string(server.Requests(Upload)[0].Body); got != "log line" {
+		t.Errorf("uploaded content = %q, want %q", got, "log line")
+	}
+	if got := server.Requests(CompleteUpload)[0].Form.Get("thread_ts"); got != timestamp {
+		t.Errorf("files.completeUploadExternal thread_ts = %q, want %q", got, timestamp)
+	}
+}
+
+func Test_ServerWebhook(t *testing.T) {
+	server := NewServer()
+	defer server.Close()
+	message := &slack.WebhookMessage{Attachments: []slack.Attachment{{Title: "SUCCESS: job"}}}
+	err := slack.PostWebhookContext(context.Background(), server.WebhookURL(), message)
+	if err != nil {
+		t.Fatalf("PostWebhookContext() unexpected error: %v", err)
+	}
+	requests := server.Requests(Webhook)
+	if len(requests) != 1 {
+		t.Fatalf("Requests() = %v, want a single webhook", requests)
+	}
+	attachments, err := requests[0].Attachments()
+	if err != nil || len(attachments) != 1 || attachments[0].Title != "SUCCESS: job" {
+		t.Errorf("Attachments() = %+v, %v, want the posted attachment", attachments, err)
+	}
+}
+
+func Test_ServerFail(t *testing.T) {
+	server := NewServer()
+	defer server.Close()
+	api := slack.New("token", slack.OptionAPIURL(server.APIURL()))
+	server.Fail(PostMessage, http.StatusTooManyRequests, 1)
+	server.Fail(PostMessage, http.StatusBadGateway, 1)
+	server.Fail(Webhook, http.StatusInternalServerError, 1)
+
+	_, _, err := api.PostMessage("C12345")
+	var rateLimited *slack.RateLimitedError
+	if !errors.As(err, &rateLimited) || rateLimited.RetryAfter.Seconds() != 1 {
+		t.Errorf("PostMessage() error = %v, want a rate limit retrying after 1s", err)
+	}
+	_, _, err = api.PostMessage("C12345")
+	var statusCodeError slack.StatusCodeError
+	if !errors.As(err, &statusCodeError) || statusCodeError.Code != http.StatusBadGateway {
+		t.Errorf("PostMessage() error = %v, want status %d", err, http.StatusBadGateway)
+	}
+	_, _, err = api.PostMessage("C12345")
+	if err != nil {
+		t.Errorf("PostMessage() unexpected error once the failures are used up: %v", err)
+	}
+	err = slack.PostWebhook(server.WebhookURL(), &slack.WebhookMessage{Text: "hi"})
+	if err == nil {
+		t.Errorf("PostWebhook() expected an error")
+	}
+	if got := len(server.Requests(PostMessage)); got != 3 {
+		t.Errorf("Requests() recorded %d chat.postMessage requests, want 3", got)
+	}
+}
+
+func Test_ServerUnknownMethod(t *testing.T) {
+	server := NewServer()
+	defer server.Close()
+	api := slack.New("token", slack.OptionAPIURL(server.APIURL()))
+	_, err := api.GetUserInfo("U12345")
+	if err == nil || err.Error() != "unknown_method" {
+		t.Errorf("GetUserInfo() error = %v, want unknown_method", err)
+	}
+}
@@ -0,0 +1,113 @@
+/*
+ * Copyright (c) 2021, salesforce.com, inc.
+ * All rights reserved.
+ * SPDX-License-Identifier: BSD-3-Clause
+ * For full license text, see the LICENSE file in the repo root or https://opensource.org/licenses/BSD-3-Clause
+ */
+package ciresult
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/slack-go/slack"
+	"os"
+	"strings"
+)
+
+var (
+	stagesFieldTitle = "Stages"
+
+	defaultStageEmoji = ":grey_question:"
+
+	stageEmoji = map[string]string{
+		successKey:      ":white_check_mark:",
+		fixedKey:        ":white_check_mark:",
+		unstableKey:     ":warning:",
+		failureKey:      ":x:",
+		stillFailingKey: ":x:",
+		"SKIPPED":       ":fast_forward:",
+		"NOT_BUILT":     ":fast_forward:",
+		"ABORTED":       ":no_entry_sign:",
+		"IN_PROGRESS":   ":hourglass_flowing_sand:",
+	}
+)
+
+/*
+Stage represents a single stage / step of a multi-stage pipeline
+*/
+type Stage struct {
+	Name     string        `json:"name"`
+	Status   string        `json:"status"`
+	Duration StageDuration `json:"duration,omitempty"`
+}
+
+/*
+StageDuration is a stage's duration in any of the forms BUILD_TIME accepts, given as a JSON string or number of
+milliseconds
+*/
+type StageDuration string
+
+func (duration *StageDuration) UnmarshalJSON(data []byte) error {
+	var number json.Number
+	if json.Unmarshal(data, &number) == nil {
+		*duration = StageDuration(number)
+		return nil
+	}
+	var text string
+	err := json.Unmarshal(data, &text)
+	*duration = StageDuration(text)
+	return err
+}
+
+/*
+LoadStages parses the JSON list of stages from StagesJson or, failing that, from the file at StagesFile
+*/
+func (buildInfo *BuildInfo) LoadStages() error {
+	data := []byte(strings.TrimSpace(buildInfo.StagesJson))
+	source := "STAGES_JSON"
+	if len(data) == 0 && strings.TrimSpace(buildInfo.StagesFile) != "" {
+		var err error
+		data, err = os.ReadFile(buildInfo.StagesFile)
+		if err != nil {
+			return err
+		}
+		source = buildInfo.StagesFile
+	}
+	if len(data) == 0 {
+		return nil
+	}
+	var stages []Stage
+	err := json.Unmarshal(data, &stages)
+	if err != nil {
+		return fmt.Errorf("unable to parse stages from %s: %s", source, err)
+	}
+	buildInfo.Stages = stages
+	return nil
+}
+
+func (stage Stage) text() string {
+	emoji, present := stageEmoji[strings.ToUpper(strings.TrimSpace(stage.Status))]
+	if !present {
+		emoji = defaultStageEmoji
+	}
+	text := emoji + " " + mrkdwnEscaper.Replace(stage.Name)
+	if strings.TrimSpace(string(stage.Duration)) != "" {
+		duration := string(stage.Duration)
+		if parsed, ok := parseDuration(duration); ok {
+			duration = formatDuration(parsed)
+		}
+		text += " — " + mrkdwnEscaper.Replace(duration)
+	}
+	return text
+}
+
+func appendStagesField(attachmentFields *[]slack.AttachmentField, stages []Stage) {
+	if len(stages) == 0 {
+		return
+	}
+	var lines []string
+	for _, stage := range stages {
+		lines = append(lines, stage.text())
+	}
+	*attachmentFields = append(*attachmentFields, getLongAttachmentField(stagesFieldTitle, strings.Join(lines, "\n")))
+}
@@ -0,0 +1,94 @@
+/*
+ * Copyright (c) 2021, salesforce.com, inc.
+ * All rights reserved.
+ * SPDX-License-Identifier: BSD-3-Clause
+ * For full license text, see the LICENSE file in the repo root or https://opensource.org/licenses/BSD-3-Clause
+ */
+package ciresult
+
+import (
+	"github.com/slack-go/slack"
+	"reflect"
+	"testing"
+)
+
+func Test_LoadStages(t *testing.T) {
+	fileStages := []Stage{
+		{Name: "Checkout", Status: "SUCCESS", Duration: "1200"},
+		{Name: "Build", Status: "success", Duration: "1 min 3 sec"},
+		{Name: "Test", Status: "FAILURE", Duration: "2m"},
+		{Name: "Deploy", Status: "SKIPPED"},
+	}
+	tests := []struct {
+		name      string
+		buildInfo BuildInfo
+		want      []Stage
+		wantErr   bool
+	}{
+		{"no stages", BuildInfo{}, nil, false},
+		{
+			"from the environment",
+			BuildInfo{StagesJson: `[{"name":"Build","status":"SUCCESS","duration":"1m3s"}]`, StagesFile: "testdata/stages/stages.json"},
+			[]Stage{{Name: "Build", Status: "SUCCESS", Duration: "1m3s"}},
+			false,
+		},
+		{"from a file", BuildInfo{StagesFile: "testdata/stages/stages.json"}, fileStages, false},
+		{"missing file", BuildInfo{StagesFile: "testdata/stages/missing.json"}, nil, true},
+		{"invalid json", BuildInfo{StagesJson: `{"name":"Build"}`}, nil, true},
+		{"invalid duration", BuildInfo{StagesJson: `[{"name":"Build","duration":true}]`}, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.buildInfo.LoadStages()
+			if (err != nil) != tt.wantErr {
+				t.Errorf("LoadStages() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(tt.buildInfo.Stages, tt.want) {
+				t.Errorf("LoadStages() Stages = %+v, want %+v", tt.buildInfo.Stages, tt.want)
+			}
+		})
+	}
+}
+
+func Test_appendStagesField(t *testing.T) {
+	tests := []struct {
+		name   string
+		stages []Stage
+		want   []slack.AttachmentField
+	}{
+		{"no stages", nil, emptyAttachmentFields},
+		{
+			"all statuses",
+			[]Stage{
+				{Name: "Checkout", Status: "SUCCESS", Duration: "1200"},
+				{Name: "Build & Package", Status: "success", Duration: "1 min 3 sec"},
+				{Name: "Lint", Status: "UNSTABLE"},
+				{Name: "Test", Status: "FAILURE", Duration: "a while"},
+				{Name: "Deploy", Status: "SKIPPED"},
+				{Name: "Notify", Status: "WEIRD"},
+			},
+			[]slack.AttachmentField{getLongAttachmentField(stagesFieldTitle, `:white_check_mark: Checkout — 1.2s
+:white_check_mark: Build &amp; Package — 1m 3s
+:warning: Lint
+:x: Test — a while
+:fast_forward: Deploy
+:grey_question: Notify`)},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []slack.AttachmentField
+			appendStagesField(&got, tt.stages)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("appendStagesField() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_StagesDoNotChangeContextualStatus(t *testing.T) {
+	buildInfo := BuildInfo{BuildStatus: successKey, Stages: []Stage{{Name: "Test", Status: failureKey}}}
+	if got := buildInfo.GetContextualStatus(); got != successStatus {
+		t.Errorf("GetContextualStatus() = %v, want %v", got, successStatus)
+	}
+}
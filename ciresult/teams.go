@@ -0,0 +1,167 @@
+/*
+ * Copyright (c) 2021, salesforce.com, inc.
+ * All rights reserved.
+ * SPDX-License-Identifier: BSD-3-Clause
+ * For full license text, see the LICENSE file in the repo root or https://opensource.org/licenses/BSD-3-Clause
+ */
+package ciresult
+
+import (
+	"regexp"
+	"strings"
+)
+
+const (
+	adaptiveCardContentType = "application/vnd.microsoft.card.adaptive"
+	adaptiveCardSchema      = "http://adaptivecards.io/schemas/adaptive-card.json"
+	adaptiveCardVersion     = "1.4"
+
+	viewBuildActionTitle = "View Build"
+)
+
+var (
+	// adaptiveCardColors maps Slack attachment colors to Adaptive Card text colors
+	adaptiveCardColors = map[string]string{
+		successStatus.color:  "Good",
+		unstableStatus.color: "Warning",
+		failedStatus.color:   "Attention",
+	}
+
+	slackLinkPattern = regexp.MustCompile(`<([^|<>]+)\|([^<>]*)>`)
+
+	// slackEmoji maps the emoji codes used in fields to the Unicode emoji other platforms render
+	slackEmoji = strings.NewReplacer(
+		":white_check_mark:", "✅",
+		":x:", "❌",
+		":warning:", "⚠️",
+		":fast_forward:", "⏩",
+		":no_entry_sign:", "🚫",
+		":hourglass_flowing_sand:", "⏳",
+		":grey_question:", "❔",
+		":turtle:", "🐢",
+	)
+
+	mrkdwnUnescaper = strings.NewReplacer("&amp;", "&", "&lt;", "<", "&gt;", ">")
+)
+
+/*
+TeamsMessage represents a Microsoft Teams incoming webhook payload carrying an Adaptive Card
+*/
+type TeamsMessage struct {
+	Type        string            `json:"type"`
+	Attachments []TeamsAttachment `json:"attachments"`
+}
+
+/*
+TeamsAttachment represents a single card attached to a TeamsMessage
+*/
+type TeamsAttachment struct {
+	ContentType string       `json:"contentType"`
+	Content     AdaptiveCard `json:"content"`
+}
+
+/*
+AdaptiveCard represents the subset of the Adaptive Card schema used to render builds
+*/
+type AdaptiveCard struct {
+	Schema  string            `json:"$schema"`
+	Type    string            `json:"type"`
+	Version string            `json:"version"`
+	Body    []AdaptiveElement `json:"body"`
+	Actions []AdaptiveAction  `json:"actions,omitempty"`
+	MSTeams map[string]string `json:"msteams,omitempty"`
+}
+
+/*
+AdaptiveElement represents a TextBlock or FactSet in an AdaptiveCard body
+*/
+type AdaptiveElement struct {
+	Type      string         `json:"type"`
+	Text      string         `json:"text,omitempty"`
+	Size      string         `json:"size,omitempty"`
+	Weight    string         `json:"weight,omitempty"`
+	Color     string         `json:"color,omitempty"`
+	Wrap      bool           `json:"wrap,omitempty"`
+	Separator bool           `json:"separator,omitempty"`
+	Facts     []AdaptiveFact `json:"facts,omitempty"`
+}
+
+/*
+AdaptiveFact represents a single title / value pair of a FactSet
+*/
+type AdaptiveFact struct {
+	Title string `json:"title"`
+	Value string `json:"value"`
+}
+
+/*
+AdaptiveAction represents a button on an AdaptiveCard
+*/
+type AdaptiveAction struct {
+	Type  string `json:"type"`
+	Title string `json:"title"`
+	URL   string `json:"url"`
+}
+
+/*
+getTeamsMessage renders the same attachment sent to Slack as an Adaptive Card: short fields become a FactSet and
+long fields follow as headed text blocks
+*/
+func getTeamsMessage(buildInfo BuildInfo, buildStatus Status) TeamsMessage {
+	attachment := getAttachment(buildInfo, buildStatus)
+	body := []AdaptiveElement{{
+		Type:   "TextBlock",
+		Text:   attachment.Title,
+		Size:   "Large",
+		Weight: "Bolder",
+		Color:  adaptiveCardColors[getAttachmentColor(buildInfo, buildStatus)],
+		Wrap:   true,
+	}}
+	var facts []AdaptiveFact
+	var sections []AdaptiveElement
+	for _, field := range attachment.Fields {
+		if field.Short {
+			facts = append(facts, AdaptiveFact{Title: field.Title, Value: teamsText(field.Value)})
+			continue
+		}
+		sections = append(sections,
+			AdaptiveElement{Type: "TextBlock", Text: field.Title, Weight: "Bolder", Wrap: true, Separator: true},
+			AdaptiveElement{Type: "TextBlock", Text: teamsText(field.Value), Wrap: true},
+		)
+	}
+	if len(facts) > 0 {
+		body = append(body, AdaptiveElement{Type: "FactSet", Facts: facts})
+	}
+	body = append(body, sections...)
+
+	card := AdaptiveCard{
+		Schema:  adaptiveCardSchema,
+		Type:    "AdaptiveCard",
+		Version: adaptiveCardVersion,
+		Body:    body,
+		MSTeams: map[string]string{"width": "Full"},
+	}
+	if attachment.TitleLink != "" {
+		card.Actions = []AdaptiveAction{{Type: "Action.OpenUrl", Title: viewBuildActionTitle, URL: attachment.TitleLink}}
+	}
+	return TeamsMessage{
+		Type:        "message",
+		Attachments: []TeamsAttachment{{ContentType: adaptiveCardContentType, Content: card}},
+	}
+}
+
+/*
+slackToMarkdown converts Slack mrkdwn links, escapes and emoji codes to the Markdown understood by other platforms
+*/
+func slackToMarkdown(text string) string {
+	return slackEmoji.Replace(slackLinksToMarkdown(text))
+}
+
+func slackLinksToMarkdown(text string) string {
+	return mrkdwnUnescaper.Replace(slackLinkPattern.ReplaceAllString(text, "[$2]($1)"))
+}
+
+func teamsText(text string) string {
+	// Adaptive Card text blocks only break lines on blank lines
+	return strings.ReplaceAll(slackToMarkdown(text), "\n", "\n\n")
+}
@@ -0,0 +1,179 @@
+/*
+ * Copyright (c) 2021, salesforce.com, inc.
+ * All rights reserved.
+ * SPDX-License-Identifier: BSD-3-Clause
+ * For full license text, see the LICENSE file in the repo root or https://opensource.org/licenses/BSD-3-Clause
+ */
+package ciresult
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"slices"
+	"strings"
+)
+
+// directProxy is the proxy URL which disables proxying
+const directProxy = "direct"
+
+// proxyDestinations are the destinations HTTPClient is asked for, which PROXY_OVERRIDES can name
+var proxyDestinations = []string{"slack", "teams", "discord", "mattermost", "webhook"}
+
+/*
+ValidateTransport returns an error if the proxy, CA bundle or client certificate configuration can't be used
+*/
+func (buildInfo *BuildInfo) ValidateTransport() error {
+	_, err := buildInfo.parseProxyOverrides()
+	if err != nil {
+		return err
+	}
+	_, err = buildInfo.TLSConfig()
+	return err
+}
+
+/*
+HTTPClient returns the client used to reach destination (e.g. slack or teams). It uses PROXY_OVERRIDES for the
+destination, PROXY_URL or HTTP_PROXY / HTTPS_PROXY, in that order, and trusts CA_BUNDLE and presents CLIENT_CERT
+when set
+*/
+func (buildInfo *BuildInfo) HTTPClient(destination string) (*http.Client, error) {
+	proxy, err := buildInfo.proxyFor(destination)
+	if err != nil {
+		return nil, err
+	}
+	tlsConfig, err := buildInfo.TLSConfig()
+	if err != nil {
+		return nil, err
+	}
+	if proxy == nil && tlsConfig == nil {
+		return http.DefaultClient, nil
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if proxy != nil {
+		transport.Proxy = proxy
+	}
+	if tlsConfig != nil {
+		transport.TLSClientConfig = tlsConfig
+	}
+	return &http.Client{Transport: transport}, nil
+}
+
+/*
+TLSConfig returns the TLS configuration trusting CA_BUNDLE in addition to the system roots and presenting
+CLIENT_CERT / CLIENT_KEY, or nil when neither is configured
+*/
+func (buildInfo *BuildInfo) TLSConfig() (*tls.Config, error) {
+	if buildInfo.CaBundle == "" && buildInfo.ClientCert == "" && buildInfo.ClientKey == "" {
+		return nil, nil
+	}
+	tlsConfig := &tls.Config{MinVersion: tls.VersionTLS12}
+	if buildInfo.CaBundle != "" {
+		pem, err := os.ReadFile(buildInfo.CaBundle)
+		if err != nil {
+			return nil, fmt.Errorf("unable to read CA_BUNDLE: %s", err)
+		}
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in CA_BUNDLE %s", buildInfo.CaBundle)
+		}
+		tlsConfig.RootCAs = pool
+	}
+	if buildInfo.ClientCert != "" || buildInfo.ClientKey != "" {
+		if buildInfo.ClientCert == "" || buildInfo.ClientKey == "" {
+			return nil, errors.New("please specify both CLIENT_CERT and CLIENT_KEY")
+		}
+		certificate, err := tls.LoadX509KeyPair(buildInfo.ClientCert, buildInfo.ClientKey)
+		if err != nil {
+			return nil, fmt.Errorf("unable to load CLIENT_CERT: %s", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{certificate}
+	}
+	return tlsConfig, nil
+}
+
+/*
+proxyFor returns the proxy function for destination, or nil to fall back to HTTP_PROXY / HTTPS_PROXY
+*/
+func (buildInfo *BuildInfo) proxyFor(destination string) (func(*http.Request) (*url.URL, error), error) {
+	overrides, err := buildInfo.parseProxyOverrides()
+	if err != nil {
+		return nil, err
+	}
+	proxyURL, present := overrides[destination]
+	if !present {
+		if buildInfo.ProxyUrl == "" {
+			return nil, nil
+		}
+		proxyURL, err = parseProxyURL("PROXY_URL", buildInfo.ProxyUrl)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if proxyURL == nil {
+		return func(*http.Request) (*url.URL, error) { return nil, nil }, nil
+	}
+	return http.ProxyURL(proxyURL), nil
+}
+
+/*
+parseProxyOverrides parses the comma separated destination=proxy pairs of ProxyOverrides. A nil URL means the
+destination is reached directly.
+*/
+func (buildInfo *BuildInfo) parseProxyOverrides() (map[string]*url.URL, error) {
+	overrides := map[string]*url.URL{}
+	if buildInfo.ProxyUrl != "" {
+		_, err := parseProxyURL("PROXY_URL", buildInfo.ProxyUrl)
+		if err != nil {
+			return nil, err
+		}
+	}
+	// Entries are referred to by position rather than quoted in errors, since they may hold proxy credentials
+	for i, override := range strings.Split(buildInfo.ProxyOverrides, ",") {
+		override = strings.TrimSpace(override)
+		if override == "" {
+			continue
+		}
+		destination, proxy, found := strings.Cut(override, "=")
+		destination = strings.TrimSpace(destination)
+		if !found || destination == "" {
+			return nil, fmt.Errorf("invalid PROXY_OVERRIDES entry %d, expected destination=proxy", i+1)
+		}
+		destination = strings.ToLower(destination)
+		if !slices.Contains(proxyDestinations, destination) {
+			if strings.ContainsAny(destination, ":/@") {
+				return nil, fmt.Errorf("unknown PROXY_OVERRIDES destination in entry %d, expected one of %s", i+1, strings.Join(proxyDestinations, ", "))
+			}
+			return nil, fmt.Errorf("unknown PROXY_OVERRIDES destination %q, expected one of %s", destination, strings.Join(proxyDestinations, ", "))
+		}
+		proxyURL, err := parseProxyURL("PROXY_OVERRIDES", strings.TrimSpace(proxy))
+		if err != nil {
+			return nil, err
+		}
+		overrides[destination] = proxyURL
+	}
+	return overrides, nil
+}
+
+// parseProxyURL parses a proxy URL, leaving its credentials out of any error as they'd end up in CI logs
+func parseProxyURL(variable string, proxy string) (*url.URL, error) {
+	if strings.EqualFold(proxy, directProxy) {
+		return nil, nil
+	}
+	proxyURL, err := url.Parse(proxy)
+	// Without a // the credentials of e.g. user:password@proxy:3128 end up in the opaque part, which isn't redacted
+	if err != nil || proxyURL.Opaque != "" {
+		return nil, fmt.Errorf("invalid %s proxy, expected a URL such as http://proxy:3128 or %s", variable, directProxy)
+	}
+	if proxyURL.Scheme == "" || proxyURL.Host == "" {
+		return nil, fmt.Errorf("invalid %s proxy %q, expected a URL such as http://proxy:3128 or %s", variable, proxyURL.Redacted(), directProxy)
+	}
+	return proxyURL, nil
+}
@@ -0,0 +1,193 @@
+/*
+ * Copyright (c) 2021, salesforce.com, inc.
+ * All rights reserved.
+ * SPDX-License-Identifier: BSD-3-Clause
+ * For full license text, see the LICENSE file in the repo root or https://opensource.org/licenses/BSD-3-Clause
+ */
+package ciresult
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"text/template"
+)
+
+/*
+WebhookPayload is the build result sent to WebhookUrl, either as JSON or as the data of WebhookTemplate
+*/
+type WebhookPayload struct {
+	JobName         string         `json:"jobName"`
+	BuildURL        string         `json:"buildUrl"`
+	BuildStatus     string         `json:"buildStatus"`
+	Status          string         `json:"status"`
+	Title           string         `json:"title"`
+	Color           string         `json:"color"`
+	BranchName      string         `json:"branchName,omitempty"`
+	GitCommit       string         `json:"gitCommit,omitempty"`
+	TriggeredBy     string         `json:"triggeredBy,omitempty"`
+	DurationSeconds float64        `json:"durationSeconds,omitempty"`
+	Fields          []WebhookField `json:"fields,omitempty"`
+}
+
+/*
+WebhookField is a plain text rendering of one of the message's fields
+*/
+type WebhookField struct {
+	Title string `json:"title"`
+	Value string `json:"value"`
+	Short bool   `json:"short"`
+}
+
+// maxWebhookErrorBody is how much of an error response body is included in the returned error
+const maxWebhookErrorBody = 512
+
+var webhookTemplateFuncs = template.FuncMap{
+	"json": func(value interface{}) (string, error) {
+		data, err := json.Marshal(value)
+		return string(data), err
+	},
+}
+
+func getWebhookPayload(buildInfo BuildInfo, buildStatus Status) WebhookPayload {
+	attachment := getAttachment(buildInfo, buildStatus)
+	// The raw fields are redacted before they're encoded or templated, which could hide secrets from Redact
+	payload := WebhookPayload{
+		JobName:         buildInfo.Redact(buildInfo.JobName),
+		BuildURL:        attachment.TitleLink,
+		BuildStatus:     buildInfo.Redact(buildInfo.BuildStatus),
+		Status:          buildStatus.text,
+		Title:           attachment.Title,
+		Color:           attachmentColorHex(attachment.Color),
+		BranchName:      buildInfo.Redact(buildInfo.BranchName),
+		GitCommit:       buildInfo.Redact(buildInfo.GitCommit),
+		TriggeredBy:     buildInfo.Redact(buildInfo.TriggeredBy),
+		DurationSeconds: buildInfo.Duration.Seconds(),
+	}
+	for _, field := range attachment.Fields {
+		payload.Fields = append(payload.Fields, WebhookField{Title: field.Title, Value: slackToText(field.Value), Short: field.Short})
+	}
+	return payload
+}
+
+/*
+getWebhookBody renders the payload with WebhookTemplate (or the template in WebhookTemplateFile), defaulting to the
+payload as JSON. The body is redacted like every other message.
+*/
+func getWebhookBody(buildInfo BuildInfo, buildStatus Status) ([]byte, error) {
+	payload := getWebhookPayload(buildInfo, buildStatus)
+	text := buildInfo.WebhookTemplate
+	if strings.TrimSpace(text) == "" && buildInfo.WebhookTemplateFile != "" {
+		data, err := os.ReadFile(buildInfo.WebhookTemplateFile)
+		if err != nil {
+			return nil, err
+		}
+		text = string(data)
+	}
+	if strings.TrimSpace(text) == "" {
+		body, err := json.Marshal(payload)
+		if err != nil {
+			return nil, err
+		}
+		return []byte(buildInfo.Redact(string(body))), nil
+	}
+	tmpl, err := template.New("webhook").Funcs(webhookTemplateFuncs).Option("missingkey=error").Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("invalid webhook template: %s", err)
+	}
+	var body bytes.Buffer
+	err = tmpl.Execute(&body, payload)
+	if err != nil {
+		return nil, fmt.Errorf("unable to render webhook template: %s", err)
+	}
+	return []byte(buildInfo.Redact(body.String())), nil
+}
+
+/*
+parseWebhookHeaders parses newline separated "Name: value" headers
+*/
+func parseWebhookHeaders(headers string) (http.Header, error) {
+	parsed := http.Header{}
+	for _, line := range strings.Split(headers, "\n") {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		name, value, found := strings.Cut(line, ":")
+		if !found || strings.TrimSpace(name) == "" {
+			return nil, fmt.Errorf("invalid WEBHOOK_HEADERS entry %q, expected 'Name: value'", strings.TrimSpace(line))
+		}
+		parsed.Add(strings.TrimSpace(name), strings.TrimSpace(value))
+	}
+	return parsed, nil
+}
+
+func getWebhookRequest(ctx context.Context, buildInfo BuildInfo, buildStatus Status) (*http.Request, error) {
+	headers, err := parseWebhookHeaders(buildInfo.WebhookHeaders)
+	if err != nil {
+		return nil, err
+	}
+	body, err := getWebhookBody(buildInfo, buildStatus)
+	if err != nil {
+		return nil, err
+	}
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, buildInfo.WebhookUrl, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	request.Header = headers
+	if request.Header.Get("Content-Type") == "" {
+		request.Header.Set("Content-Type", "application/json")
+	}
+	return request, nil
+}
+
+/*
+slackToText converts Slack mrkdwn to plain text, keeping link targets after their text
+*/
+func slackToText(text string) string {
+	text = slackLinkPattern.ReplaceAllStringFunc(text, func(link string) string {
+		match := slackLinkPattern.FindStringSubmatch(link)
+		if match[1] == match[2] {
+			return match[1]
+		}
+		return match[2] + " (" + match[1] + ")"
+	})
+	return slackEmoji.Replace(mrkdwnUnescaper.Replace(text))
+}
+
+/*
+postJSONWebhook posts payload as JSON to url, treating any non-2xx response as an error
+*/
+func postJSONWebhook(ctx context.Context, httpClient *http.Client, url string, payload interface{}) error {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Content-Type", "application/json")
+	return sendWebhookRequest(httpClient, request)
+}
+
+/*
+sendWebhookRequest sends request, treating any non-2xx response as an error
+*/
+func sendWebhookRequest(httpClient *http.Client, request *http.Request) error {
+	response, err := httpClient.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	if response.StatusCode < 200 || response.StatusCode > 299 {
+		body, _ := io.ReadAll(io.LimitReader(response.Body, maxWebhookErrorBody))
+		return fmt.Errorf("webhook returned %s: %s", response.Status, strings.TrimSpace(string(body)))
+	}
+	return nil
+}
@@ -0,0 +1,185 @@
+/*
+ * Copyright (c) 2021, salesforce.com, inc.
+ * All rights reserved.
+ * SPDX-License-Identifier: BSD-3-Clause
+ * For full license text, see the LICENSE file in the repo root or https://opensource.org/licenses/BSD-3-Clause
+ */
+package ciresult
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func Test_getWebhookPayload(t *testing.T) {
+	buildInfo := BuildInfo{
+		JobName:         jobName,
+		BuildURL:        buildURL,
+		BuildStatus:     successKey,
+		LastBuildStatus: failureKey,
+		BranchName:      branchName,
+		GitCommit:       commit,
+		Duration:        63 * time.Second,
+		PrNumber:        "7",
+		PrTitle:         "Fix <things> & stuff",
+		PrUrl:           "https://example.com/pr/7",
+	}
+	want := WebhookPayload{
+		JobName:         jobName,
+		BuildURL:        buildURL,
+		BuildStatus:     successKey,
+		Status:          fixedStatus.text,
+		Title:           "Fixed: " + jobName,
+		Color:           "#2EB886",
+		BranchName:      branchName,
+		GitCommit:       commit,
+		DurationSeconds: 63,
+		Fields: []WebhookField{
+			{Title: branchFieldTitle, Value: branchName, Short: true},
+			{Title: commitFieldTitle, Value: commit, Short: true},
+			{Title: buildTimeFieldTitle, Value: "1m 3s", Short: true},
+			{Title: pullRequestFieldTitle, Value: "#7: Fix <things> & stuff (https://example.com/pr/7)"},
+		},
+	}
+	if got := getWebhookPayload(buildInfo, buildInfo.GetContextualStatus()); !reflect.DeepEqual(got, want) {
+		t.Errorf("getWebhookPayload() = %+v, want %+v", got, want)
+	}
+}
+
+func Test_getWebhookBody(t *testing.T) {
+	buildInfo := BuildInfo{JobName: "job", BuildURL: "https://ci/1", BuildStatus: failureKey, TriggeredBy: "xoxb-1234-abcd"}
+	tests := []struct {
+		name      string
+		buildInfo BuildInfo
+		want      string
+		wantErr   bool
+	}{
+		{
+			"default json",
+			buildInfo,
+			`{"jobName":"job","buildUrl":"https://ci/1","buildStatus":"FAILURE","status":"Failed","title":"Failed: job","color":"#A30200","triggeredBy":"[REDACTED]","fields":[{"title":"Triggered By","value":"[REDACTED]","short":true}]}`,
+			false,
+		},
+		{
+			"template",
+			withWebhookTemplate(buildInfo, `{"text": {{json .Title}}, "by": {{json .TriggeredBy}}}`, ""),
+			`{"text": "Failed: job", "by": "[REDACTED]"}`,
+			false,
+		},
+		{"template file", withWebhookTemplate(buildInfo, "", "testdata/webhook/template.txt"), "job Failed https://ci/1\n", false},
+		{"missing template file", withWebhookTemplate(buildInfo, "", "testdata/webhook/missing.txt"), "", true},
+		{"invalid template", withWebhookTemplate(buildInfo, "{{.Title", ""), "", true},
+		{"unknown field", withWebhookTemplate(buildInfo, "{{.Nope}}", ""), "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := getWebhookBody(tt.buildInfo, tt.buildInfo.GetContextualStatus())
+			if (err != nil) != tt.wantErr {
+				t.Errorf("getWebhookBody() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if string(got) != tt.want {
+				t.Errorf("getWebhookBody() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func withWebhookTemplate(buildInfo BuildInfo, template string, templateFile string) BuildInfo {
+	buildInfo.WebhookTemplate = template
+	buildInfo.WebhookTemplateFile = templateFile
+	return buildInfo
+}
+
+func Test_parseWebhookHeaders(t *testing.T) {
+	tests := []struct {
+		name    string
+		headers string
+		want    http.Header
+		wantErr bool
+	}{
+		{"none", "", http.Header{}, false},
+		{
+			"several",
+			"Authorization: Bearer abc:def\n\nX-Source:ci\nx-source: other ",
+			http.Header{"Authorization": {"Bearer abc:def"}, "X-Source": {"ci", "other"}},
+			false,
+		},
+		{"missing colon", "Authorization Bearer", nil, true},
+		{"missing name", ": value", nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseWebhookHeaders(tt.headers)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("parseWebhookHeaders() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseWebhookHeaders() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_slackToText(t *testing.T) {
+	tests := []struct {
+		text string
+		want string
+	}{
+		{"plain", "plain"},
+		{"<https://example.com/pr/1|#1 Fix &lt;things&gt;>", "#1 Fix <things> (https://example.com/pr/1)"},
+		{"<https://example.com|https://example.com>", "https://example.com"},
+		{":x: failed", "❌ failed"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.text, func(t *testing.T) {
+			if got := slackToText(tt.text); got != tt.want {
+				t.Errorf("slackToText() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_productionSlackClientWorker_postGenericWebhook(t *testing.T) {
+	var received WebhookPayload
+	var headers http.Header
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		headers = r.Header
+		body, _ := io.ReadAll(r.Body)
+		_ = json.Unmarshal(body, &received)
+		if r.URL.Path == "/fail" {
+			http.Error(w, "nope", http.StatusInternalServerError)
+		}
+	}))
+	defer server.Close()
+	worker := &productionSlackClientWorker{
+		requestSender: func(httpClient *http.Client, request *http.Request) error {
+			return sendWebhookRequest(server.Client(), request)
+		},
+	}
+	buildInfo := BuildInfo{JobName: "job", BuildStatus: successKey, WebhookUrl: server.URL + "/ok", WebhookHeaders: "X-Token: abc"}
+
+	err := worker.postGenericWebhook(context.Background(), buildInfo)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if received.Title != "Success: job" || headers.Get("X-Token") != "abc" || headers.Get("Content-Type") != "application/json" {
+		t.Errorf("unexpected request %v %+v", headers, received)
+	}
+
+	buildInfo.WebhookUrl = server.URL + "/fail"
+	err = worker.postGenericWebhook(context.Background(), buildInfo)
+	if err == nil || err.Error() != "webhook returned 500 Internal Server Error: nope" {
+		t.Errorf("postGenericWebhook() err = %v", err)
+	}
+
+	buildInfo.WebhookHeaders = "broken"
+	if err = worker.postGenericWebhook(context.Background(), buildInfo); err == nil {
+		t.Errorf("postGenericWebhook() expected an error for invalid headers")
+	}
+}
@@ -7,35 +7,169 @@
 package main
 
 import (
+	"context"
 	"fmt"
-	"github.com/salesforce/ci-result-to-slack/internal"
+	"github.com/salesforce/ci-result-to-slack/ciresult"
 	"log"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+	// Embeds the timezone database so QUIET_HOURS_TIMEZONE works on images without one
+	_ "time/tzdata"
 )
 
 const skippedPostingMessage = "Skipped posting to Slack"
 const messageSentTemplate = "Message successfully sent to channel for %s"
+const matrixCellRecordedTemplate = "Recorded matrix result for %s"
+const digestsPostedTemplate = "Posted %d digest(s)"
+const configValidMessage = "Configuration is valid"
 
-func handleRequest(slackClient internal.SlackClient) (string, error) {
-	buildInfo, err := internal.GetBuildInfoFromEnv()
+const collectCommand = "collect"
+const digestCommand = "digest"
+const validateCommand = "validate"
+
+func handleRequest(ctx context.Context, slackClient ciresult.SlackClient) (string, error) {
+	buildInfo, err := ciresult.GetBuildInfoFromEnv()
 	if err != nil {
 		return "", err
 	}
-	if buildInfo.ShouldSkipPosting() {
-		return skippedPostingMessage, nil
+	if buildInfo.IsMatrixCell() {
+		err = buildInfo.RecordMatrixCell()
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprintf(matrixCellRecordedTemplate, buildInfo.MatrixCell), nil
+	}
+	return notify(ctx, slackClient, buildInfo)
+}
+
+/*
+handleCollect posts a single summary of every matrix cell recorded for the run
+*/
+func handleCollect(ctx context.Context, slackClient ciresult.SlackClient) (string, error) {
+	// The overall status is derived from the recorded cells so BUILD_STATUS is optional here
+	setDefaultEnv("BUILD_STATUS", "UNKNOWN")
+	buildInfo, err := ciresult.GetBuildInfoFromEnv()
+	if err != nil {
+		return "", err
+	}
+	buildInfo.MatrixCell = ""
+	err = buildInfo.CollectMatrix()
+	if err != nil {
+		return "", err
+	}
+	return notify(ctx, slackClient, buildInfo)
+}
+
+/*
+handleDigest posts a summary of the builds recorded in the history file to each channel they were posted to
+*/
+func handleDigest(ctx context.Context, slackClient ciresult.SlackClient) (string, error) {
+	// A digest isn't about a single build so the build's variables are optional here
+	setDefaultEnv("JOB_NAME", digestCommand)
+	setDefaultEnv("BUILD_URL", "")
+	setDefaultEnv("BUILD_STATUS", "UNKNOWN")
+	buildInfo, err := ciresult.GetBuildInfoFromEnv()
+	if err != nil {
+		return "", err
+	}
+	if buildInfo.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, buildInfo.Timeout)
+		defer cancel()
+	}
+	digests, err := slackClient.PostDigests(ctx, buildInfo, time.Now())
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf(digestsPostedTemplate, len(digests)), nil
+}
+
+/*
+handleValidate checks the configuration without posting anything and reports the rules choosing which builds are
+posted
+*/
+func handleValidate(_ context.Context, _ ciresult.SlackClient) (string, error) {
+	// Validation happens before a build has a result, e.g. when a pipeline is set up
+	setDefaultEnv("JOB_NAME", validateCommand)
+	setDefaultEnv("BUILD_URL", "")
+	setDefaultEnv("BUILD_STATUS", "UNKNOWN")
+	buildInfo, err := ciresult.GetBuildInfoFromEnv()
+	if err != nil {
+		return "", err
+	}
+	rules, err := buildInfo.FilterRules()
+	if err != nil {
+		return "", err
+	}
+	lines := []string{configValidMessage}
+	if len(rules) > 0 {
+		lines = append(lines, "Builds are posted according to:")
+	}
+	for _, rule := range rules {
+		lines = append(lines, "  "+rule.String())
+	}
+	return strings.Join(lines, "\n"), nil
+}
+
+// setDefaultEnv sets key to value when it's empty, so required variables which don't apply pass validation
+func setDefaultEnv(key string, value string) {
+	if os.Getenv(key) == "" {
+		_ = os.Setenv(key, value)
+	}
+}
+
+/*
+notify delivers the result, giving up once TIMEOUT elapses or ctx is cancelled
+*/
+func notify(ctx context.Context, slackClient ciresult.SlackClient, buildInfo ciresult.BuildInfo) (string, error) {
+	if buildInfo.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, buildInfo.Timeout)
+		defer cancel()
 	}
-	err = slackClient.PostToSlack(buildInfo)
+	posted, err := slackClient.Deliver(ctx, buildInfo)
 	if err != nil {
 		return "", err
 	}
+	if !posted {
+		return skippedPostingMessage, nil
+	}
 	return fmt.Sprintf(messageSentTemplate, buildInfo.JobName), nil
 }
 
+// commandHandler returns the handler for the command in args, posting the build when there isn't one
+func commandHandler(args []string) (func(context.Context, ciresult.SlackClient) (string, error), error) {
+	if len(args) == 0 {
+		return handleRequest, nil
+	}
+	switch args[0] {
+	case collectCommand:
+		return handleCollect, nil
+	case digestCommand:
+		return handleDigest, nil
+	case validateCommand:
+		return handleValidate, nil
+	}
+	return nil, fmt.Errorf("unknown command %q, expected %s, %s or %s", args[0], collectCommand, digestCommand, validateCommand)
+}
+
 /**
-If HTTP_PROXY / HTTPS_PROXY is present then the framework will use the proxy
+If HTTP_PROXY / HTTPS_PROXY is present then the framework will use the proxy unless PROXY_URL / PROXY_OVERRIDES
+choose another.
+SIGINT / SIGTERM cancel any delivery in progress
 */
 func main() {
-	client := internal.NewSlackClient()
-	message, err := handleRequest(client)
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	client := ciresult.NewSlackClient()
+	handler, err := commandHandler(os.Args[1:])
+	if err != nil {
+		log.Fatalln(err)
+	}
+	message, err := handler(ctx, client)
 	if err != nil {
 		log.Fatalln(err)
 	}
@@ -7,64 +7,85 @@
 package main
 
 import (
+	"context"
 	"fmt"
-	"github.com/salesforce/ci-result-to-slack/internal"
+	"github.com/salesforce/ci-result-to-slack/ciresult"
+	"github.com/salesforce/ci-result-to-slack/ciresult/slacktest"
+	"github.com/slack-go/slack"
+	"net/http"
+	"os"
+	"path/filepath"
+	"reflect"
 	"strconv"
+	"strings"
 	"testing"
 )
 
+// newTestServer starts a fake Slack server which the app posts to via SLACK_API_URL
+func newTestServer(t *testing.T) *slacktest.Server {
+	t.Helper()
+	server := slacktest.NewServer()
+	t.Cleanup(server.Close)
+	t.Setenv("SLACK_API_URL", server.APIURL())
+	return server
+}
+
 func Test_handleRequest(t *testing.T) {
 	tests := []struct {
 		name             string
-		buildInfo        internal.BuildInfo
-		slackClient      internal.SlackClient
+		buildInfo        ciresult.BuildInfo
+		failEndpoint     string
 		wantReturnString string
 		wantErr          bool
 		wantErrString    string
 	}{
 		{
 			"success",
-			internal.BuildInfo{JobName: "job", BuildURL: "https://sometest", BuildStatus: "SUCCESS", HookURL: "https://slack.com/hook"},
-			internal.NewTestClient(false, false),
+			ciresult.BuildInfo{JobName: "job", BuildURL: "https://sometest", BuildStatus: "SUCCESS", HookURL: "webhook"},
+			"",
 			fmt.Sprintf(messageSentTemplate, "job"),
 			false,
 			"",
 		},
 		{
 			"skip posting if success and skipIfSuccess",
-			internal.BuildInfo{JobName: "job", BuildURL: "https://sometest", BuildStatus: "SUCCESS", HookURL: "https://slack.com/hook", SkipIfSuccess: true},
-			internal.NewTestClient(false, false),
+			ciresult.BuildInfo{JobName: "job", BuildURL: "https://sometest", BuildStatus: "SUCCESS", HookURL: "webhook", SkipIfSuccess: true},
+			"",
 			skippedPostingMessage,
 			false,
 			"",
 		},
 		{
 			"error processing env vars should throw error",
-			internal.BuildInfo{},
-			internal.NewTestClient(false, false),
+			ciresult.BuildInfo{},
+			"",
 			"",
 			true,
 			"environment variable error: required key JOB_NAME missing value",
 		},
 		{
 			"error posting to slack should throw error for webhook",
-			internal.BuildInfo{JobName: "job", BuildURL: "https://sometest", BuildStatus: "SUCCESS", HookURL: "https://slack.com/hook"},
-			internal.NewTestClient(false, true),
+			ciresult.BuildInfo{JobName: "job", BuildURL: "https://sometest", BuildStatus: "SUCCESS", HookURL: "webhook"},
+			slacktest.Webhook,
 			"",
 			true,
-			internal.WebhookMessageTestErr,
+			"500",
 		},
 		{
-			"error posting to slack should throw error for webhook",
-			internal.BuildInfo{JobName: "job", BuildURL: "https://sometest", BuildStatus: "SUCCESS", DestChannelId: "8675309", OauthToken: "token"},
-			internal.NewTestClient(true, false),
+			"error posting to slack should throw error for channel",
+			ciresult.BuildInfo{JobName: "job", BuildURL: "https://sometest", BuildStatus: "SUCCESS", DestChannelId: "8675309", OauthToken: "token"},
+			slacktest.PostMessage,
 			"",
 			true,
-			internal.ChannelMessageTestErr,
+			"500",
 		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
+			server := newTestServer(t)
+			if tt.failEndpoint != "" {
+				server.Fail(tt.failEndpoint, http.StatusInternalServerError, 1)
+			}
 			if tt.buildInfo.JobName != "" {
 				t.Setenv("JOB_NAME", tt.buildInfo.JobName)
 			}
@@ -75,7 +96,7 @@ func Test_handleRequest(t *testing.T) {
 				t.Setenv("BUILD_STATUS", tt.buildInfo.BuildStatus)
 			}
 			if tt.buildInfo.HookURL != "" {
-				t.Setenv("HOOK_URL", tt.buildInfo.HookURL)
+				t.Setenv("HOOK_URL", server.WebhookURL())
 			}
 			if tt.buildInfo.OauthToken != "" {
 				t.Setenv("OAUTH_TOKEN", tt.buildInfo.OauthToken)
@@ -85,7 +106,7 @@ func Test_handleRequest(t *testing.T) {
 			}
 			t.Setenv("SKIP_IF_SUCCESS", strconv.FormatBool(tt.buildInfo.SkipIfSuccess))
 			t.Setenv("SUPPRESS_USAGE", "T")
-			got, err := handleRequest(tt.slackClient)
+			got, err := handleRequest(context.Background(), ciresult.NewSlackClient())
 			if (err != nil) != tt.wantErr {
 				t.Errorf("handleRequest() error = %v, wantErr %v", err, tt.wantErr)
 				return
@@ -93,9 +114,373 @@ func Test_handleRequest(t *testing.T) {
 			if got != tt.wantReturnString {
 				t.Errorf("handleRequest() got = %v, wantReturnString %v", got, tt.wantReturnString)
 			}
-			if err != nil && err.Error() != tt.wantErrString {
+			if err != nil && !strings.Contains(err.Error(), tt.wantErrString) {
 				t.Errorf("handleRequest() err = %s, wantErrString %v", err.Error(), tt.wantErrString)
 			}
 		})
 	}
 }
+
+func Test_handleRequestRecordsHistory(t *testing.T) {
+	historyFile := filepath.Join(t.TempDir(), "history.json")
+	t.Setenv("JOB_NAME", "job")
+	t.Setenv("BUILD_URL", "https://sometest")
+	t.Setenv("BUILD_STATUS", "SUCCESS")
+	t.Setenv("HOOK_URL", newTestServer(t).WebhookURL())
+	t.Setenv("HISTORY_FILE", historyFile)
+	t.Setenv("SUPPRESS_USAGE", "T")
+
+	for _, skipIfSuccess := range []string{"false", "true"} {
+		t.Setenv("SKIP_IF_SUCCESS", skipIfSuccess)
+		_, err := handleRequest(context.Background(), ciresult.NewSlackClient())
+		if err != nil {
+			t.Fatalf("handleRequest() unexpected error: %v", err)
+		}
+	}
+
+	history, err := ciresult.LoadHistory(historyFile)
+	if err != nil {
+		t.Fatalf("LoadHistory() unexpected error: %v", err)
+	}
+	if len(history.Records) != 2 {
+		t.Errorf("expected posted and skipped builds to be recorded, got %v", history.Records)
+	}
+}
+
+func Test_handleMatrix(t *testing.T) {
+	t.Setenv("MATRIX_STORE", t.TempDir())
+	t.Setenv("MATRIX_RUN_ID", "42")
+	t.Setenv("JOB_NAME", "job")
+	t.Setenv("BUILD_URL", "https://sometest")
+	t.Setenv("HOOK_URL", newTestServer(t).WebhookURL())
+	t.Setenv("SUPPRESS_USAGE", "T")
+
+	for cell, status := range map[string]string{"linux": "SUCCESS", "windows": "FAILURE"} {
+		t.Setenv("MATRIX_CELL", cell)
+		t.Setenv("BUILD_STATUS", status)
+		got, err := handleRequest(context.Background(), ciresult.NewSlackClient())
+		if err != nil {
+			t.Fatalf("handleRequest() unexpected error: %v", err)
+		}
+		if want := fmt.Sprintf(matrixCellRecordedTemplate, cell); got != want {
+			t.Errorf("handleRequest() got = %v, want %v", got, want)
+		}
+	}
+
+	t.Setenv("MATRIX_CELL", "")
+	t.Setenv("BUILD_STATUS", "")
+	got, err := handleCollect(context.Background(), ciresult.NewSlackClient())
+	if err != nil {
+		t.Fatalf("handleCollect() unexpected error: %v", err)
+	}
+	if want := fmt.Sprintf(messageSentTemplate, "job"); got != want {
+		t.Errorf("handleCollect() got = %v, want %v", got, want)
+	}
+
+	t.Setenv("MATRIX_RUN_ID", "43")
+	_, err = handleCollect(context.Background(), ciresult.NewSlackClient())
+	if err == nil {
+		t.Errorf("handleCollect() expected an error when no cells were recorded")
+	}
+}
+
+// setEndToEndEnv configures a build against the fake Slack server, clearing CI variables which would add fields
+func setEndToEndEnv(t *testing.T, env map[string]string) {
+	t.Helper()
+	for _, key := range []string{"CHANGE_ID", "GITHUB_EVENT_NAME", "GITHUB_REF", "CI_MERGE_REQUEST_IID", "BITBUCKET_PR_ID",
+		"CIRCLE_PULL_REQUEST", "CIRCLE_PR_NUMBER", "GITHUB_SERVER_URL", "GITHUB_REPOSITORY"} {
+		t.Setenv(key, "")
+	}
+	t.Setenv("SUPPRESS_USAGE", "T")
+	t.Setenv("JOB_NAME", "deploy")
+	t.Setenv("BUILD_URL", "https://ci.example.com/deploy/42")
+	t.Setenv("REPO_URL", "https://github.com/example/app")
+	t.Setenv("BRANCH_NAME", "main")
+	t.Setenv("GIT_COMMIT", "0123456789abcdef0123456789abcdef01234567")
+	t.Setenv("MAX_COMMITS", "0")
+	for key, value := range env {
+		t.Setenv(key, value)
+	}
+}
+
+func Test_endToEndChannelMessage(t *testing.T) {
+	server := slacktest.NewServer()
+	defer server.Close()
+	logFile := filepath.Join(t.TempDir(), "build.log")
+	if err := os.WriteFile(logFile, []byte("compiling\nERROR: tests failed\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	setEndToEndEnv(t, map[string]string{
+		"BUILD_STATUS":      "FAILURE",
+		"LAST_BUILD_STATUS": "FAILURE",
+		"OAUTH_TOKEN":       "xoxb-token",
+		"DEST_CHANNEL_ID":   "C12345",
+		"SLACK_API_URL":     server.APIURL(),
+		"LOG_FILE":          logFile,
+	})
+
+	got, err := handleRequest(context.Background(), ciresult.NewSlackClient())
+	if err != nil {
+		t.Fatalf("handleRequest() unexpected error: %v", err)
+	}
+	if want := fmt.Sprintf(messageSentTemplate, "deploy"); got != want {
+		t.Errorf("handleRequest() got = %v, want %v", got, want)
+	}
+
+	messages := server.Requests(slacktest.PostMessage)
+	if len(messages) != 1 {
+		t.Fatalf("expected a single message, got %v", messages)
+	}
+	if channel := messages[0].Form.Get("channel"); channel != "C12345" {
+		t.Errorf("chat.postMessage channel = %q, want C12345", channel)
+	}
+	attachments, err := messages[0].Attachments()
+	if err != nil {
+		t.Fatalf("Attachments() unexpected error: %v", err)
+	}
+	wantAttachments := []slack.Attachment{{
+		Title:     "Still Failing: deploy",
+		TitleLink: "https://ci.example.com/deploy/42",
+		Color:     "danger",
+		Fields: []slack.AttachmentField{
+			{Title: "Branch", Value: "<https://github.com/example/app/tree/main|main>", Short: true},
+			{Title: "Commit", Value: "<https://github.com/example/app/commit/0123456789abcdef0123456789abcdef01234567|0123456>", Short: true},
+		},
+	}}
+	if !reflect.DeepEqual(attachments, wantAttachments) {
+		t.Errorf("chat.postMessage attachments = %+v, want %+v", attachments, wantAttachments)
+	}
+
+	uploads := server.Requests(slacktest.Upload)
+	if len(uploads) != 1 || string(uploads[0].Body) != "compiling\nERROR: tests failed" {
+		t.Fatalf("expected the log to be uploaded, got %v", uploads)
+	}
+	completed := server.Requests(slacktest.CompleteUpload)
+	if len(completed) != 1 {
+		t.Fatalf("expected the upload to be completed, got %v", completed)
+	}
+	if threadTimestamp := completed[0].Form.Get("thread_ts"); threadTimestamp != "1700000001.000000" {
+		t.Errorf("log uploaded in thread %q, want the message's thread 1700000001.000000", threadTimestamp)
+	}
+}
+
+func Test_endToEndWebhook(t *testing.T) {
+	server := slacktest.NewServer()
+	defer server.Close()
+	setEndToEndEnv(t, map[string]string{
+		"BUILD_STATUS":      "SUCCESS",
+		"LAST_BUILD_STATUS": "FAILURE",
+		"HOOK_URL":          server.WebhookURL(),
+		"TRIGGERED_BY":      "Push by octocat",
+	})
+
+	_, err := handleRequest(context.Background(), ciresult.NewSlackClient())
+	if err != nil {
+		t.Fatalf("handleRequest() unexpected error: %v", err)
+	}
+	webhooks := server.Requests(slacktest.Webhook)
+	if len(webhooks) != 1 {
+		t.Fatalf("expected a single webhook, got %v", webhooks)
+	}
+	attachments, err := webhooks[0].Attachments()
+	if err != nil {
+		t.Fatalf("Attachments() unexpected error: %v", err)
+	}
+	wantAttachments := []slack.Attachment{{
+		Title:     "Fixed: deploy",
+		TitleLink: "https://ci.example.com/deploy/42",
+		Color:     "good",
+		Fields: []slack.AttachmentField{
+			{Title: "Branch", Value: "<https://github.com/example/app/tree/main|main>", Short: true},
+			{Title: "Commit", Value: "<https://github.com/example/app/commit/0123456789abcdef0123456789abcdef01234567|0123456>", Short: true},
+			{Title: "Triggered By", Value: "Push by octocat", Short: true},
+		},
+	}}
+	if !reflect.DeepEqual(attachments, wantAttachments) {
+		t.Errorf("webhook attachments = %+v, want %+v", attachments, wantAttachments)
+	}
+}
+
+func Test_endToEndFailures(t *testing.T) {
+	tests := []struct {
+		name       string
+		env        map[string]string
+		endpoint   string
+		statusCode int
+		wantErr    string
+	}{
+		{"rate limited", map[string]string{"OAUTH_TOKEN": "xoxb-token", "DEST_CHANNEL_ID": "C12345"}, slacktest.PostMessage, http.StatusTooManyRequests, "slack rate limit exceeded"},
+		{"server error", map[string]string{"OAUTH_TOKEN": "xoxb-token", "DEST_CHANNEL_ID": "C12345"}, slacktest.PostMessage, http.StatusServiceUnavailable, "503"},
+		{"webhook error", map[string]string{}, slacktest.Webhook, http.StatusInternalServerError, "500"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := slacktest.NewServer()
+			defer server.Close()
+			env := map[string]string{"BUILD_STATUS": "FAILURE", "SLACK_API_URL": server.APIURL(), "HOOK_URL": server.WebhookURL()}
+			for key, value := range tt.env {
+				env[key] = value
+			}
+			setEndToEndEnv(t, env)
+			server.Fail(tt.endpoint, tt.statusCode, 1)
+
+			_, err := handleRequest(context.Background(), ciresult.NewSlackClient())
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("handleRequest() error = %v, want %q", err, tt.wantErr)
+			}
+			if got := len(server.Requests(tt.endpoint)); got != 1 {
+				t.Errorf("expected a single request to %s, got %d", tt.endpoint, got)
+			}
+		})
+	}
+}
+
+func Test_endToEndLogUploadFailure(t *testing.T) {
+	server := slacktest.NewServer()
+	defer server.Close()
+	dir := t.TempDir()
+	logFile := filepath.Join(dir, "build.log")
+	if err := os.WriteFile(logFile, []byte("ERROR\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	historyFile := filepath.Join(dir, "history.json")
+	setEndToEndEnv(t, map[string]string{
+		"BUILD_STATUS":    "FAILURE",
+		"OAUTH_TOKEN":     "xoxb-token",
+		"DEST_CHANNEL_ID": "C12345",
+		"SLACK_API_URL":   server.APIURL(),
+		"LOG_FILE":        logFile,
+		"HISTORY_FILE":    historyFile,
+	})
+	server.Fail(slacktest.Upload, http.StatusBadGateway, 1)
+
+	got, err := handleRequest(context.Background(), ciresult.NewSlackClient())
+	if err != nil {
+		t.Fatalf("handleRequest() unexpected error: %v", err)
+	}
+	if want := fmt.Sprintf(messageSentTemplate, "deploy"); got != want {
+		t.Errorf("handleRequest() got = %v, want %v", got, want)
+	}
+	if got := len(server.Requests(slacktest.PostMessage)); got != 1 {
+		t.Errorf("expected the message to be posted once, got %d", got)
+	}
+	if got := len(server.Requests(slacktest.Upload)); got != 1 {
+		t.Errorf("expected a single upload attempt, got %d", got)
+	}
+	history, err := ciresult.LoadHistory(historyFile)
+	if err != nil || len(history.Records) != 1 {
+		t.Errorf("expected the posted build to be recorded, got %v, %v", history, err)
+	}
+}
+
+func Test_handleDigest(t *testing.T) {
+	server := slacktest.NewServer()
+	defer server.Close()
+	historyFile := filepath.Join(t.TempDir(), "history.json")
+	setEndToEndEnv(t, map[string]string{
+		"HISTORY_FILE":    historyFile,
+		"OAUTH_TOKEN":     "xoxb-token",
+		"DEST_CHANNEL_ID": "C12345",
+		"SLACK_API_URL":   server.APIURL(),
+	})
+	for _, status := range []string{"FAILURE", "SUCCESS"} {
+		t.Setenv("BUILD_STATUS", status)
+		_, err := handleRequest(context.Background(), ciresult.NewSlackClient())
+		if err != nil {
+			t.Fatalf("handleRequest() unexpected error: %v", err)
+		}
+	}
+
+	for _, key := range []string{"JOB_NAME", "BUILD_URL", "BUILD_STATUS"} {
+		t.Setenv(key, "")
+	}
+	got, err := handleDigest(context.Background(), ciresult.NewSlackClient())
+	if err != nil {
+		t.Fatalf("handleDigest() unexpected error: %v", err)
+	}
+	if want := fmt.Sprintf(digestsPostedTemplate, 1); got != want {
+		t.Errorf("handleDigest() got = %v, want %v", got, want)
+	}
+	messages := server.Requests(slacktest.PostMessage)
+	if len(messages) != 3 {
+		t.Fatalf("expected two builds and a digest to be posted, got %d messages", len(messages))
+	}
+	attachments, err := messages[2].Attachments()
+	if err != nil || len(attachments) != 1 {
+		t.Fatalf("Attachments() = %v, %v", attachments, err)
+	}
+	wantFields := []slack.AttachmentField{
+		{Title: "Pass Rates", Value: "• deploy: 1/2 (50%)"},
+		{Title: "Failure Streaks", Value: "• deploy: 1"},
+		{Title: "Newly Fixed", Value: "• deploy"},
+	}
+	if !reflect.DeepEqual(attachments[0].Fields, wantFields) || attachments[0].Color != "warning" {
+		t.Errorf("digest = %+v, want fields %+v", attachments[0], wantFields)
+	}
+}
+
+func Test_handleValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		env     map[string]string
+		want    string
+		wantErr string
+	}{
+		{"no rules", map[string]string{}, configValidMessage, ""},
+		{
+			"rules",
+			map[string]string{"NOTIFY_RULES": "on: failed, fixed; skip triggered-by: Timer", "SKIP_IF_SUCCESS": "true"},
+			configValidMessage + "\nBuilds are posted according to:\n  notify on: Failed, Fixed\n  skip triggered-by: Timer\n  skip on: Success",
+			"",
+		},
+		{"invalid rules", map[string]string{"NOTIFY_RULES": "on: Failed; skip authors: bob"}, "", `invalid NOTIFY_RULES rule "skip authors: bob"`},
+		{"invalid quiet hours", map[string]string{"QUIET_HOURS": "22:00"}, "", "invalid QUIET_HOURS window"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setEndToEndEnv(t, tt.env)
+			for _, key := range []string{"JOB_NAME", "BUILD_URL", "BUILD_STATUS"} {
+				t.Setenv(key, "")
+			}
+			got, err := handleValidate(context.Background(), ciresult.NewSlackClient())
+			if tt.wantErr == "" && err != nil || tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)) {
+				t.Errorf("handleValidate() error = %v, want %q", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("handleValidate() got = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_commandHandler(t *testing.T) {
+	tests := []struct {
+		name    string
+		args    []string
+		want    func(context.Context, ciresult.SlackClient) (string, error)
+		wantErr string
+	}{
+		{"no command", nil, handleRequest, ""},
+		{"collect", []string{collectCommand}, handleCollect, ""},
+		{"digest", []string{digestCommand, "ignored"}, handleDigest, ""},
+		{"validate", []string{validateCommand}, handleValidate, ""},
+		{"unknown command", []string{"digets"}, nil, `unknown command "digets", expected collect, digest or validate`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := commandHandler(tt.args)
+			if tt.wantErr != "" {
+				if err == nil || err.Error() != tt.wantErr {
+					t.Errorf("commandHandler() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("commandHandler() unexpected error: %v", err)
+			}
+			if reflect.ValueOf(got).Pointer() != reflect.ValueOf(tt.want).Pointer() {
+				t.Errorf("commandHandler() returned the wrong handler for %v", tt.args)
+			}
+		})
+	}
+}